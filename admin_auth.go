@@ -0,0 +1,151 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log/slog"
+    "sync"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Asks user for admin password (when needPassword is set) and TOTP code,
+// blocks until user answers or context is done
+type adminPrompt func(ctx context.Context, profile ServerProfile, needPassword bool) (password, totp string, err error)
+
+// Logs in to Mail-in-a-Box admin API when server rejects credentials.
+// Accounts with two-factor authentication get session key, which is saved
+// in profile instead of admin password. Password stays in memory only
+type adminAuth struct {
+    mu        sync.Mutex
+    store     *settingsStore
+    prompt    adminPrompt
+    totp      string            // Code given on command line, used once
+    passwords map[string]string // Admin passwords entered in this run by profile name
+    issued    map[string]string // Secret returned by last login by profile name
+}
+
+// Admin sessions of all mailboxes, configured in main
+var adminSessions = &adminAuth{passwords: map[string]string{}, issued: map[string]string{}}
+
+// Return TOTP code given on command line, it's valid only once
+func (a *adminAuth) takeTOTP() string {
+    totp := a.totp
+    a.totp = ""
+    return totp
+}
+
+// Return saved version of profile, given one is used when it's not saved yet
+func (a *adminAuth) currentProfile(profile ServerProfile) ServerProfile {
+    if a.store == nil {
+        return profile
+    }
+    if saved, ok := a.store.Get().findProfile(profile.Name); ok && saved.ApiURL == profile.ApiURL {
+        return saved
+    }
+    return profile
+}
+
+// Ask user for credentials, fails when no prompt is configured
+func (a *adminAuth) ask(ctx context.Context, profile ServerProfile, needPassword bool) (string, string, error) {
+    if a.prompt == nil {
+        return "", "", fmt.Errorf("admin login of profile %q requires user input", profile.Name)
+    }
+    return a.prompt(ctx, profile, needPassword)
+}
+
+// Log in again after server rejected credentials of profile. Returns
+// password or session key to use for API requests. Rejected is secret that
+// failed; when another operation logged in meanwhile, its secret is
+// returned without logging in again
+func (a *adminAuth) reauthenticate(ctx context.Context, profile ServerProfile, rejected string) (string, error) {
+    // One prompt at a time, other operations wait for its session
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    if issued := a.issued[profile.Name]; issued != "" && issued != rejected {
+        return issued, nil
+    }
+
+    profile = a.currentProfile(profile)
+    password := profile.AdminPassword
+    if password == "" {
+        password = a.passwords[profile.Name]
+    }
+    totp := a.takeTOTP()
+
+    var err error
+    if password == "" {
+        if password, totp, err = a.ask(ctx, profile, true); err != nil {
+            return "", err
+        }
+    }
+
+    session, err := tempmail.Login(ctx, profile.ApiURL, profile.AdminEmail, password, totp)
+    if errors.Is(err, tempmail.ErrTOTPRequired) && totp == "" {
+        if _, totp, err = a.ask(ctx, profile, false); err != nil {
+            return "", err
+        }
+        session, err = tempmail.Login(ctx, profile.ApiURL, profile.AdminEmail, password, totp)
+    }
+    if err != nil {
+        return "", err
+    }
+    a.passwords[profile.Name] = password
+
+    // Password alone is enough without two-factor authentication
+    if totp == "" {
+        a.issued[profile.Name] = password
+        return password, nil
+    }
+
+    slog.Info("Logged in with TOTP, saving session key", "url", profile.ApiURL)
+    a.saveSession(profile.Name, session.Key)
+    a.issued[profile.Name] = session.Key
+    return session.Key, nil
+}
+
+// Store session key in profile and remove admin password from settings file
+func (a *adminAuth) saveSession(name, key string) {
+    if a.store == nil {
+        return
+    }
+    if _, ok := a.store.Get().findProfile(name); !ok {
+        return
+    }
+
+    err := a.store.Update(func(s *Settings) {
+        profile, _ := s.findProfile(name)
+        profile.SessionKey = key
+        profile.AdminPassword = ""
+        s.setProfile(name, profile)
+    })
+    if err != nil {
+        slog.Error("Error saving session key", "error", err)
+    }
+}
+
+// Invalidate session key of profile on server and remove it from settings
+func (a *adminAuth) logout(ctx context.Context, name string) error {
+    profile, ok := a.store.Get().findProfile(name)
+    if !ok || profile.SessionKey == "" {
+        return fmt.Errorf("profile %q has no admin session", name)
+    }
+
+    session := tempmail.AdminSession{Email: profile.AdminEmail, Key: profile.SessionKey}
+    if err := tempmail.Logout(ctx, profile.ApiURL, session); err != nil {
+        slog.Error("Error logging out", "error", err)
+    }
+
+    a.mu.Lock()
+    delete(a.passwords, name)
+    delete(a.issued, name)
+    a.mu.Unlock()
+
+    return a.store.Update(func(s *Settings) {
+        profile, _ := s.findProfile(name)
+        profile.SessionKey = ""
+        s.setProfile(name, profile)
+    })
+}
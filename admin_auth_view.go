@@ -0,0 +1,62 @@
+package main
+
+import (
+    "context"
+    "fmt"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Result of login dialog
+type adminLogin struct {
+    password string
+    totp     string
+    ok       bool
+}
+
+// Return prompt asking for admin password and TOTP code in dialog over
+// window. Caller is blocked until dialog is closed or context is done
+func newAdminPrompt(window fyne.Window) adminPrompt {
+    return func(ctx context.Context, profile ServerProfile, needPassword bool) (string, string, error) {
+        passwordEntry := widget.NewPasswordEntry()
+        totpEntry := widget.NewEntry()
+        totpEntry.SetPlaceHolder("6-digit code, empty if not enabled")
+
+        items := []*widget.FormItem{
+            widget.NewFormItem("Account", widget.NewLabel(profile.AdminEmail)),
+        }
+        if needPassword {
+            items = append(items, widget.NewFormItem("Password", passwordEntry))
+        } else {
+            totpEntry.SetPlaceHolder("6-digit code")
+        }
+        items = append(items, widget.NewFormItem("TOTP code", totpEntry))
+
+        result := make(chan adminLogin, 1)
+        loginDialog := dialog.NewForm(
+            fmt.Sprintf("Log in to %s", profile.Name),
+            "Log in",
+            "Cancel",
+            items,
+            func(ok bool) {
+                result <- adminLogin{password: passwordEntry.Text, totp: totpEntry.Text, ok: ok}
+            },
+            window,
+        )
+        loginDialog.Resize(fyne.NewSize(400, 200))
+        loginDialog.Show()
+
+        select {
+        case login := <-result:
+            if !login.ok {
+                return "", "", fmt.Errorf("admin login cancelled")
+            }
+            return login.password, login.totp, nil
+        case <-ctx.Done():
+            loginDialog.Hide()
+            return "", "", ctx.Err()
+        }
+    }
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+    "bufio"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "reflect"
+    "sync"
+    "time"
+)
+
+// File of audit log in data directory, one JSON entry per line
+const auditLogFile = "audit.jsonl"
+
+// Actors recorded in audit log. Local API actor is created by apiActor
+const (
+    ActorGUI     = "gui"     // User of the application window
+    ActorRules   = "rules"   // Mail rules run on new messages
+    ActorJanitor = "janitor" // Background retention janitor and quota purge
+)
+
+// Actions recorded in audit log
+const (
+    AuditMailboxCreate    = "mailbox.create"
+    AuditMailboxDelete    = "mailbox.delete"
+    AuditMailboxConvert   = "mailbox.convert"
+    AuditMessageDelete    = "message.delete"
+    AuditMessageDeleteAll = "message.delete_all"
+    AuditMessagePurge     = "message.purge"
+    AuditTrashEmpty       = "trash.empty"
+    AuditSettingsChange   = "settings.change"
+    AuditRuleRun          = "rule.run"
+)
+
+// Outcomes recorded in audit log
+const (
+    OutcomeSuccess = "success"
+    OutcomeFailure = "failure"
+)
+
+// Entry of audit log
+type auditEntry struct {
+    Time    time.Time `json:"time"`
+    Actor   string    `json:"actor"`
+    Action  string    `json:"action"`
+    Target  string    `json:"target"`
+    Outcome string    `json:"outcome"`
+    Detail  string    `json:"detail,omitempty"`
+}
+
+// Append-only log of actions removing or changing data. Unlike
+// tempmail.log, entries are structured so they can be searched and
+// exported
+type auditLog struct {
+    mu   sync.Mutex
+    path string
+}
+
+func newAuditLog(path string) *auditLog {
+    return &auditLog{path: path}
+}
+
+// Return actor of local API request. Requests are told apart by
+// fingerprint of server token, the token itself is never written
+func apiActor(token string) string {
+    if token == "" {
+        return "api"
+    }
+    sum := sha256.Sum256([]byte(token))
+    return "api:" + hex.EncodeToString(sum[:4])
+}
+
+// Record appends entry, time is set when empty
+func (a *auditLog) Record(entry auditEntry) {
+    if entry.Time.IsZero() {
+        entry.Time = time.Now().UTC()
+    }
+    data, err := json.Marshal(entry)
+    if err != nil {
+        slog.Error("Error serializing audit entry", "error", err)
+        return
+    }
+
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+    if err != nil {
+        slog.Error("Error writing audit log", "error", err)
+        return
+    }
+    defer file.Close()
+    if _, err := file.Write(append(data, '\n')); err != nil {
+        slog.Error("Error writing audit log", "error", err)
+    }
+}
+
+// RecordResult appends entry with outcome of operation, error is added to
+// detail
+func (a *auditLog) RecordResult(actor, action, target string, err error, detail string) {
+    entry := auditEntry{Actor: actor, Action: action, Target: target, Outcome: OutcomeSuccess, Detail: detail}
+    if err != nil {
+        entry.Outcome = OutcomeFailure
+        if detail != "" {
+            entry.Detail = fmt.Sprintf("%s: %v", detail, err)
+        } else {
+            entry.Detail = err.Error()
+        }
+    }
+    a.Record(entry)
+}
+
+// Entries returns all entries in order they were recorded. Damaged lines
+// are skipped
+func (a *auditLog) Entries() ([]auditEntry, error) {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+
+    file, err := os.Open(a.path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error opening audit log: %w", err)
+    }
+    defer file.Close()
+
+    var entries []auditEntry
+    scanner := bufio.NewScanner(file)
+    scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+    for scanner.Scan() {
+        var entry auditEntry
+        if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+            slog.Warn("Skipping damaged audit entry", "error", err)
+            continue
+        }
+        entries = append(entries, entry)
+    }
+    if err := scanner.Err(); err != nil {
+        return entries, fmt.Errorf("error reading audit log: %w", err)
+    }
+    return entries, nil
+}
+
+// Return names of settings fields which differ. Values are not returned,
+// they may contain passwords and tokens
+func changedSettings(old, new Settings) []string {
+    var changed []string
+    oldValue := reflect.ValueOf(old)
+    newValue := reflect.ValueOf(new)
+    for i := 0; i < oldValue.NumField(); i++ {
+        if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+            changed = append(changed, oldValue.Type().Field(i).Name)
+        }
+    }
+    return changed
+}
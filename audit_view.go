@@ -0,0 +1,123 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Return entries containing query in any field, newest first
+func filterAuditEntries(entries []auditEntry, query string) []auditEntry {
+    query = strings.ToLower(strings.TrimSpace(query))
+    var filtered []auditEntry
+    for i := len(entries) - 1; i >= 0; i-- {
+        entry := entries[i]
+        text := strings.ToLower(strings.Join([]string{entry.Actor, entry.Action, entry.Target, entry.Outcome, entry.Detail}, " "))
+        if query == "" || strings.Contains(text, query) {
+            filtered = append(filtered, entry)
+        }
+    }
+    return filtered
+}
+
+// Build row of audit entry
+func newAuditRow(entry auditEntry) fyne.CanvasObject {
+    title := widget.NewLabelWithStyle(
+        fmt.Sprintf("%s  %s  %s", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Action, entry.Target),
+        fyne.TextAlignLeading,
+        fyne.TextStyle{Bold: entry.Outcome == OutcomeFailure},
+    )
+    text := fmt.Sprintf("%s by %s", entry.Outcome, entry.Actor)
+    if entry.Detail != "" {
+        text += ": " + entry.Detail
+    }
+    detail := widget.NewLabel(text)
+    detail.Wrapping = fyne.TextWrapWord
+    return container.NewVBox(title, detail)
+}
+
+// Show window with audit log filtered by text and export of shown entries
+// to JSON
+func showAuditWindow(myApp fyne.App, audit *auditLog) {
+    window := myApp.NewWindow("Audit log")
+
+    entriesList := container.NewVBox()
+    summaryLabel := widget.NewLabel("")
+    filterEntry := widget.NewEntry()
+    filterEntry.SetPlaceHolder("Filter by actor, action, address or outcome")
+
+    var entries, shown []auditEntry
+    show := func() {
+        shown = filterAuditEntries(entries, filterEntry.Text)
+        entriesList.Objects = nil
+        for _, entry := range shown {
+            entriesList.Add(newAuditRow(entry))
+        }
+        entriesList.Refresh()
+        summaryLabel.SetText(fmt.Sprintf("%d of %d entries", len(shown), len(entries)))
+    }
+    filterEntry.OnChanged = func(string) {
+        show()
+    }
+
+    refresh := func() {
+        var err error
+        entries, err = audit.Entries()
+        if err != nil {
+            slog.Error("Error reading audit log", "error", err)
+            dialog.ShowError(fmt.Errorf("Error reading audit log: %v", err), window)
+        }
+        show()
+    }
+
+    exportButton := widget.NewButton("Export JSON", func() {
+        exported := shown
+        saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+            if err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            if writer == nil {
+                return
+            }
+            defer writer.Close()
+
+            if exported == nil {
+                exported = []auditEntry{}
+            }
+            encoder := json.NewEncoder(writer)
+            encoder.SetIndent("", "  ")
+            if err := encoder.Encode(exported); err != nil {
+                slog.Error("Error exporting audit log", "error", err)
+                dialog.ShowError(fmt.Errorf("Error exporting audit log: %v", err), window)
+                return
+            }
+            dialog.ShowInformation("Success", fmt.Sprintf("Exported %d entries", len(exported)), window)
+        }, window)
+        saveDialog.SetFileName("audit.json")
+        saveDialog.Show()
+    })
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(
+            container.NewHBox(widget.NewButton("Refresh", refresh), layout.NewSpacer(), exportButton),
+            filterEntry,
+            summaryLabel,
+        ),
+        nil,
+        nil,
+        nil,
+        container.NewVScroll(entriesList),
+    ))
+    refresh()
+
+    window.Resize(fyne.NewSize(700, 600))
+    window.Show()
+}
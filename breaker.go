@@ -0,0 +1,106 @@
+package main
+
+import (
+    "sync"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Defaults of circuit breaker settings
+const (
+    defaultBreakerThreshold = 5
+    defaultBreakerCooldown  = 60 * time.Second
+)
+
+// State of circuit breaker reported to listener
+type breakerState struct {
+    Open      bool
+    Permanent bool      // Opened by permanent error, stays open until reset
+    Until     time.Time // End of pause when not permanent
+    Err       error     // Error which opened breaker
+}
+
+// Circuit breaker pausing background polling after repeated failures, so
+// unreachable or misconfigured server isn't hammered with requests
+type circuitBreaker struct {
+    mu        sync.Mutex
+    threshold int
+    cooldown  time.Duration
+    failures  int
+    state     breakerState
+    onChange  func(breakerState)
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onChange func(breakerState)) *circuitBreaker {
+    b := &circuitBreaker{onChange: onChange}
+    b.Configure(threshold, cooldown)
+    return b
+}
+
+// Configure changes number of consecutive failures opening breaker and
+// duration of pause. Zero values use defaults
+func (b *circuitBreaker) Configure(threshold int, cooldown time.Duration) {
+    if threshold <= 0 {
+        threshold = defaultBreakerThreshold
+    }
+    if cooldown <= 0 {
+        cooldown = defaultBreakerCooldown
+    }
+
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    b.threshold = threshold
+    b.cooldown = cooldown
+}
+
+// Allow reports whether request may be sent. After pause one request is
+// allowed to probe server, its failure opens breaker again
+func (b *circuitBreaker) Allow() bool {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if !b.state.Open {
+        return true
+    }
+    return !b.state.Permanent && time.Now().After(b.state.Until)
+}
+
+// Success closes breaker
+func (b *circuitBreaker) Success() {
+    b.mu.Lock()
+    b.failures = 0
+    wasOpen := b.state.Open
+    b.state = breakerState{}
+    b.mu.Unlock()
+
+    if wasOpen {
+        b.onChange(breakerState{})
+    }
+}
+
+// Failure records failed request. Permanent errors such as rejected
+// credentials open breaker at once until it is reset
+func (b *circuitBreaker) Failure(err error) {
+    b.mu.Lock()
+    b.failures++
+    var state breakerState
+    switch {
+    case tempmail.IsPermanent(err):
+        state = breakerState{Open: true, Permanent: true, Err: err}
+    case b.failures >= b.threshold:
+        state = breakerState{Open: true, Until: time.Now().Add(b.cooldown), Err: err}
+    default:
+        b.mu.Unlock()
+        return
+    }
+    b.state = state
+    b.mu.Unlock()
+
+    b.onChange(state)
+}
+
+// Reset closes breaker, used when user retries manually or changes settings
+func (b *circuitBreaker) Reset() {
+    b.Success()
+}
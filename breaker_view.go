@@ -0,0 +1,52 @@
+package main
+
+import (
+    "fmt"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Banner shown at the top of the main window while polling is paused by
+// circuit breaker
+type breakerBanner struct {
+    Container *fyne.Container
+
+    label *widget.Label
+}
+
+func newBreakerBanner(onRetry func()) *breakerBanner {
+    banner := &breakerBanner{
+        label: widget.NewLabel(""),
+    }
+    banner.label.Wrapping = fyne.TextWrapWord
+
+    retryButton := widget.NewButton("Retry now", onRetry)
+    banner.Container = container.NewBorder(
+        nil,
+        widget.NewSeparator(),
+        nil,
+        container.NewVBox(layout.NewSpacer(), retryButton, layout.NewSpacer()),
+        banner.label,
+    )
+    banner.Container.Hide()
+    return banner
+}
+
+// Update shows or hides banner according to breaker state
+func (b *breakerBanner) Update(state breakerState) {
+    if !state.Open {
+        b.Container.Hide()
+        return
+    }
+
+    if state.Permanent {
+        b.label.SetText(fmt.Sprintf("⚠ Server rejected the request, automatic updates are paused.\nCheck settings and retry. %v", state.Err))
+    } else {
+        b.label.SetText(fmt.Sprintf("⚠ Server is not responding, automatic updates are paused until %s.\n%v",
+            state.Until.Format("15:04:05"), state.Err))
+    }
+    b.Container.Show()
+}
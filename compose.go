@@ -0,0 +1,156 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log/slog"
+    "mime"
+    "path/filepath"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Split comma or semicolon separated list of addresses
+func splitAddresses(text string) []string {
+    var addresses []string
+    for _, addr := range strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' }) {
+        if addr = strings.TrimSpace(addr); addr != "" {
+            addresses = append(addresses, addr)
+        }
+    }
+    return addresses
+}
+
+// Show window for composing new message or reply sent from the mailbox
+func showComposeWindow(myApp fyne.App, mailbox *tempmail.TempMailbox, draft tempmail.OutgoingEmail, timeout time.Duration) {
+    title := "New message"
+    if draft.InReplyTo != "" {
+        title = "Reply"
+    }
+    window := myApp.NewWindow(title + " - " + mailbox.Address())
+
+    // Create input fields
+    toEntry := widget.NewEntry()
+    toEntry.SetText(strings.Join(draft.To, ", "))
+
+    ccEntry := widget.NewEntry()
+    ccEntry.SetText(strings.Join(draft.Cc, ", "))
+
+    subjectEntry := widget.NewEntry()
+    subjectEntry.SetText(draft.Subject)
+
+    bodyEntry := widget.NewMultiLineEntry()
+    bodyEntry.SetText(draft.Text)
+    bodyEntry.Wrapping = fyne.TextWrapWord
+    bodyEntry.SetMinRowsVisible(12)
+
+    htmlCheck := widget.NewCheck("Body is HTML", nil)
+
+    // Create attachment list
+    attachments := draft.Attachments
+    attachmentsLabel := widget.NewLabel("")
+    updateAttachments := func() {
+        names := make([]string, len(attachments))
+        for i, attachment := range attachments {
+            names[i] = attachment.Name
+        }
+        attachmentsLabel.SetText("Attachments: " + strings.Join(names, ", "))
+    }
+    updateAttachments()
+
+    addAttachmentBtn := widget.NewButton("Add attachment", func() {
+        dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+            if err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            if reader == nil {
+                return
+            }
+            defer reader.Close()
+
+            data, err := io.ReadAll(reader)
+            if err != nil {
+                dialog.ShowError(fmt.Errorf("Error reading attachment: %v", err), window)
+                return
+            }
+            name := reader.URI().Name()
+            attachments = append(attachments, tempmail.Attachment{
+                Name:        name,
+                ContentType: mime.TypeByExtension(filepath.Ext(name)),
+                Data:        data,
+            })
+            updateAttachments()
+        }, window)
+    })
+
+    clearAttachmentsBtn := widget.NewButton("Clear", func() {
+        attachments = nil
+        updateAttachments()
+    })
+
+    // Create indicator of sending with cancel button
+    operations := newOperationBar()
+
+    sendButton := widget.NewButton("Send", func() {
+        msg := draft
+        msg.To = splitAddresses(toEntry.Text)
+        msg.Cc = splitAddresses(ccEntry.Text)
+        msg.Subject = subjectEntry.Text
+        msg.Attachments = attachments
+        if htmlCheck.Checked {
+            msg.HTML = bodyEntry.Text
+            msg.Text = tempmail.ExtractTextFromHTML(bodyEntry.Text)
+        } else {
+            msg.HTML = ""
+            msg.Text = bodyEntry.Text
+        }
+
+        if len(msg.Recipients()) == 0 {
+            dialog.ShowError(fmt.Errorf("Please enter at least one recipient"), window)
+            return
+        }
+
+        go func() {
+            ctx, done := operations.Start("Sending message...", timeout)
+            err := mailbox.Send(ctx, msg)
+            done()
+            if err != nil {
+                slog.Error("Error sending message", "error", err)
+                if !cancelled(ctx) {
+                    dialog.ShowError(fmt.Errorf("Error sending message: %v", err), window)
+                }
+                return
+            }
+            window.Close()
+        }()
+    })
+
+    form := container.NewVBox(
+        widget.NewLabel("From: "+mailbox.Address()),
+        widget.NewLabel("To:"),
+        toEntry,
+        widget.NewLabel("Cc:"),
+        ccEntry,
+        widget.NewLabel("Subject:"),
+        subjectEntry,
+    )
+
+    bottom := container.NewVBox(
+        htmlCheck,
+        container.NewHBox(attachmentsLabel, layout.NewSpacer(), addAttachmentBtn, clearAttachmentsBtn),
+        operations.Container,
+        container.NewHBox(layout.NewSpacer(), sendButton),
+    )
+
+    window.SetContent(container.NewPadded(container.NewBorder(form, bottom, nil, nil, bodyEntry)))
+    window.Resize(fyne.NewSize(500, 600))
+    window.Show()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/theme"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Return icon of diagnostic check status
+func checkStatusIcon(status tempmail.CheckStatus) fyne.Resource {
+    switch status {
+    case tempmail.CheckPassed:
+        return theme.ConfirmIcon()
+    case tempmail.CheckWarning:
+        return theme.WarningIcon()
+    case tempmail.CheckFailed:
+        return theme.ErrorIcon()
+    default:
+        return theme.MediaSkipNextIcon()
+    }
+}
+
+// Build checklist row of diagnostic check with remediation hint
+func newCheckRow(result tempmail.CheckResult) fyne.CanvasObject {
+    title := widget.NewLabelWithStyle(
+        fmt.Sprintf("%s (%s)", result.Name, result.Duration.Round(time.Millisecond)),
+        fyne.TextAlignLeading,
+        fyne.TextStyle{Bold: true},
+    )
+    detail := widget.NewLabel(result.Detail)
+    detail.Wrapping = fyne.TextWrapWord
+
+    rows := container.NewVBox(title, detail)
+    if result.Hint != "" {
+        hint := widget.NewLabel("Hint: " + result.Hint)
+        hint.Wrapping = fyne.TextWrapWord
+        rows.Add(hint)
+    }
+    return container.NewBorder(nil, nil, widget.NewIcon(checkStatusIcon(result.Status)), nil, rows)
+}
+
+// Run diagnostics of server profile and show results as checklist while
+// checks finish. Closing dialog cancels running checks, test user is still
+// deleted
+func showDiagnosticsDialog(window fyne.Window, settings Settings, profile ServerProfile) {
+    testMailbox, err := newMailbox(settings, profile)
+    if err != nil {
+        dialog.ShowError(fmt.Errorf("Error connecting to API: %v", err), window)
+        return
+    }
+
+    checklist := container.NewVBox()
+    status := widget.NewLabel("Running checks...")
+    progress := widget.NewProgressBarInfinite()
+
+    ctx, cancel := context.WithTimeout(context.Background(), settings.operationTimeout())
+
+    diagnosticsDialog := dialog.NewCustom(
+        fmt.Sprintf("Diagnostics of %s", profile.Name),
+        "Close",
+        container.NewBorder(container.NewVBox(status, progress), nil, nil, nil, container.NewVScroll(checklist)),
+        window,
+    )
+    diagnosticsDialog.SetOnClosed(cancel)
+    diagnosticsDialog.Resize(fyne.NewSize(600, 500))
+    diagnosticsDialog.Show()
+
+    go func() {
+        defer cancel()
+
+        results := testMailbox.Diagnose(ctx, func(result tempmail.CheckResult) {
+            slog.Info("Diagnostics", "check", result.Name, "status", result.Status, "detail", result.Detail)
+            checklist.Add(newCheckRow(result))
+        })
+
+        counts := map[tempmail.CheckStatus]int{}
+        for _, result := range results {
+            counts[result.Status]++
+        }
+        progress.Hide()
+        status.SetText(fmt.Sprintf("%d passed, %d warnings, %d failed, %d skipped",
+            counts[tempmail.CheckPassed], counts[tempmail.CheckWarning],
+            counts[tempmail.CheckFailed], counts[tempmail.CheckSkipped]))
+    }()
+}
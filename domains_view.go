@@ -0,0 +1,46 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Describe automatic domain choice of profile
+func automaticDomainLabel(profile ServerProfile) string {
+    switch profile.DomainSelection {
+    case tempmail.DomainRandom:
+        return "Automatic (random domain)"
+    case tempmail.DomainRoundRobin:
+        return "Automatic (round-robin)"
+    default:
+        return fmt.Sprintf("Automatic (%s)", profile.Domain)
+    }
+}
+
+// Show dialog choosing domain of new mailbox. Empty domain passed to
+// onCreate means domain is chosen according to profile
+func showDomainPickerDialog(window fyne.Window, profile ServerProfile, domains []string, onCreate func(domain string)) {
+    automatic := automaticDomainLabel(profile)
+    domainSelect := widget.NewSelect(append([]string{automatic}, domains...), nil)
+    domainSelect.SetSelected(automatic)
+
+    dialog.ShowCustomConfirm("Create new mailbox", "Create", "Cancel",
+        container.NewVBox(widget.NewLabel("Domain:"), domainSelect),
+        func(create bool) {
+            if !create {
+                return
+            }
+            if domainSelect.Selected == automatic {
+                onCreate("")
+                return
+            }
+            onCreate(domainSelect.Selected)
+        },
+        window,
+    )
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/storage"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Create card displaying message headers and content with switch between
+// text and HTML representation. Header objects are placed next to sender,
+// buttons are placed after view switch button
+func newEmailCard(email tempmail.Email, header []fyne.CanvasObject, buttons []fyne.CanvasObject) *widget.Card {
+    // Create labels for headers
+    fromLabel := widget.NewLabelWithStyle(
+        emailStatusMarker(email)+"From: "+email.From,
+        fyne.TextAlignLeading,
+        fyne.TextStyle{Bold: true},
+    )
+    fromLabel.Wrapping = fyne.TextWrapWord
+
+    subjectLabel := widget.NewLabelWithStyle(
+        "Subject: "+email.Subject,
+        fyne.TextAlignLeading,
+        fyne.TextStyle{Bold: true},
+    )
+    subjectLabel.Wrapping = fyne.TextWrapWord
+
+    // Create switch between HTML and text representation
+    var content *widget.Entry
+    var htmlView *widget.RichText
+
+    content = widget.NewMultiLineEntry()
+    content.SetText(email.Content)
+    content.Disable()
+    content.Wrapping = fyne.TextWrapWord
+    content.TextStyle = fyne.TextStyle{Bold: true}
+    content.SetMinRowsVisible(8)
+
+    htmlView = widget.NewRichTextFromMarkdown(email.HTMLContent)
+    htmlView.Wrapping = fyne.TextWrapWord
+    htmlView.Hide()
+
+    viewTypeBtn := widget.NewButton("Switch view", func() {
+        if content.Visible() {
+            content.Hide()
+            htmlView.Show()
+        } else {
+            htmlView.Hide()
+            content.Show()
+        }
+    })
+
+    // Create content container
+    contentBox := container.NewVBox(
+        content,
+        htmlView,
+    )
+
+    fromRow := container.NewBorder(nil, nil, container.NewHBox(header...), nil, fromLabel)
+    buttonRow := container.NewHBox(append([]fyne.CanvasObject{viewTypeBtn}, buttons...)...)
+
+    // Create card for message with adaptive size
+    return widget.NewCard(
+        "",
+        "",
+        container.NewVBox(
+            container.NewPadded(
+                container.NewVBox(
+                    fromRow,
+                    subjectLabel,
+                    widget.NewSeparator(),
+                    contentBox,
+                    buttonRow,
+                ),
+            ),
+        ),
+    )
+}
+
+// Ask for file name and save message source as .eml file
+func saveEmailAsEML(window fyne.Window, email tempmail.Email) {
+    saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if writer == nil {
+            return
+        }
+        defer writer.Close()
+
+        if err := tempmail.WriteEML(writer, email); err != nil {
+            slog.Error("Error exporting message", "error", err)
+            dialog.ShowError(fmt.Errorf("Error exporting message: %v", err), window)
+        }
+    }, window)
+    saveDialog.SetFileName(fmt.Sprintf("message_%d.eml", email.UID))
+    saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".eml"}))
+    saveDialog.Show()
+}
+
+// Ask for file name and save messages as mbox file
+func saveEmailsAsMbox(window fyne.Window, emails []tempmail.Email) {
+    saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if writer == nil {
+            return
+        }
+        defer writer.Close()
+
+        if err := tempmail.WriteMbox(writer, emails); err != nil {
+            slog.Error("Error exporting messages", "error", err)
+            dialog.ShowError(fmt.Errorf("Error exporting messages: %v", err), window)
+            return
+        }
+        dialog.ShowInformation("Success", fmt.Sprintf("Exported %d messages", len(emails)), window)
+    }, window)
+    saveDialog.SetFileName("mailbox.mbox")
+    saveDialog.Show()
+}
+
+// Ask for directory and save messages into Maildir inside it
+func saveEmailsAsMaildir(window fyne.Window, emails []tempmail.Email) {
+    dialog.ShowFolderOpen(func(dir fyne.ListableURI, err error) {
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if dir == nil {
+            return
+        }
+
+        if err := tempmail.WriteMaildir(dir.Path(), emails); err != nil {
+            slog.Error("Error exporting messages", "error", err)
+            dialog.ShowError(fmt.Errorf("Error exporting messages: %v", err), window)
+            return
+        }
+        dialog.ShowInformation("Success", fmt.Sprintf("Exported %d messages to %s", len(emails), dir.Path()), window)
+    }, window)
+}
+
+// Ask for .eml or mbox file and show its messages in separate window
+func importEmails(myApp fyne.App, window fyne.Window) {
+    openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if reader == nil {
+            return
+        }
+        defer reader.Close()
+
+        emails, err := tempmail.ImportMessages(reader)
+        if err != nil {
+            slog.Error("Error importing messages", "error", err)
+            dialog.ShowError(fmt.Errorf("Error importing messages: %v", err), window)
+            return
+        }
+        showImportedWindow(myApp, reader.URI().Name(), emails)
+    }, window)
+    openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".eml", ".mbox", ".mbx"}))
+    openDialog.Show()
+}
+
+// Show imported messages using the same renderer as main message list
+func showImportedWindow(myApp fyne.App, title string, emails []tempmail.Email) {
+    window := myApp.NewWindow("Imported - " + title)
+
+    list := container.NewVBox()
+    for _, email := range emails {
+        email := email // Create new variable for closure
+        exportBtn := widget.NewButton("Export", func() {
+            saveEmailAsEML(window, email)
+        })
+        list.Add(container.NewPadded(newEmailCard(email, nil, []fyne.CanvasObject{layout.NewSpacer(), exportBtn})))
+    }
+
+    window.SetContent(container.NewScroll(container.NewPadded(list)))
+    window.Resize(fyne.NewSize(500, 600))
+    window.Show()
+}
+
+// Return messages which are selected or all messages if nothing is selected
+func selectedEmails(emails []tempmail.Email, selected map[uint32]bool) []tempmail.Email {
+    if len(selected) == 0 {
+        return emails
+    }
+    var result []tempmail.Email
+    for _, email := range emails {
+        if selected[email.UID] {
+            result = append(result, email)
+        }
+    }
+    return result
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "reflect"
+    "strconv"
+    "strings"
+    "time"
+    "unicode"
+)
+
+// Prefix of environment variables overriding settings. Variable name is
+// prefix followed by field path in upper snake case, for example
+// TEMPMAIL_OPERATION_TIMEOUT or TEMPMAIL_RETRY_READ_MAX_ATTEMPTS. Fields of
+// active profile use TEMPMAIL_PROFILE_, for example
+// TEMPMAIL_PROFILE_ADMIN_PASSWORD
+const envPrefix = "TEMPMAIL"
+
+// Prefix of variables overriding active profile
+const envProfilePrefix = envPrefix + "_PROFILE"
+
+// Settings field which can be overridden by environment variable
+type envField struct {
+    name  string
+    value reflect.Value
+}
+
+// Convert Go field name to upper snake case, ApiURL becomes API_URL
+func envName(field string) string {
+    runes := []rune(field)
+    var b strings.Builder
+    for i, r := range runes {
+        if i > 0 && unicode.IsUpper(r) {
+            prev := runes[i-1]
+            nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+            if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+                b.WriteByte('_')
+            }
+        }
+        b.WriteRune(unicode.ToUpper(r))
+    }
+    return b.String()
+}
+
+// Collect fields of struct value with names under prefix. Nested structs
+// are expanded, slices are set from JSON
+func collectEnvFields(prefix string, v reflect.Value, fields []envField) []envField {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        if !t.Field(i).IsExported() {
+            continue
+        }
+        name := prefix + "_" + envName(t.Field(i).Name)
+        field := v.Field(i)
+        if field.Kind() == reflect.Struct {
+            fields = collectEnvFields(name, field, fields)
+            continue
+        }
+        fields = append(fields, envField{name: name, value: field})
+    }
+    return fields
+}
+
+// Set field from string value of environment variable
+func setEnvField(field envField, text string) error {
+    value := field.value
+    switch {
+    case value.Type() == reflect.TypeOf(time.Duration(0)):
+        d, err := time.ParseDuration(text)
+        if err != nil {
+            return fmt.Errorf("%s: %w", field.name, err)
+        }
+        value.SetInt(int64(d))
+    case value.Kind() == reflect.String:
+        value.SetString(text)
+    case value.Kind() == reflect.Int:
+        n, err := strconv.Atoi(text)
+        if err != nil {
+            return fmt.Errorf("%s: %w", field.name, err)
+        }
+        value.SetInt(int64(n))
+    case value.Kind() == reflect.Bool:
+        b, err := strconv.ParseBool(text)
+        if err != nil {
+            return fmt.Errorf("%s: %w", field.name, err)
+        }
+        value.SetBool(b)
+    case value.Kind() == reflect.Float64:
+        f, err := strconv.ParseFloat(text, 64)
+        if err != nil {
+            return fmt.Errorf("%s: %w", field.name, err)
+        }
+        value.SetFloat(f)
+    case value.Kind() == reflect.Slice:
+        target := reflect.New(value.Type())
+        if err := json.Unmarshal([]byte(text), target.Interface()); err != nil {
+            return fmt.Errorf("%s: %w", field.name, err)
+        }
+        value.Set(target.Elem())
+    default:
+        return fmt.Errorf("%s: unsupported field type %s", field.name, value.Type())
+    }
+    return nil
+}
+
+// Report whether any variable overriding active profile is set
+func hasProfileEnv(lookup func(string) (string, bool)) bool {
+    for _, field := range collectEnvFields(envProfilePrefix, reflect.ValueOf(&ServerProfile{}).Elem(), nil) {
+        if _, ok := lookup(field.name); ok {
+            return true
+        }
+    }
+    return false
+}
+
+// Set fields from environment, returns number of applied variables
+func applyEnvFields(fields []envField, lookup func(string) (string, bool)) (int, error) {
+    applied := 0
+    for _, field := range fields {
+        if text, ok := lookup(field.name); ok {
+            if err := setEnvField(field, text); err != nil {
+                return applied, err
+            }
+            applied++
+        }
+    }
+    return applied, nil
+}
+
+// Override settings with environment variables, returns number of applied
+// variables. Profile is created when profile variables are set but
+// settings have no profiles
+func applyEnvOverrides(settings *Settings, lookup func(string) (string, bool)) (int, error) {
+    // Settings fields first, TEMPMAIL_PROFILES may replace profiles
+    applied, err := applyEnvFields(collectEnvFields(envPrefix, reflect.ValueOf(settings).Elem(), nil), lookup)
+    if err != nil || !hasProfileEnv(lookup) {
+        return applied, err
+    }
+
+    i := settings.profileIndex(settings.Profile().Name)
+    if i < 0 {
+        settings.setProfile(defaultProfileName, ServerProfile{Name: defaultProfileName})
+        i = settings.profileIndex(defaultProfileName)
+    }
+    profileApplied, err := applyEnvFields(collectEnvFields(envProfilePrefix, reflect.ValueOf(&settings.Profiles[i]).Elem(), nil), lookup)
+    return applied + profileApplied, err
+}
+
+// Replace values taken from environment with values of settings file, so
+// secrets passed by environment are never written to disk
+func restoreEnvOverrides(settings *Settings, file Settings, lookup func(string) (string, bool)) {
+    restore := func(fields, fileFields []envField) {
+        fileValues := map[string]reflect.Value{}
+        for _, field := range fileFields {
+            fileValues[field.name] = field.value
+        }
+        for _, field := range fields {
+            if _, ok := lookup(field.name); !ok {
+                continue
+            }
+            if value, ok := fileValues[field.name]; ok {
+                field.value.Set(value)
+            } else {
+                field.value.Set(reflect.Zero(field.value.Type()))
+            }
+        }
+    }
+
+    restore(
+        collectEnvFields(envPrefix, reflect.ValueOf(settings).Elem(), nil),
+        collectEnvFields(envPrefix, reflect.ValueOf(&file).Elem(), nil),
+    )
+
+    // Copy profiles so restoring them doesn't change caller's settings
+    settings.Profiles = append([]ServerProfile{}, settings.Profiles...)
+
+    if i := settings.profileIndex(settings.Profile().Name); i >= 0 {
+        var fileFields []envField
+        if j := file.profileIndex(settings.Profiles[i].Name); j >= 0 {
+            fileFields = collectEnvFields(envProfilePrefix, reflect.ValueOf(&file.Profiles[j]).Elem(), nil)
+        }
+        restore(collectEnvFields(envProfilePrefix, reflect.ValueOf(&settings.Profiles[i]).Elem(), nil), fileFields)
+    }
+}
+
+// Look up environment variable, empty values are treated as unset
+func lookupEnv(name string) (string, bool) {
+    value := os.Getenv(name)
+    return value, value != ""
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// Lookup of environment variables in map
+func mapLookup(env map[string]string) func(string) (string, bool) {
+    return func(name string) (string, bool) {
+        value, ok := env[name]
+        return value, ok
+    }
+}
+
+func TestEnvName(t *testing.T) {
+    tests := map[string]string{
+        "ApiURL":           "API_URL",
+        "AdminPassword":    "ADMIN_PASSWORD",
+        "SmtpServer":       "SMTP_SERVER",
+        "TLSPolicy":        "TLS_POLICY",
+        "MaxAttempts":      "MAX_ATTEMPTS",
+        "QuotaWarnPercent": "QUOTA_WARN_PERCENT",
+        "Retry":            "RETRY",
+    }
+    for field, want := range tests {
+        if got := envName(field); got != want {
+            t.Errorf("envName(%q) = %q, want %q", field, got, want)
+        }
+    }
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+    file := Settings{
+        Profiles:         []ServerProfile{{Name: "Work", ApiURL: "https://box.example.com/admin", Domain: "example.com"}},
+        ActiveProfile:    "Work",
+        OperationTimeout: 60,
+    }
+    env := map[string]string{
+        "TEMPMAIL_OPERATION_TIMEOUT":           "30",
+        "TEMPMAIL_DISABLE_AUTO_UPDATE":         "true",
+        "TEMPMAIL_RETRY_READ_INITIAL_INTERVAL": "2s",
+        "TEMPMAIL_RETRY_READ_JITTER":           "0.5",
+        "TEMPMAIL_PROFILE_ADMIN_PASSWORD":      "secret",
+        "TEMPMAIL_PROFILE_DOMAINS":             `["a.example","b.example"]`,
+    }
+
+    // Settings as read again from file
+    settings := file
+    settings.Profiles = append([]ServerProfile{}, file.Profiles...)
+    applied, err := applyEnvOverrides(&settings, mapLookup(env))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if applied != len(env) {
+        t.Errorf("applied %d variables, want %d", applied, len(env))
+    }
+    profile := settings.Profile()
+    if settings.OperationTimeout != 30 || !settings.DisableAutoUpdate ||
+        settings.Retry.Read.InitialInterval != 2*time.Second || settings.Retry.Read.Jitter != 0.5 {
+        t.Errorf("settings not overridden: %+v", settings)
+    }
+    if profile.AdminPassword != "secret" || !reflect.DeepEqual(profile.Domains, []string{"a.example", "b.example"}) ||
+        profile.ApiURL != "https://box.example.com/admin" {
+        t.Errorf("profile not overridden: %+v", profile)
+    }
+
+    // Values of environment are never saved, file values are restored
+    restoreEnvOverrides(&settings, file, mapLookup(env))
+    if settings.OperationTimeout != 60 || settings.DisableAutoUpdate || settings.Retry.Read.InitialInterval != 0 {
+        t.Errorf("settings not restored: %+v", settings)
+    }
+    if profile := settings.Profile(); profile.AdminPassword != "" || profile.Domains != nil || profile.Domain != "example.com" {
+        t.Errorf("profile not restored: %+v", profile)
+    }
+}
+
+func TestApplyEnvOverridesProfile(t *testing.T) {
+    // Profile variables create default profile when settings have none
+    var settings Settings
+    env := map[string]string{
+        "TEMPMAIL_PROFILE_API_URL":     "https://box.example.com/admin",
+        "TEMPMAIL_PROFILE_ADMIN_EMAIL": "admin@example.com",
+    }
+    if _, err := applyEnvOverrides(&settings, mapLookup(env)); err != nil {
+        t.Fatal(err)
+    }
+    profile := settings.Profile()
+    if len(settings.Profiles) != 1 || profile.Name != defaultProfileName || profile.AdminEmail != "admin@example.com" {
+        t.Errorf("got profiles %+v", settings.Profiles)
+    }
+
+    // Invalid value names its variable
+    _, err := applyEnvOverrides(&settings, mapLookup(map[string]string{"TEMPMAIL_UPDATE_PERIOD": "fast"}))
+    if err == nil || !strings.Contains(err.Error(), "TEMPMAIL_UPDATE_PERIOD") {
+        t.Errorf("got error %v, want error naming TEMPMAIL_UPDATE_PERIOD", err)
+    }
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/hex"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Mailbox event types delivered to webhooks and event stream
+const (
+    EventMessageReceived = "message.received"
+    EventMessageDeleted  = "message.deleted"
+    EventMailboxCreated  = "mailbox.created"
+    EventMailboxDeleted  = "mailbox.deleted"
+    EventRuleMatched     = "rule.matched" // Sent only to webhook chosen in mail rule
+)
+
+// EventEmail is message data included in event payload
+type EventEmail struct {
+    UID         uint32    `json:"uid"`
+    From        string    `json:"from,omitempty"`
+    FromAddress string    `json:"from_address,omitempty"`
+    Subject     string    `json:"subject,omitempty"`
+    Date        time.Time `json:"date,omitempty"`
+    MessageID   string    `json:"message_id,omitempty"`
+    Content     string    `json:"content,omitempty"`
+    HTMLContent string    `json:"html_content,omitempty"`
+    Codes       []string  `json:"codes,omitempty"`
+    Links       []string  `json:"links,omitempty"`
+}
+
+// MailEvent is JSON payload posted to webhook receivers and event stream clients
+type MailEvent struct {
+    ID        string      `json:"id"`
+    Type      string      `json:"type"`
+    Timestamp time.Time   `json:"timestamp"`
+    Mailbox   string      `json:"mailbox"`
+    Rule      string      `json:"rule,omitempty"` // Name of matched mail rule
+    Email     *EventEmail `json:"email,omitempty"`
+}
+
+// Create message.received event for email
+func newMessageEvent(mailbox string, email tempmail.Email) MailEvent {
+    event := newMailEvent(EventMessageReceived, mailbox)
+    event.Email = &EventEmail{
+        UID:         email.UID,
+        From:        email.From,
+        FromAddress: email.FromAddress,
+        Subject:     email.Subject,
+        Date:        email.Date,
+        MessageID:   email.MessageID,
+        Content:     email.Content,
+        HTMLContent: email.HTMLContent,
+        Codes:       tempmail.ExtractCodes(email.Content),
+        Links:       tempmail.ExtractLinks(email.Content, email.HTMLContent),
+    }
+    return event
+}
+
+// Create message.deleted event for message with UID
+func newMessageDeletedEvent(mailbox string, uid uint32) MailEvent {
+    event := newMailEvent(EventMessageDeleted, mailbox)
+    event.Email = &EventEmail{UID: uid}
+    return event
+}
+
+// Create event of given type for mailbox
+func newMailEvent(eventType, mailbox string) MailEvent {
+    return MailEvent{
+        ID:        newEventID(),
+        Type:      eventType,
+        Timestamp: time.Now().UTC(),
+        Mailbox:   mailbox,
+    }
+}
+
+// Generate random event ID
+func newEventID() string {
+    buf := make([]byte, 16)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
+
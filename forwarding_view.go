@@ -0,0 +1,77 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Split forwarding targets entered one per line or separated by commas
+func parseTargets(text string) []string {
+    var targets []string
+    for _, line := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == ',' }) {
+        if target := strings.TrimSpace(line); target != "" {
+            targets = append(targets, target)
+        }
+    }
+    return targets
+}
+
+// Load forwarding of mailbox and show dialog editing its target addresses.
+// Forwarding is removed when mailbox is deleted
+func showForwardingDialog(window fyne.Window, mailbox *tempmail.TempMailbox, operations *operationBar, timeout time.Duration) {
+    go func() {
+        ctx, done := operations.Start("Loading forwarding...", timeout)
+        targets, err := mailbox.Forwarding(ctx)
+        done()
+        if err != nil {
+            slog.Error("Error loading forwarding", "error", err)
+            if !cancelled(ctx) {
+                dialog.ShowError(fmt.Errorf("Error loading forwarding: %v", err), window)
+            }
+            return
+        }
+
+        targetsEntry := widget.NewMultiLineEntry()
+        targetsEntry.SetPlaceHolder("teammate@example.com")
+        targetsEntry.SetText(strings.Join(targets, "\n"))
+        targetsEntry.SetMinRowsVisible(4)
+
+        content := container.NewVBox(
+            widget.NewLabel("Forward copy of each message of "+mailbox.Address()+" to (one address per line):"),
+            targetsEntry,
+            widget.NewLabel("Leave empty to stop forwarding. Forwarding is removed with the mailbox."),
+        )
+
+        dialog.ShowCustomConfirm("Forwarding", "Save", "Cancel", content, func(save bool) {
+            if !save {
+                return
+            }
+            newTargets := parseTargets(targetsEntry.Text)
+            go func() {
+                ctx, done := operations.Start("Saving forwarding...", timeout)
+                defer done()
+
+                if err := mailbox.SetForwarding(ctx, newTargets); err != nil {
+                    slog.Error("Error saving forwarding", "error", err)
+                    if !cancelled(ctx) {
+                        dialog.ShowError(fmt.Errorf("Error saving forwarding: %v", err), window)
+                    }
+                    return
+                }
+                if len(newTargets) == 0 {
+                    dialog.ShowInformation("Success", "Forwarding turned off", window)
+                    return
+                }
+                dialog.ShowInformation("Success", "Mail is forwarded to "+strings.Join(newTargets, ", "), window)
+            }()
+        }, window)
+    }()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "encoding/json"
+    "log/slog"
+    "os"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// File of mailbox journal in data directory
+const mailboxJournalFile = "mailbox_journal.json"
+
+// Journal entry of mailbox created by application
+type journalEntry struct {
+    Address         string
+    Created         time.Time
+    Deleted         *time.Time `json:",omitempty"`
+    PasswordChanged *time.Time `json:",omitempty"`
+    ForwardsTo      []string   `json:",omitempty"` // Recipients of alias the mailbox was converted into
+}
+
+// Persistent record of mailboxes created by application, so admin panel
+// can tell them from other users of the domain
+type mailboxJournal struct {
+    mu      sync.Mutex
+    path    string
+    entries []*journalEntry
+}
+
+// Load journal from file, missing file means empty journal
+func newMailboxJournal(path string) *mailboxJournal {
+    j := &mailboxJournal{path: path}
+
+    data, err := os.ReadFile(path)
+    if err == nil {
+        if err := json.Unmarshal(data, &j.entries); err != nil {
+            slog.Error("Error reading mailbox journal", "error", err)
+        }
+    } else if !os.IsNotExist(err) {
+        slog.Error("Error reading mailbox journal", "error", err)
+    }
+
+    return j
+}
+
+// Record creation and deletion of mailboxes from event
+func (j *mailboxJournal) Record(event MailEvent) {
+    switch event.Type {
+    case EventMailboxCreated:
+        j.update(func() {
+            j.entries = append(j.entries, &journalEntry{Address: event.Mailbox, Created: event.Timestamp})
+        })
+    case EventMailboxDeleted:
+        j.updateEntry(event.Mailbox, func(entry *journalEntry) {
+            deleted := event.Timestamp
+            entry.Deleted = &deleted
+        })
+    }
+}
+
+// Record password change of mailbox
+func (j *mailboxJournal) PasswordChanged(address string) {
+    j.updateEntry(address, func(entry *journalEntry) {
+        now := time.Now()
+        entry.PasswordChanged = &now
+    })
+}
+
+// Record conversion of mailbox into alias
+func (j *mailboxJournal) Converted(address string, forwardsTo []string) {
+    j.updateEntry(address, func(entry *journalEntry) {
+        now := time.Now()
+        entry.Deleted = &now
+        entry.ForwardsTo = forwardsTo
+    })
+}
+
+// Find latest entry of address
+func (j *mailboxJournal) Find(address string) (journalEntry, bool) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    if entry := j.findLocked(address); entry != nil {
+        return *entry, true
+    }
+    return journalEntry{}, false
+}
+
+// Entries returns copy of journal, newest first
+func (j *mailboxJournal) Entries() []journalEntry {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    entries := make([]journalEntry, len(j.entries))
+    for i, entry := range j.entries {
+        entries[i] = *entry
+    }
+    sort.SliceStable(entries, func(a, b int) bool {
+        return entries[a].Created.After(entries[b].Created)
+    })
+    return entries
+}
+
+// Return latest entry of address, caller must hold the lock
+func (j *mailboxJournal) findLocked(address string) *journalEntry {
+    for i := len(j.entries) - 1; i >= 0; i-- {
+        if strings.EqualFold(j.entries[i].Address, address) {
+            return j.entries[i]
+        }
+    }
+    return nil
+}
+
+// Change latest entry of address, addresses not in journal are ignored
+func (j *mailboxJournal) updateEntry(address string, change func(*journalEntry)) {
+    j.update(func() {
+        if entry := j.findLocked(address); entry != nil {
+            change(entry)
+        }
+    })
+}
+
+// Apply change under lock and save journal
+func (j *mailboxJournal) update(change func()) {
+    j.mu.Lock()
+    defer j.mu.Unlock()
+    change()
+
+    data, err := json.MarshalIndent(j.entries, "", "    ")
+    if err != nil {
+        slog.Error("Error serializing mailbox journal", "error", err)
+        return
+    }
+    tmpPath := j.path + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+        slog.Error("Error saving mailbox journal", "error", err)
+        return
+    }
+    if err := os.Rename(tmpPath, j.path); err != nil {
+        slog.Error("Error saving mailbox journal", "error", err)
+    }
+}
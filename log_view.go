@@ -0,0 +1,200 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "os"
+    "sort"
+    "strings"
+    "time"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Maximum size of end of log file shown in log window
+const logViewBytes = 1024 * 1024
+
+// Levels selectable in log window, each shows records of its level and
+// above
+var logViewLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Record of log file prepared for display
+type logLine struct {
+    Level slog.Level
+    Text  string
+}
+
+// Parse JSON record written by slog. Lines of older plain text logs are
+// shown as they are at info level
+func parseLogLine(line string) logLine {
+    var record map[string]any
+    if err := json.Unmarshal([]byte(line), &record); err != nil {
+        return logLine{Level: slog.LevelInfo, Text: line}
+    }
+
+    var parsed logLine
+    if level, ok := record["level"].(string); ok {
+        parsed.Level.UnmarshalText([]byte(level))
+    }
+    text := ""
+    if value, ok := record["time"].(string); ok {
+        if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+            text = t.Local().Format("2006-01-02 15:04:05") + " "
+        }
+    }
+    text += fmt.Sprintf("%-5s %v", parsed.Level, record["msg"])
+
+    var keys []string
+    for key := range record {
+        if key != "time" && key != "level" && key != "msg" {
+            keys = append(keys, key)
+        }
+    }
+    sort.Strings(keys)
+    for _, key := range keys {
+        value, _ := json.Marshal(record[key])
+        text += fmt.Sprintf(" %s=%s", key, value)
+    }
+    parsed.Text = text
+    return parsed
+}
+
+// Read last records of log file, at most logViewBytes
+func readLogTail(path string) ([]logLine, error) {
+    file, err := os.Open(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("error opening log: %w", err)
+    }
+    defer file.Close()
+
+    info, err := file.Stat()
+    if err != nil {
+        return nil, fmt.Errorf("error reading log: %w", err)
+    }
+    skipFirst := false
+    if info.Size() > logViewBytes {
+        if _, err := file.Seek(info.Size()-logViewBytes, io.SeekStart); err != nil {
+            return nil, fmt.Errorf("error reading log: %w", err)
+        }
+        // First line is cut in the middle
+        skipFirst = true
+    }
+    data, err := io.ReadAll(file)
+    if err != nil {
+        return nil, fmt.Errorf("error reading log: %w", err)
+    }
+
+    var lines []logLine
+    for i, line := range strings.Split(string(data), "\n") {
+        if (i == 0 && skipFirst) || strings.TrimSpace(line) == "" {
+            continue
+        }
+        lines = append(lines, parseLogLine(line))
+    }
+    return lines, nil
+}
+
+// Show window with end of log file filtered by level and text, newest
+// first. Debug check switches logging of message content
+func showLogWindow(myApp fyne.App, path string, debug bool, onDebugChange func(bool) error) {
+    window := myApp.NewWindow("Log")
+
+    var lines, shown []logLine
+    linesList := widget.NewList(
+        func() int {
+            return len(shown)
+        },
+        func() fyne.CanvasObject {
+            label := widget.NewLabel("")
+            label.Truncation = fyne.TextTruncateEllipsis
+            return label
+        },
+        func(id widget.ListItemID, item fyne.CanvasObject) {
+            item.(*widget.Label).SetText(shown[id].Text)
+        },
+    )
+    // Show whole record, long ones are cut in the list
+    linesList.OnSelected = func(id widget.ListItemID) {
+        text := widget.NewLabel(shown[id].Text)
+        text.Wrapping = fyne.TextWrapWord
+        recordDialog := dialog.NewCustom("Log record", "Close", container.NewVScroll(text), window)
+        recordDialog.Resize(fyne.NewSize(600, 300))
+        recordDialog.Show()
+        linesList.UnselectAll()
+    }
+    summaryLabel := widget.NewLabel("")
+    filterEntry := widget.NewEntry()
+    filterEntry.SetPlaceHolder("Filter")
+    levelSelect := widget.NewSelect(logViewLevels, nil)
+
+    show := func() {
+        var minLevel slog.Level
+        minLevel.UnmarshalText([]byte(levelSelect.Selected))
+        query := strings.ToLower(strings.TrimSpace(filterEntry.Text))
+        shown = nil
+        for i := len(lines) - 1; i >= 0; i-- {
+            line := lines[i]
+            if line.Level >= minLevel && (query == "" || strings.Contains(strings.ToLower(line.Text), query)) {
+                shown = append(shown, line)
+            }
+        }
+        linesList.Refresh()
+        summaryLabel.SetText(fmt.Sprintf("%d of %d records in %s", len(shown), len(lines), path))
+    }
+    filterEntry.OnChanged = func(string) {
+        show()
+    }
+    levelSelect.OnChanged = func(string) {
+        show()
+    }
+
+    refresh := func() {
+        var err error
+        lines, err = readLogTail(path)
+        if err != nil {
+            dialog.ShowError(fmt.Errorf("Error reading log: %v", err), window)
+        }
+        show()
+    }
+
+    debugCheck := widget.NewCheck("Debug logging, writes message content", nil)
+    debugCheck.SetChecked(debug)
+    var onChecked func(bool)
+    onChecked = func(checked bool) {
+        if err := onDebugChange(checked); err != nil {
+            dialog.ShowError(err, window)
+            // Restore state without saving again
+            debugCheck.OnChanged = nil
+            debugCheck.SetChecked(!checked)
+            debugCheck.OnChanged = onChecked
+        }
+    }
+    debugCheck.OnChanged = onChecked
+
+    levelSelect.SetSelected("INFO")
+    window.SetContent(container.NewBorder(
+        container.NewVBox(
+            container.NewHBox(widget.NewButton("Refresh", refresh), debugCheck, layout.NewSpacer(), widget.NewLabel("Level:"), levelSelect),
+            filterEntry,
+            summaryLabel,
+        ),
+        nil,
+        nil,
+        nil,
+        linesList,
+    ))
+    refresh()
+
+    window.Resize(fyne.NewSize(800, 600))
+    window.Show()
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "log/slog"
+    "os"
+    "regexp"
+    "strings"
+    "sync"
+    "sync/atomic"
+)
+
+// Size of tempmail.log when it is rotated and number of old files kept as
+// tempmail.log.1 (newest) to tempmail.log.3
+const (
+    maxLogSize = 5 * 1024 * 1024
+    logBackups = 3
+)
+
+// Text replacing redacted values
+const redacted = "[REDACTED]"
+
+// Attribute keys whose values are never written
+var secretLogKeys = map[string]bool{
+    "password":      true,
+    "secret":        true,
+    "token":         true,
+    "totp":          true,
+    "authorization": true,
+    "session":       true,
+}
+
+// Attribute keys with message data written only with debug logging
+var contentLogKeys = map[string]bool{
+    "content": true,
+    "body":    true,
+    "html":    true,
+    "raw":     true,
+    "subject": true,
+    "from":    true,
+    "to":      true,
+    "code":    true,
+}
+
+// Secrets inside free-form log text, such as token query parameters of
+// webhook URLs or bearer tokens
+var secretLogText = regexp.MustCompile(`(?i)\b(password|passwd|token|secret|totp|api_?key)=("[^"]*"|[^\s&"]+)|\b(bearer)\s+\S+`)
+
+// Replace secrets in free-form text
+func redactText(text string) string {
+    return secretLogText.ReplaceAllStringFunc(text, func(match string) string {
+        if key, _, ok := strings.Cut(match, "="); ok {
+            return key + "=" + redacted
+        }
+        key, _, _ := strings.Cut(match, " ")
+        return key + " " + redacted
+    })
+}
+
+// Handler hiding secrets and, unless debug logging is on, message content
+// before records reach the file
+type redactHandler struct {
+    next        slog.Handler
+    showContent *atomic.Bool
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+    return h.next.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+    clean := slog.NewRecord(record.Time, record.Level, redactText(record.Message), record.PC)
+    record.Attrs(func(attr slog.Attr) bool {
+        clean.AddAttrs(h.redact(attr))
+        return true
+    })
+    return h.next.Handle(ctx, clean)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+    clean := make([]slog.Attr, 0, len(attrs))
+    for _, attr := range attrs {
+        clean = append(clean, h.redact(attr))
+    }
+    return &redactHandler{next: h.next.WithAttrs(clean), showContent: h.showContent}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+    return &redactHandler{next: h.next.WithGroup(name), showContent: h.showContent}
+}
+
+// Return attribute with secret or content value replaced
+func (h *redactHandler) redact(attr slog.Attr) slog.Attr {
+    key := strings.ToLower(attr.Key)
+    value := attr.Value.Resolve()
+    switch {
+    case value.Kind() == slog.KindGroup:
+        var group []any
+        for _, member := range value.Group() {
+            group = append(group, h.redact(member))
+        }
+        return slog.Group(attr.Key, group...)
+    case secretLogKeys[key]:
+        return slog.String(attr.Key, redacted)
+    case contentLogKeys[key] && !h.showContent.Load():
+        return slog.String(attr.Key, redacted)
+    case value.Kind() == slog.KindString:
+        return slog.String(attr.Key, redactText(value.String()))
+    case value.Kind() == slog.KindAny:
+        // Errors carry server responses which may include secrets
+        switch v := value.Any().(type) {
+        case error:
+            return slog.String(attr.Key, redactText(v.Error()))
+        case fmt.Stringer:
+            return slog.String(attr.Key, redactText(v.String()))
+        }
+    }
+    return slog.Attr{Key: attr.Key, Value: value}
+}
+
+// Log file rotated when it grows over size limit
+type rotatingFile struct {
+    mu      sync.Mutex
+    path    string
+    maxSize int64
+    backups int
+    file    *os.File
+    size    int64
+}
+
+// Open log file for appending, readable only by the user. Permissions of
+// file created by older versions are tightened too
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+    r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+    if err := r.open(); err != nil {
+        return nil, err
+    }
+    return r, nil
+}
+
+func (r *rotatingFile) open() error {
+    file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+    if err != nil {
+        return fmt.Errorf("error opening log file: %w", err)
+    }
+    os.Chmod(r.path, 0600)
+    info, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return fmt.Errorf("error reading log file: %w", err)
+    }
+    r.file = file
+    r.size = info.Size()
+    return nil
+}
+
+// Move current file to .1, older files one number up, and start new file
+func (r *rotatingFile) rotate() error {
+    r.file.Close()
+    for i := r.backups - 1; i >= 1; i-- {
+        os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+    }
+    if r.backups > 0 {
+        os.Rename(r.path, r.path+".1")
+    } else {
+        os.Remove(r.path)
+    }
+    return r.open()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if r.file == nil {
+        return 0, os.ErrClosed
+    }
+    if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+        // Logging can't log its own failure, report it to stderr
+        if err := r.rotate(); err != nil {
+            fmt.Fprintf(os.Stderr, "Error rotating log: %v\n", err)
+            return 0, err
+        }
+    }
+    n, err := r.file.Write(p)
+    r.size += int64(n)
+    return n, err
+}
+
+// Writer passing output of log package to slog. Messages starting with
+// "Error" are logged as errors, others as info
+type logBridge struct {
+    logger *slog.Logger
+}
+
+func (b logBridge) Write(p []byte) (int, error) {
+    message := strings.TrimSpace(string(p))
+    level := slog.LevelInfo
+    if strings.HasPrefix(message, "Error") {
+        level = slog.LevelError
+    }
+    b.logger.Log(context.Background(), level, message)
+    return len(p), nil
+}
+
+// Application logging, JSON lines in rotated tempmail.log
+type appLogging struct {
+    level       *slog.LevelVar
+    showContent *atomic.Bool
+}
+
+// Set up slog and log package to write to log file at path, falling back
+// to stderr when it can't be opened. Debug logging also writes message
+// content
+func setupLogging(path string, debug bool) *appLogging {
+    logging := &appLogging{level: new(slog.LevelVar), showContent: new(atomic.Bool)}
+    logging.SetDebug(debug)
+
+    var handler slog.Handler
+    file, err := openRotatingFile(path, maxLogSize, logBackups)
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        handler = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logging.level})
+    } else {
+        handler = slog.NewJSONHandler(file, &slog.HandlerOptions{Level: logging.level})
+    }
+    logger := slog.New(&redactHandler{next: handler, showContent: logging.showContent})
+
+    // SetDefault routes log package to slog at info level, bridge replaces
+    // that to keep level of error messages
+    slog.SetDefault(logger)
+    log.SetFlags(0)
+    log.SetOutput(logBridge{logger: logger})
+    return logging
+}
+
+// SetDebug switches debug level and logging of message content
+func (l *appLogging) SetDebug(debug bool) {
+    if debug {
+        l.level.Set(slog.LevelDebug)
+    } else {
+        l.level.Set(slog.LevelInfo)
+    }
+    l.showContent.Store(debug)
+}
@@ -0,0 +1,639 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "mime"
+    "net/http"
+    "net/mail"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Maximum length of message snippet in Mailpit message list
+const mailpitSnippetLength = 250
+
+// MailAPI emulates MailHog (/api/v1, /api/v2) and Mailpit (/api/v1) HTTP
+// APIs on top of messages of current temporary mailbox, so test suites
+// written against those tools can run against real delivery.
+//
+// Both tools share /api/v1/messages. Listing there uses Mailpit format,
+// deleting accepts Mailpit body with IDs and deletes all messages
+// otherwise, which is also what MailHog does
+type MailAPI struct {
+    mailbox func() *tempmail.TempMailbox
+    audit   *auditLog
+    actor   string // Actor of deletions recorded in audit log
+}
+
+// NewMailAPI creates API serving messages of mailbox returned by provider
+func NewMailAPI(mailbox func() *tempmail.TempMailbox, audit *auditLog, actor string) *MailAPI {
+    return &MailAPI{mailbox: mailbox, audit: audit, actor: actor}
+}
+
+// Register adds API routes to mux
+func (api *MailAPI) Register(mux *http.ServeMux) {
+    // MailHog v2
+    mux.HandleFunc("/api/v2/messages", api.mailhogMessages)
+    mux.HandleFunc("/api/v2/search", api.mailhogSearch)
+
+    // MailHog v1 single message routes
+    mux.HandleFunc("/api/v1/messages/", api.mailhogMessage)
+
+    // Mailpit v1, DELETE also serves MailHog v1
+    mux.HandleFunc("/api/v1/messages", api.mailpitMessages)
+    mux.HandleFunc("/api/v1/search", api.mailpitSearch)
+    mux.HandleFunc("/api/v1/message/", api.mailpitMessage)
+}
+
+// Parsed headers of message which are not part of Email
+type apiHeaders struct {
+    To      []*mail.Address
+    Cc      []*mail.Address
+    Bcc     []*mail.Address
+    ReplyTo []*mail.Address
+    Header  mail.Header
+    Body    []byte
+}
+
+// Parse address list headers and body from raw message source
+func parseAPIHeaders(raw []byte) apiHeaders {
+    var headers apiHeaders
+    m, err := mail.ReadMessage(bytes.NewReader(raw))
+    if err != nil {
+        return headers
+    }
+
+    parser := mail.AddressParser{WordDecoder: &mime.WordDecoder{}}
+    list := func(name string) []*mail.Address {
+        if m.Header.Get(name) == "" {
+            return nil
+        }
+        addresses, err := parser.ParseList(m.Header.Get(name))
+        if err != nil {
+            return nil
+        }
+        return addresses
+    }
+
+    headers.To = list("To")
+    headers.Cc = list("Cc")
+    headers.Bcc = list("Bcc")
+    headers.ReplyTo = list("Reply-To")
+    headers.Header = m.Header
+    headers.Body = raw[len(raw)-bodyLength(raw):]
+    return headers
+}
+
+// Return length of message body in raw source
+func bodyLength(raw []byte) int {
+    if idx := bytes.Index(raw, []byte("\r\n\r\n")); idx >= 0 {
+        return len(raw) - idx - 4
+    }
+    if idx := bytes.Index(raw, []byte("\n\n")); idx >= 0 {
+        return len(raw) - idx - 2
+    }
+    return 0
+}
+
+// Return messages of current mailbox
+func (api *MailAPI) messages(ctx context.Context) ([]tempmail.Email, error) {
+    mailbox := api.mailbox()
+    if mailbox == nil {
+        return nil, fmt.Errorf("no mailbox is active")
+    }
+    return mailbox.CheckMail(ctx)
+}
+
+// Find message by string ID (message UID)
+func (api *MailAPI) message(ctx context.Context, id string) (*tempmail.Email, error) {
+    uid, err := strconv.ParseUint(id, 10, 32)
+    if err != nil {
+        return nil, nil
+    }
+    emails, err := api.messages(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for i := range emails {
+        if emails[i].UID == uint32(uid) {
+            return &emails[i], nil
+        }
+    }
+    return nil, nil
+}
+
+// Delete messages by string IDs, all messages when ids is empty
+func (api *MailAPI) delete(ctx context.Context, ids []string) error {
+    mailbox := api.mailbox()
+    if mailbox == nil {
+        return fmt.Errorf("no mailbox is active")
+    }
+
+    if len(ids) == 0 {
+        moved, _, err := mailbox.DeleteAllMails(ctx)
+        api.audit.RecordResult(api.actor, AuditMessageDeleteAll, mailbox.Address(), err,
+            fmt.Sprintf("%d messages moved to trash", moved))
+        return err
+    }
+    for _, id := range ids {
+        uid, err := strconv.ParseUint(id, 10, 32)
+        if err != nil {
+            return fmt.Errorf("invalid message ID %q", id)
+        }
+        _, err = mailbox.DeleteMail(ctx, uint32(uid))
+        api.audit.RecordResult(api.actor, AuditMessageDelete, mailbox.Address(), err, fmt.Sprintf("UID %d", uid))
+        if err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Return start and limit query parameters with defaults
+func pageParams(r *http.Request) (int, int) {
+    start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+    if start < 0 {
+        start = 0
+    }
+    limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+    if err != nil || limit <= 0 {
+        limit = 50
+    }
+    return start, limit
+}
+
+// Return page of messages
+func paginate(emails []tempmail.Email, start, limit int) []tempmail.Email {
+    if start >= len(emails) {
+        return []tempmail.Email{}
+    }
+    end := start + limit
+    if end > len(emails) {
+        end = len(emails)
+    }
+    return emails[start:end]
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    if err := json.NewEncoder(w).Encode(value); err != nil {
+        slog.Error("Error writing API response", "error", err)
+    }
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+    slog.Error("Error serving API request", "error", err)
+    http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+// MailHog path of address
+type mailhogPath struct {
+    Relays  []string
+    Mailbox string
+    Domain  string
+    Params  string
+}
+
+func newMailhogPath(address string) *mailhogPath {
+    mailbox, domain := address, ""
+    if at := strings.LastIndex(address, "@"); at >= 0 {
+        mailbox, domain = address[:at], address[at+1:]
+    }
+    return &mailhogPath{Mailbox: mailbox, Domain: domain}
+}
+
+type mailhogContent struct {
+    Headers map[string][]string
+    Body    string
+    Size    int
+    MIME    interface{}
+}
+
+type mailhogRaw struct {
+    From string
+    To   []string
+    Data string
+    Helo string
+}
+
+type mailhogMessage struct {
+    ID      string
+    From    *mailhogPath
+    To      []*mailhogPath
+    Content mailhogContent
+    Created time.Time
+    MIME    interface{}
+    Raw     mailhogRaw
+}
+
+type mailhogMessages struct {
+    Total int              `json:"total"`
+    Count int              `json:"count"`
+    Start int              `json:"start"`
+    Items []mailhogMessage `json:"items"`
+}
+
+// Convert email to MailHog message
+func toMailhogMessage(email tempmail.Email) mailhogMessage {
+    headers := parseAPIHeaders(email.Raw)
+
+    var to []*mailhogPath
+    var rawTo []string
+    for _, list := range [][]*mail.Address{headers.To, headers.Cc, headers.Bcc} {
+        for _, addr := range list {
+            to = append(to, newMailhogPath(addr.Address))
+            rawTo = append(rawTo, addr.Address)
+        }
+    }
+
+    return mailhogMessage{
+        ID:   strconv.FormatUint(uint64(email.UID), 10),
+        From: newMailhogPath(email.FromAddress),
+        To:   to,
+        Content: mailhogContent{
+            Headers: headers.Header,
+            Body:    string(headers.Body),
+            Size:    len(email.Raw),
+        },
+        Created: email.Date,
+        Raw: mailhogRaw{
+            From: email.FromAddress,
+            To:   rawTo,
+            Data: string(email.Raw),
+        },
+    }
+}
+
+func writeMailhogMessages(w http.ResponseWriter, r *http.Request, emails []tempmail.Email) {
+    start, limit := pageParams(r)
+    page := paginate(emails, start, limit)
+
+    result := mailhogMessages{
+        Total: len(emails),
+        Count: len(page),
+        Start: start,
+        Items: make([]mailhogMessage, len(page)),
+    }
+    for i, email := range page {
+        result.Items[i] = toMailhogMessage(email)
+    }
+    writeJSON(w, result)
+}
+
+// GET /api/v2/messages
+func (api *MailAPI) mailhogMessages(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    emails, err := api.messages(r.Context())
+    if err != nil {
+        writeAPIError(w, err)
+        return
+    }
+    writeMailhogMessages(w, r, emails)
+}
+
+// GET /api/v2/search?kind=from|to|containing&query=...
+func (api *MailAPI) mailhogSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    kind := r.URL.Query().Get("kind")
+    query := strings.ToLower(r.URL.Query().Get("query"))
+    if kind != "from" && kind != "to" && kind != "containing" {
+        http.Error(w, "kind must be from, to or containing", http.StatusBadRequest)
+        return
+    }
+
+    emails, err := api.messages(r.Context())
+    if err != nil {
+        writeAPIError(w, err)
+        return
+    }
+
+    var found []tempmail.Email
+    for _, email := range emails {
+        var text string
+        switch kind {
+        case "from":
+            text = email.FromAddress + " " + email.From
+        case "to":
+            headers := parseAPIHeaders(email.Raw)
+            text = headers.Header.Get("To") + " " + headers.Header.Get("Cc")
+        case "containing":
+            text = string(email.Raw) + " " + email.Content
+        }
+        if strings.Contains(strings.ToLower(text), query) {
+            found = append(found, email)
+        }
+    }
+    writeMailhogMessages(w, r, found)
+}
+
+// GET|DELETE /api/v1/messages/{id}, GET /api/v1/messages/{id}/download
+func (api *MailAPI) mailhogMessage(w http.ResponseWriter, r *http.Request) {
+    path := strings.TrimPrefix(r.URL.Path, "/api/v1/messages/")
+    id, action, _ := strings.Cut(path, "/")
+    if id == "" {
+        api.mailpitMessages(w, r)
+        return
+    }
+
+    if r.Method == http.MethodDelete && action == "" {
+        if err := api.delete(r.Context(), []string{id}); err != nil {
+            writeAPIError(w, err)
+            return
+        }
+        w.WriteHeader(http.StatusOK)
+        return
+    }
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    email, err := api.message(r.Context(), id)
+    if err != nil {
+        writeAPIError(w, err)
+        return
+    }
+    if email == nil {
+        http.NotFound(w, r)
+        return
+    }
+
+    switch action {
+    case "":
+        writeJSON(w, toMailhogMessage(*email))
+    case "download":
+        w.Header().Set("Content-Type", "message/rfc822")
+        w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.eml\"", id))
+        w.Write(email.Raw)
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+// Mailpit address
+type mailpitAddress struct {
+    Name    string
+    Address string
+}
+
+func toMailpitAddresses(list []*mail.Address) []mailpitAddress {
+    addresses := make([]mailpitAddress, len(list))
+    for i, addr := range list {
+        addresses[i] = mailpitAddress{Name: addr.Name, Address: addr.Address}
+    }
+    return addresses
+}
+
+type mailpitSummary struct {
+    ID          string
+    MessageID   string
+    Read        bool
+    From        *mailpitAddress
+    To          []mailpitAddress
+    Cc          []mailpitAddress
+    Bcc         []mailpitAddress
+    ReplyTo     []mailpitAddress
+    Subject     string
+    Created     time.Time
+    Tags        []string
+    Size        int
+    Attachments int
+    Snippet     string
+}
+
+type mailpitMessagesResult struct {
+    Total         int              `json:"total"`
+    Unread        int              `json:"unread"`
+    Count         int              `json:"count"`
+    MessagesCount int              `json:"messages_count"`
+    Start         int              `json:"start"`
+    Tags          []string         `json:"tags"`
+    Messages      []mailpitSummary `json:"messages"`
+}
+
+type mailpitMessage struct {
+    ID          string
+    MessageID   string
+    From        *mailpitAddress
+    To          []mailpitAddress
+    Cc          []mailpitAddress
+    Bcc         []mailpitAddress
+    ReplyTo     []mailpitAddress
+    ReturnPath  string
+    Subject     string
+    Date        time.Time
+    Tags        []string
+    Text        string
+    HTML        string
+    Size        int
+    Inline      []interface{}
+    Attachments []interface{}
+}
+
+// Convert email to Mailpit message summary
+func toMailpitSummary(email tempmail.Email) mailpitSummary {
+    headers := parseAPIHeaders(email.Raw)
+
+    snippet := strings.Join(strings.Fields(email.Content), " ")
+    if runes := []rune(snippet); len(runes) > mailpitSnippetLength {
+        snippet = string(runes[:mailpitSnippetLength]) + "..."
+    }
+
+    return mailpitSummary{
+        ID:        strconv.FormatUint(uint64(email.UID), 10),
+        MessageID: email.MessageID,
+        Read:      email.Seen,
+        From:      &mailpitAddress{Name: email.From, Address: email.FromAddress},
+        To:        toMailpitAddresses(headers.To),
+        Cc:        toMailpitAddresses(headers.Cc),
+        Bcc:       toMailpitAddresses(headers.Bcc),
+        ReplyTo:   toMailpitAddresses(headers.ReplyTo),
+        Subject:   email.Subject,
+        Created:   email.Date,
+        Tags:      []string{},
+        Size:      len(email.Raw),
+        Snippet:   snippet,
+    }
+}
+
+// Check whether email matches Mailpit search query. Supported terms are
+// from:, to:, subject:, is:read, is:unread and free text; all terms must match
+func matchMailpitQuery(email tempmail.Email, query string) bool {
+    headers := parseAPIHeaders(email.Raw)
+    lower := func(s string) string { return strings.ToLower(s) }
+
+    for _, term := range strings.Fields(lower(query)) {
+        term = strings.Trim(term, `"`)
+        key, value, hasKey := strings.Cut(term, ":")
+        if !hasKey {
+            key, value = "", term
+        }
+
+        var ok bool
+        switch key {
+        case "from":
+            ok = strings.Contains(lower(email.FromAddress+" "+email.From), value)
+        case "to":
+            ok = strings.Contains(lower(headers.Header.Get("To")+" "+headers.Header.Get("Cc")), value)
+        case "subject":
+            ok = strings.Contains(lower(email.Subject), value)
+        case "is":
+            ok = (value == "read" && email.Seen) || (value == "unread" && !email.Seen)
+        default:
+            ok = strings.Contains(lower(email.Subject+" "+email.Content+" "+email.FromAddress), term)
+        }
+        if !ok {
+            return false
+        }
+    }
+    return true
+}
+
+func writeMailpitMessages(w http.ResponseWriter, r *http.Request, total int, emails []tempmail.Email) {
+    start, limit := pageParams(r)
+    page := paginate(emails, start, limit)
+
+    result := mailpitMessagesResult{
+        Total:         total,
+        Count:         len(page),
+        MessagesCount: len(emails),
+        Start:         start,
+        Tags:          []string{},
+        Messages:      make([]mailpitSummary, len(page)),
+    }
+    for _, email := range emails {
+        if !email.Seen {
+            result.Unread++
+        }
+    }
+    for i, email := range page {
+        result.Messages[i] = toMailpitSummary(email)
+    }
+    writeJSON(w, result)
+}
+
+// GET /api/v1/messages, DELETE /api/v1/messages
+func (api *MailAPI) mailpitMessages(w http.ResponseWriter, r *http.Request) {
+    switch r.Method {
+    case http.MethodGet:
+        emails, err := api.messages(r.Context())
+        if err != nil {
+            writeAPIError(w, err)
+            return
+        }
+        writeMailpitMessages(w, r, len(emails), emails)
+    case http.MethodDelete:
+        var request struct {
+            IDs []string
+        }
+        if r.ContentLength != 0 {
+            if err := json.NewDecoder(r.Body).Decode(&request); err != nil && r.ContentLength > 0 {
+                http.Error(w, "invalid request body", http.StatusBadRequest)
+                return
+            }
+        }
+        if err := api.delete(r.Context(), request.IDs); err != nil {
+            writeAPIError(w, err)
+            return
+        }
+        w.Header().Set("Content-Type", "text/plain")
+        fmt.Fprint(w, "ok")
+    default:
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+    }
+}
+
+// GET /api/v1/search?query=...
+func (api *MailAPI) mailpitSearch(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    emails, err := api.messages(r.Context())
+    if err != nil {
+        writeAPIError(w, err)
+        return
+    }
+
+    query := r.URL.Query().Get("query")
+    var found []tempmail.Email
+    for _, email := range emails {
+        if matchMailpitQuery(email, query) {
+            found = append(found, email)
+        }
+    }
+    writeMailpitMessages(w, r, len(emails), found)
+}
+
+// GET /api/v1/message/{id}, GET /api/v1/message/{id}/raw
+func (api *MailAPI) mailpitMessage(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+
+    path := strings.TrimPrefix(r.URL.Path, "/api/v1/message/")
+    id, action, _ := strings.Cut(path, "/")
+
+    var email *tempmail.Email
+    var err error
+    if id == "latest" {
+        var emails []tempmail.Email
+        emails, err = api.messages(r.Context())
+        if err == nil && len(emails) > 0 {
+            email = &emails[0]
+        }
+    } else {
+        email, err = api.message(r.Context(), id)
+    }
+    if err != nil {
+        writeAPIError(w, err)
+        return
+    }
+    if email == nil {
+        http.NotFound(w, r)
+        return
+    }
+
+    switch action {
+    case "":
+        summary := toMailpitSummary(*email)
+        headers := parseAPIHeaders(email.Raw)
+        writeJSON(w, mailpitMessage{
+            ID:          summary.ID,
+            MessageID:   summary.MessageID,
+            From:        summary.From,
+            To:          summary.To,
+            Cc:          summary.Cc,
+            Bcc:         summary.Bcc,
+            ReplyTo:     summary.ReplyTo,
+            ReturnPath:  strings.Trim(headers.Header.Get("Return-Path"), "<>"),
+            Subject:     email.Subject,
+            Date:        email.Date,
+            Tags:        []string{},
+            Text:        email.Content,
+            HTML:        email.HTMLContent,
+            Size:        len(email.Raw),
+            Inline:      []interface{}{},
+            Attachments: []interface{}{},
+        })
+    case "raw":
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.Write(email.Raw)
+    default:
+        http.NotFound(w, r)
+    }
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+    "bytes"
+    "crypto/tls"
+    "encoding/json"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "github.com/emersion/go-imap"
+    "github.com/emersion/go-imap/backend"
+    "github.com/emersion/go-imap/backend/memory"
+    "github.com/emersion/go-imap/server"
+)
+
+// Message added to INBOX of stand-in next to its sample message with UID 6
+const testMessage = "From: Shop <shop@example.org>\r\n" +
+    "To: Test <test@example.com>\r\n" +
+    "Cc: copy@example.com\r\n" +
+    "Subject: Confirm your order\r\n" +
+    "Date: Mon, 12 Oct 2026 10:00:00 +0000\r\n" +
+    "Message-ID: <order@example.org>\r\n" +
+    "Content-Type: text/plain\r\n" +
+    "\r\n" +
+    "Your code is 123456\r\n"
+
+// In-memory IMAP backend accepting any credentials as its sample user
+type testBackend struct {
+    *memory.Backend
+}
+
+func (b testBackend) Login(info *imap.ConnInfo, _, _ string) (backend.User, error) {
+    return b.Backend.Login(info, "username", "password")
+}
+
+// Start IMAP server over TLS with INBOX holding sample message of
+// go-imap memory backend and testMessage, return mailbox using it
+func startIMAP(t *testing.T) *tempmail.TempMailbox {
+    be := testBackend{memory.New()}
+    user, err := be.Login(nil, "", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    inbox, err := user.GetMailbox("INBOX")
+    if err != nil {
+        t.Fatal(err)
+    }
+    err = inbox.CreateMessage(nil, time.Now(), bytes.NewBufferString(testMessage))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Borrow self-signed certificate of httptest
+    certServer := httptest.NewTLSServer(http.NotFoundHandler())
+    certificates := certServer.TLS.Certificates
+    certServer.Close()
+
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := server.New(be)
+    s.ErrorLog = nopLogger{}
+    go s.Serve(tls.NewListener(listener, &tls.Config{Certificates: certificates}))
+    t.Cleanup(func() {
+        s.Close()
+    })
+
+    return &tempmail.TempMailbox{
+        Username:   "test",
+        Domain:     "example.com",
+        Password:   "secret",
+        ImapServer: listener.Addr().String(),
+    }
+}
+
+// Logger dropping errors of closed test connections
+type nopLogger struct{}
+
+func (nopLogger) Printf(string, ...interface{}) {}
+func (nopLogger) Println(...interface{})        {}
+
+// Start API server for mailbox, without token as test suites use it
+func startMailAPI(t *testing.T, mailbox *tempmail.TempMailbox) *httptest.Server {
+    mux := http.NewServeMux()
+    audit := newAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+    NewMailAPI(func() *tempmail.TempMailbox { return mailbox }, audit, apiActor("")).Register(mux)
+    server := httptest.NewServer(withServerAuth("", mux))
+    t.Cleanup(server.Close)
+    return server
+}
+
+// GET path and decode JSON response into value
+func getJSON(t *testing.T, server *httptest.Server, path string, value interface{}) {
+    t.Helper()
+    resp, err := http.Get(server.URL + path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        t.Fatalf("GET %s: %s", path, resp.Status)
+    }
+    if err := json.NewDecoder(resp.Body).Decode(value); err != nil {
+        t.Fatalf("GET %s: %v", path, err)
+    }
+}
+
+func TestMailhogMessages(t *testing.T) {
+    server := startMailAPI(t, startIMAP(t))
+
+    var list struct {
+        Total int `json:"total"`
+        Count int `json:"count"`
+        Start int `json:"start"`
+        Items []struct {
+            ID      string
+            From    struct{ Mailbox, Domain string }
+            To      []struct{ Mailbox, Domain string }
+            Content struct {
+                Headers map[string][]string
+                Body    string
+            }
+            Raw struct {
+                From string
+                To   []string
+                Data string
+            }
+        } `json:"items"`
+    }
+    getJSON(t, server, "/api/v2/messages", &list)
+    if list.Total != 2 || list.Count != 2 || len(list.Items) != 2 {
+        t.Fatalf("got total %d, count %d and %d items, want 2", list.Total, list.Count, len(list.Items))
+    }
+    // Newest message comes first
+    order := list.Items[0]
+    if order.ID != "7" || order.From.Mailbox != "shop" || order.From.Domain != "example.org" {
+        t.Errorf("got ID %s from %+v, want 7 from shop@example.org", order.ID, order.From)
+    }
+    if len(order.To) != 2 || order.To[0].Mailbox != "test" || order.To[1].Mailbox != "copy" {
+        t.Errorf("got recipients %+v, want test and copy", order.To)
+    }
+    if got := order.Content.Headers["Subject"]; len(got) != 1 || got[0] != "Confirm your order" {
+        t.Errorf("got Subject header %v", got)
+    }
+    if !strings.HasPrefix(order.Content.Body, "Your code is 123456") || order.Raw.Data != testMessage {
+        t.Errorf("got body %q and raw data %q", order.Content.Body, order.Raw.Data)
+    }
+
+    getJSON(t, server, "/api/v2/messages?start=1&limit=5", &list)
+    if list.Total != 2 || list.Count != 1 || list.Start != 1 || list.Items[0].ID != "6" {
+        t.Errorf("second page has total %d, count %d, start %d", list.Total, list.Count, list.Start)
+    }
+
+    getJSON(t, server, "/api/v2/search?kind=from&query=SHOP", &list)
+    if list.Total != 1 || list.Items[0].ID != "7" {
+        t.Errorf("search by sender found %d messages", list.Total)
+    }
+    getJSON(t, server, "/api/v2/search?kind=containing&query=123456", &list)
+    if list.Total != 1 {
+        t.Errorf("search by content found %d messages", list.Total)
+    }
+
+    resp, err := http.Get(server.URL + "/api/v1/messages/7/download")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "message/rfc822" {
+        t.Errorf("download: %s, %s", resp.Status, resp.Header.Get("Content-Type"))
+    }
+    resp, err = http.Get(server.URL + "/api/v1/messages/99")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusNotFound {
+        t.Errorf("missing message: %s, want 404", resp.Status)
+    }
+}
+
+func TestMailpitMessages(t *testing.T) {
+    server := startMailAPI(t, startIMAP(t))
+
+    type address struct{ Name, Address string }
+    var list struct {
+        Total         int      `json:"total"`
+        Unread        int      `json:"unread"`
+        Count         int      `json:"count"`
+        MessagesCount int      `json:"messages_count"`
+        Tags          []string `json:"tags"`
+        Messages      []struct {
+            ID        string
+            MessageID string
+            Read      bool
+            From      address
+            To        []address
+            Cc        []address
+            Subject   string
+            Snippet   string
+        } `json:"messages"`
+    }
+    getJSON(t, server, "/api/v1/messages", &list)
+    if list.Total != 2 || list.Count != 2 || list.Unread != 1 || list.Tags == nil {
+        t.Fatalf("got total %d, count %d, unread %d, tags %v", list.Total, list.Count, list.Unread, list.Tags)
+    }
+    order := list.Messages[0]
+    if order.ID != "7" || order.MessageID != "order@example.org" || order.Read {
+        t.Errorf("got ID %s, Message-ID %s, read %t", order.ID, order.MessageID, order.Read)
+    }
+    if order.From != (address{"Shop", "shop@example.org"}) || len(order.To) != 1 || order.To[0] != (address{"Test", "test@example.com"}) {
+        t.Errorf("got from %+v to %+v", order.From, order.To)
+    }
+    if len(order.Cc) != 1 || order.Cc[0].Address != "copy@example.com" {
+        t.Errorf("got cc %+v", order.Cc)
+    }
+    if order.Subject != "Confirm your order" || order.Snippet != "Your code is 123456" {
+        t.Errorf("got subject %q and snippet %q", order.Subject, order.Snippet)
+    }
+
+    getJSON(t, server, "/api/v1/search?query=from:shop+is:unread", &list)
+    if list.Total != 2 || list.MessagesCount != 1 || list.Messages[0].ID != "7" {
+        t.Errorf("search found %d of %d messages", list.MessagesCount, list.Total)
+    }
+    getJSON(t, server, "/api/v1/search?query=subject:invoice", &list)
+    if list.MessagesCount != 0 || list.Messages == nil {
+        t.Errorf("search found %d messages, want empty list", list.MessagesCount)
+    }
+
+    var message struct {
+        ID      string
+        Subject string
+        Text    string
+    }
+    getJSON(t, server, "/api/v1/message/7", &message)
+    if message.ID != "7" || message.Subject != "Confirm your order" || !strings.Contains(message.Text, "123456") {
+        t.Errorf("got message %+v", message)
+    }
+}
@@ -3,29 +3,22 @@ package main
 import (
     "context"
     "encoding/json"
+    "flag"
+    "errors"
     "fmt"
-    "io"
     "io/ioutil"
-    "log"
-    "math/rand"
-    "net/url"
+    "log/slog"
     "os"
+    "path/filepath"
+    "reflect"
+    "strconv"
     "strings"
+    "sync"
+    "sync/atomic"
     "time"
-    "crypto/tls"
-    "mime"
-    "mime/multipart"
-    "mime/quotedprintable"
-    "net/mail"
-    "bytes"
     "image/color"
-    "encoding/base64"
 
-    "github.com/emersion/go-imap"
-    "github.com/emersion/go-imap/client"
-    "github.com/nrdcg/mailinabox"
-    "golang.org/x/net/html"
-    "golang.org/x/text/encoding/charmap"
+    "github.com/AlestackOverglow/malinatemp/tempmail"
     "fyne.io/fyne/v2"
     "fyne.io/fyne/v2/app"
     "fyne.io/fyne/v2/container"
@@ -35,116 +28,203 @@ import (
     "fyne.io/fyne/v2/layout"
 )
 
-type TempMailbox struct {
-    Domain     string
-    Username   string
-    Password   string
-    ImapServer string
-    Client     *mailinabox.Client
+type Settings struct {
+    Profiles      []ServerProfile
+    ActiveProfile string // Name of profile used on startup
+    Webhooks      []WebhookConfig
+    Rules         []MailRule // Local rules run on new messages
+    ServerListen  string // Address of local HTTP server, disabled when empty
+    ServerToken   string // Bearer token required by local HTTP server, browser requests are refused without it
+
+    ConnectTimeout   int // Seconds to wait for IMAP and SMTP connection, default 15
+    OperationTimeout int // Seconds before user action is cancelled, default 120
+
+    Retry            tempmail.RetryPolicies // Retry policy of each kind of operation
+    BreakerThreshold int                    // Failed updates before polling is paused, default 5
+    BreakerCooldown  int                    // Seconds polling stays paused, default 60
+
+    UpdatePeriod         int  // Seconds between automatic updates, default 5
+    DisableAutoUpdate    bool // Check mail only with Update button
+    DisableNotifications bool // Don't notify about new messages
+
+    StatusCheckPeriod int // Minutes between server status checks, default 10, negative disables
+
+    QuotaWarnPercent int  // Percent of mailbox quota used when user is warned, default 80
+    QuotaAutoPurge   bool // Delete oldest messages instead of warning when quota fills up
+
+    MailboxRetention map[string]RetentionConfig `json:",omitempty"` // Retention of mailboxes by address, overriding profile
+
+    DebugLogging bool // Log debug messages including message content, secrets are still hidden
 }
 
-type Email struct {
-    From        string
-    Subject     string
-    Content     string
-    HTMLContent string
-    UID         uint32
+// Default limit of single user action
+const defaultOperationTimeout = 2 * time.Minute
+
+// Limits of automatic update period in seconds
+const (
+    minUpdatePeriod = 5
+    maxUpdatePeriod = 60
+)
+
+// Return timeouts of mailbox network operations
+func (s Settings) mailboxTimeouts() tempmail.Timeouts {
+    timeouts := tempmail.DefaultTimeouts
+    if s.ConnectTimeout > 0 {
+        timeouts.Dial = time.Duration(s.ConnectTimeout) * time.Second
+    }
+    return timeouts
 }
 
-type Settings struct {
-    ApiURL        string
-    AdminEmail    string
-    AdminPassword string
-    Domain        string
-    ImapServer    string
+// Return time after which user action is cancelled
+func (s Settings) operationTimeout() time.Duration {
+    if s.OperationTimeout > 0 {
+        return time.Duration(s.OperationTimeout) * time.Second
+    }
+    return defaultOperationTimeout
+}
+
+// Return retry policies with defaults for unset values
+func (s Settings) retryPolicies() tempmail.RetryPolicies {
+    return s.Retry.WithDefaults()
 }
 
-// Adding retry configuration structure
-type RetryConfig struct {
-    MaxAttempts     int
-    InitialInterval time.Duration
-    MaxInterval     time.Duration
+// Return number of failed updates after which polling is paused
+func (s Settings) breakerThreshold() int {
+    if s.BreakerThreshold > 0 {
+        return s.BreakerThreshold
+    }
+    return defaultBreakerThreshold
 }
 
-// Function to perform operation with retries
-func withRetry(config RetryConfig, operation func() error) error {
-    var lastErr error
-    interval := config.InitialInterval
+// Return duration of polling pause
+func (s Settings) breakerCooldown() time.Duration {
+    if s.BreakerCooldown > 0 {
+        return time.Duration(s.BreakerCooldown) * time.Second
+    }
+    return defaultBreakerCooldown
+}
 
-    for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
-        if err := operation(); err != nil {
-            lastErr = err
-            if attempt == config.MaxAttempts {
-                return fmt.Errorf("maximum attempts exceeded (%d): %w", config.MaxAttempts, err)
-            }
-            
-            // Increase interval but not more than maximum
-            if interval < config.MaxInterval {
-                interval *= 2
-                if interval > config.MaxInterval {
-                    interval = config.MaxInterval
-                }
-            }
-            
-            time.Sleep(interval)
-            continue
-        }
-        return nil
+// Return interval between automatic updates
+func (s Settings) updatePeriod() time.Duration {
+    if s.UpdatePeriod > 0 {
+        return time.Duration(s.UpdatePeriod) * time.Second
     }
-    return lastErr
+    return minUpdatePeriod * time.Second
 }
 
-func (s *Settings) Validate() error {
-    if s.ApiURL == "" {
-        return fmt.Errorf("API URL cannot be empty")
+// Return interval between server status checks, zero when disabled
+func (s Settings) statusCheckPeriod() time.Duration {
+    switch {
+    case s.StatusCheckPeriod < 0:
+        return 0
+    case s.StatusCheckPeriod > 0:
+        return time.Duration(s.StatusCheckPeriod) * time.Minute
     }
-    if s.AdminEmail == "" {
-        return fmt.Errorf("Admin email cannot be empty")
+    return defaultStatusCheckPeriod
+}
+
+// Create mailbox client for server profile
+func newMailbox(settings Settings, profile ServerProfile) (*tempmail.TempMailbox, error) {
+    mailbox, err := tempmail.NewTempMailbox(
+        profile.ApiURL,
+        profile.AdminEmail,
+        profile.adminSecret(),
+        profile.Domain,
+        profile.ImapServer,
+        profile.SmtpServer,
+    )
+    if err != nil {
+        return nil, err
     }
-    if s.AdminPassword == "" {
-        return fmt.Errorf("Admin password cannot be empty")
+    mailbox.Timeouts = settings.mailboxTimeouts()
+    mailbox.Retry = settings.retryPolicies()
+    applyProfile(mailbox, profile)
+    mailbox.Reauthenticate = func(ctx context.Context, rejected string) (string, error) {
+        return adminSessions.reauthenticate(ctx, profile, rejected)
     }
-    if s.Domain == "" {
-        return fmt.Errorf("Domain cannot be empty")
+    return mailbox, nil
+}
+
+// Apply profile settings that don't identify server account to mailbox,
+// which may be in use
+func applyProfile(mailbox *tempmail.TempMailbox, profile ServerProfile) {
+    mailbox.SetVerifyTLS(profile.verifyTLS())
+    mailbox.SetSieveServer(profile.SieveServer)
+    mailbox.SetMailboxQuota(profile.MailboxQuota)
+    mailbox.SetDomainSelection(profile.DomainSelection, profile.Domains)
+}
+
+func (s *Settings) Validate() error {
+    if len(s.Profiles) == 0 {
+        return fmt.Errorf("no server profiles configured")
     }
-    if s.ImapServer == "" {
-        return fmt.Errorf("IMAP server cannot be empty")
+    names := map[string]bool{}
+    for _, profile := range s.Profiles {
+        if names[profile.Name] {
+            return fmt.Errorf("duplicate profile name %q", profile.Name)
+        }
+        names[profile.Name] = true
+        if err := profile.Validate(); err != nil {
+            return err
+        }
     }
-    
-    // Check URL format
-    if _, err := url.Parse(s.ApiURL); err != nil {
-        return fmt.Errorf("invalid API URL format: %w", err)
+
+    if s.ConnectTimeout < 0 || s.OperationTimeout < 0 {
+        return fmt.Errorf("timeouts cannot be negative")
     }
-    
-    // Check email format
-    if !strings.Contains(s.AdminEmail, "@") {
-        return fmt.Errorf("invalid admin email format")
+    if s.UpdatePeriod != 0 && (s.UpdatePeriod < minUpdatePeriod || s.UpdatePeriod > maxUpdatePeriod) {
+        return fmt.Errorf("update period must be from %d to %d seconds", minUpdatePeriod, maxUpdatePeriod)
     }
     
     return nil
 }
 
+// Read settings file, legacy server fields are moved into profile
+func readSettingsFile(path string) (Settings, error) {
+    var settings Settings
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return settings, err
+    }
+    if err := json.Unmarshal(data, &settings); err != nil {
+        return settings, fmt.Errorf("error parsing settings file: %w", err)
+    }
+    if err := migrateLegacySettings(&settings, data); err != nil {
+        return settings, fmt.Errorf("error parsing settings file: %w", err)
+    }
+    return settings, nil
+}
+
+// Load settings. Environment variables override settings file, which
+// overrides defaults
 func loadSettings() (Settings, error) {
     // Default values
-    settings := Settings{
-        ApiURL:        "https://your.mailinabox.domain",
-        AdminEmail:    "admin@your.domain",
-        AdminPassword: "your_admin_password",
-        Domain:        "your.domain",
-        ImapServer:    "your.imap.server:993",
+    defaults := Settings{
+        Profiles: []ServerProfile{{
+            Name:          defaultProfileName,
+            ApiURL:        "https://your.mailinabox.domain",
+            AdminEmail:    "admin@your.domain",
+            AdminPassword: "your_admin_password",
+            Domain:        "your.domain",
+            ImapServer:    "your.imap.server:993",
+        }},
+        ActiveProfile: defaultProfileName,
     }
 
     // Try to load settings from file
-    data, err := ioutil.ReadFile("settings.json")
-    if err != nil {
-        if os.IsNotExist(err) {
-            return settings, fmt.Errorf("settings file not found")
-        }
-        return settings, fmt.Errorf("error reading settings file: %w", err)
+    settings, err := readSettingsFile(paths.Settings)
+    if err != nil && !os.IsNotExist(err) {
+        return defaults, fmt.Errorf("error reading settings file: %w", err)
     }
+    fileMissing := err != nil
 
-    if err := json.Unmarshal(data, &settings); err != nil {
-        return settings, fmt.Errorf("error parsing settings file: %w", err)
+    applied, err := applyEnvOverrides(&settings, lookupEnv)
+    if err != nil {
+        return defaults, fmt.Errorf("invalid environment variable %w", err)
+    }
+    // Settings may be given by environment alone, for example in CI
+    if fileMissing && applied == 0 {
+        return defaults, fmt.Errorf("settings file not found")
     }
 
     // Validate settings
@@ -161,652 +241,354 @@ func saveSettings(settings Settings) error {
         return fmt.Errorf("invalid settings: %w", err)
     }
 
+    // Values of environment variables such as passwords of CI secrets are
+    // never written, file keeps its own values
+    file, _ := readSettingsFile(paths.Settings)
+    restoreEnvOverrides(&settings, file, lookupEnv)
+
     data, err := json.MarshalIndent(settings, "", "    ")
     if err != nil {
         return fmt.Errorf("error serializing settings: %w", err)
     }
 
-    if err := ioutil.WriteFile("settings.json", data, 0644); err != nil {
+    if err := os.MkdirAll(filepath.Dir(paths.Settings), 0700); err != nil {
+        return fmt.Errorf("error creating config directory: %w", err)
+    }
+    if err := ioutil.WriteFile(paths.Settings, data, 0600); err != nil {
         return fmt.Errorf("error saving settings: %w", err)
     }
 
     return nil
 }
 
-// Function to test connection
-func testConnection(settings Settings) error {
-    // Check API connection
-    apiClient, err := mailinabox.New(settings.ApiURL, settings.AdminEmail, settings.AdminPassword)
-    if err != nil {
-        return fmt.Errorf("error connecting to API: %w", err)
-    }
-
-    // Test API by creating a test user
-    testEmail := fmt.Sprintf("test_%s@%s", generateRandomString(8), settings.Domain)
-    testPassword := generateRandomString(16)
-    _, err = apiClient.Mail.AddUser(context.Background(), testEmail, testPassword, "email")
-    if err != nil {
-        return fmt.Errorf("error testing API: %w", err)
-    }
-    // Remove test user
-    _, _ = apiClient.Mail.RemoveUser(context.Background(), testEmail)
-
-    // Check IMAP connection
-    tlsConfig := &tls.Config{
-        InsecureSkipVerify: true,
-    }
-    
-    imapClient, err := client.DialTLS(settings.ImapServer, tlsConfig)
-    if err != nil {
-        return fmt.Errorf("error connecting to IMAP: %w", err)
-    }
-    defer imapClient.Logout()
-
-    return nil
+// Create custom theme
+type customTheme struct {
+    fyne.Theme
 }
 
-func NewTempMailbox(apiURL, adminEmail, adminPassword, domain, imapServer string) (*TempMailbox, error) {
-    client, err := mailinabox.New(apiURL, adminEmail, adminPassword)
-    if err != nil {
-        return nil, fmt.Errorf("error creating client: %w", err)
-    }
-
-    return &TempMailbox{
-        Domain:     domain,
-        ImapServer: imapServer,
-        Client:     client,
-    }, nil
+func newCustomTheme() fyne.Theme {
+    return &customTheme{theme.DefaultTheme()}
 }
 
-func (tm *TempMailbox) Create() error {
-    tm.Username = generateRandomString(10)
-    tm.Password = generateRandomString(16)
-
-    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
-    
-    _, err := tm.Client.Mail.AddUser(context.Background(), email, tm.Password, "email")
-    if err != nil {
-        return fmt.Errorf("error creating user: %w", err)
+func (t *customTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+    switch name {
+    case theme.ColorNameBackground:
+        return color.NRGBA{R: 33, G: 33, B: 33, A: 255} // Dark gray background
+    case theme.ColorNameForeground:
+        return color.NRGBA{R: 255, G: 255, B: 255, A: 255} // White text
+    case theme.ColorNameInputBackground:
+        return color.NRGBA{R: 45, G: 45, B: 45, A: 255} // Slightly lighter than background for input fields
     }
-
-    return nil
+    return t.Theme.Color(name, variant)
 }
 
-func (tm *TempMailbox) Delete() error {
-    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
-    _, err := tm.Client.Mail.RemoveUser(context.Background(), email)
+func saveMailboxToFile(email, password string) error {
+    file, err := os.OpenFile(paths.dataFile(savedMailboxesFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
     if err != nil {
-        return fmt.Errorf("error deleting user: %w", err)
+        return err
     }
-    return nil
-}
+    defer file.Close()
 
-func (tm *TempMailbox) DeleteAllMails() error {
-    retryConfig := RetryConfig{
-        MaxAttempts:     3,
-        InitialInterval: 1 * time.Second,
-        MaxInterval:     5 * time.Second,
-    }
-    
-    return withRetry(retryConfig, func() error {
-        return tm.deleteAllMailsInternal()
-    })
+    timestamp := time.Now().Format("2006-01-02 15:04:05")
+    _, err = fmt.Fprintf(file, "[%s] Email: %s | Password: %s\n", timestamp, email, password)
+    return err
 }
 
-func (tm *TempMailbox) deleteAllMailsInternal() error {
-    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
-    log.Printf("Deleting all mails for %s\n", email)
-    
-    tlsConfig := &tls.Config{
-        InsecureSkipVerify: true,
-    }
-    
-    imapClient, err := client.DialTLS(tm.ImapServer, tlsConfig)
-    if err != nil {
-        return fmt.Errorf("error connecting to IMAP: %w", err)
-    }
-    defer imapClient.Logout()
-
-    if err := imapClient.Login(email, tm.Password); err != nil {
-        return fmt.Errorf("error authenticating IMAP: %w", err)
-    }
-
-    // Select INBOX
-    mbox, err := imapClient.Select("INBOX", false)
-    if err != nil {
-        return fmt.Errorf("error selecting folder: %w", err)
+// Return UIDs from known set which are missing in the list and remove them
+// from the set
+func detectRemovedEmails(known map[uint32]bool, emails []tempmail.Email) []uint32 {
+    present := make(map[uint32]bool, len(emails))
+    for _, email := range emails {
+        present[email.UID] = true
     }
 
-    if mbox.Messages == 0 {
-        return nil
+    var removed []uint32
+    for uid := range known {
+        if !present[uid] {
+            removed = append(removed, uid)
+            delete(known, uid)
+        }
     }
+    return removed
+}
 
-    // Create set for all messages
-    seqSet := new(imap.SeqSet)
-    seqSet.AddRange(1, mbox.Messages)
-
-    // Mark all messages as deleted
-    item := imap.FormatFlagsOp(imap.AddFlags, true)
-    flags := []interface{}{imap.DeletedFlag}
-    if err := imapClient.Store(seqSet, item, flags, nil); err != nil {
-        return fmt.Errorf("error marking mails for deletion: %w", err)
+// Return text marker for unread and starred messages
+func emailStatusMarker(email tempmail.Email) string {
+    marker := ""
+    if !email.Seen {
+        marker += "● "
     }
-
-    // Physically delete marked messages
-    if err := imapClient.Expunge(nil); err != nil {
-        return fmt.Errorf("error deleting mails: %w", err)
+    if email.Flagged {
+        marker += "★ "
     }
-
-    return nil
+    return marker
 }
 
-func extractTextFromHTML(htmlContent string) string {
-    doc, err := html.Parse(strings.NewReader(htmlContent))
-    if err != nil {
-        return htmlContent
-    }
-
-    var text strings.Builder
-    var extract func(*html.Node)
-    extract = func(n *html.Node) {
-        if n.Type == html.TextNode {
-            text.WriteString(strings.TrimSpace(n.Data))
-            if len(n.Data) > 0 {
-                text.WriteString("\n")
-            }
+// Return unseen messages whose UIDs are not in known set and add
+// all UIDs of the list to the set
+func detectNewEmails(known map[uint32]bool, emails []tempmail.Email) []tempmail.Email {
+    var fresh []tempmail.Email
+    for _, email := range emails {
+        if known[email.UID] {
+            continue
         }
-        for c := n.FirstChild; c != nil; c = c.NextSibling {
-            extract(c)
+        known[email.UID] = true
+        if !email.Seen {
+            fresh = append(fresh, email)
         }
     }
-    extract(doc)
-    return strings.TrimSpace(text.String())
+    return fresh
 }
 
-func getTextFromPart(part *multipart.Part) (string, error) {
-    contentType := part.Header.Get("Content-Type")
-    mediaType, _, err := mime.ParseMediaType(contentType)
-    if err != nil {
-        return "", err
-    }
-
-    content, err := ioutil.ReadAll(part)
-    if err != nil {
-        return "", err
-    }
-
-    if strings.HasPrefix(mediaType, "text/html") {
-        return extractTextFromHTML(string(content)), nil
+// Return emails without message with UID
+func removeEmail(emails []tempmail.Email, uid uint32) []tempmail.Email {
+    var kept []tempmail.Email
+    for _, email := range emails {
+        if email.UID != uid {
+            kept = append(kept, email)
+        }
     }
-    return string(content), nil
+    return kept
 }
 
-func decodeRFC2047(s string) string {
-    decoded, err := (&mime.WordDecoder{}).DecodeHeader(s)
-    if err != nil {
-        return s
+// Return emails with message with UID marked read
+func markEmailSeen(emails []tempmail.Email, uid uint32) []tempmail.Email {
+    for i := range emails {
+        if emails[i].UID == uid {
+            emails[i].Seen = true
+        }
     }
-    return decoded
+    return emails
 }
 
-func decodeContent(content []byte, encoding string) ([]byte, error) {
-    encoding = strings.ToLower(encoding)
-    switch encoding {
-    case "base64":
-        decoded := make([]byte, base64.StdEncoding.DecodedLen(len(content)))
-        n, err := base64.StdEncoding.Decode(decoded, content)
-        if err != nil {
-            return content, err
-        }
-        return decoded[:n], nil
-    case "quoted-printable":
-        reader := quotedprintable.NewReader(bytes.NewReader(content))
-        decoded, err := ioutil.ReadAll(reader)
-        if err != nil {
-            return content, err
-        }
-        return decoded, nil
-    default:
-        return content, nil
-    }
+// Show dialog editing active server profile
+func showSettingsDialog(window fyne.Window, settings Settings, onSave func(Settings)) {
+    showProfileDialog(window, settings, settings.Profile().Name, onSave)
 }
 
-// Updated CheckMail method with retry support
-func (tm *TempMailbox) CheckMail() ([]Email, error) {
-    var emails []Email
+// Show dialog editing server profile with name, new profile is added when
+// name is empty
+func showProfileDialog(window fyne.Window, settings Settings, name string, onSave func(Settings)) {
+    profile, _ := settings.findProfile(name)
+
+    // Create input fields
+    nameEntry := widget.NewEntry()
+    nameEntry.SetText(profile.Name)
+    nameEntry.SetPlaceHolder("Work server")
+
+    apiURLEntry := widget.NewEntry()
+    apiURLEntry.SetText(profile.ApiURL)
     
-    retryConfig := RetryConfig{
-        MaxAttempts:     3,
-        InitialInterval: 1 * time.Second,
-        MaxInterval:     5 * time.Second,
+    adminEmailEntry := widget.NewEntry()
+    adminEmailEntry.SetText(profile.AdminEmail)
+    
+    adminPasswordEntry := widget.NewPasswordEntry()
+    adminPasswordEntry.SetText(profile.AdminPassword)
+    adminPasswordEntry.SetPlaceHolder("Asked on login when empty")
+    if profile.SessionKey != "" {
+        adminPasswordEntry.SetPlaceHolder("Logged in with TOTP, password not stored")
     }
     
-    err := withRetry(retryConfig, func() error {
-        var checkErr error
-        emails, checkErr = tm.checkMailInternal()
-        return checkErr
+    domainEntry := widget.NewSelectEntry(profile.Domains)
+    domainEntry.SetText(profile.Domain)
+
+    // Domains used by random and round-robin selection, all server domains
+    // when none is checked
+    domainsGroup := widget.NewCheckGroup(profile.Domains, nil)
+    domainsGroup.Horizontal = true
+    domainsGroup.SetSelected(profile.Domains)
+
+    domainSelections := map[string]string{
+        "Fixed domain": tempmail.DomainFixed,
+        "Random":       tempmail.DomainRandom,
+        "Round-robin":  tempmail.DomainRoundRobin,
+    }
+    domainSelect := widget.NewSelect([]string{"Fixed domain", "Random", "Round-robin"}, func(selected string) {
+        if domainSelections[selected] == tempmail.DomainFixed {
+            domainsGroup.Hide()
+        } else {
+            domainsGroup.Show()
+        }
     })
+    switch profile.DomainSelection {
+    case tempmail.DomainRandom:
+        domainSelect.SetSelected("Random")
+    case tempmail.DomainRoundRobin:
+        domainSelect.SetSelected("Round-robin")
+    default:
+        domainSelect.SetSelected("Fixed domain")
+    }
     
-    return emails, err
-}
+    imapServerEntry := widget.NewEntry()
+    imapServerEntry.SetText(profile.ImapServer)
 
-// Renamed original CheckMail method to checkMailInternal
-func (tm *TempMailbox) checkMailInternal() ([]Email, error) {
-    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
-    log.Printf("Checking mail for %s\n", email)
-    
-    tlsConfig := &tls.Config{
-        InsecureSkipVerify: true,
+    smtpServerEntry := widget.NewEntry()
+    smtpServerEntry.SetText(profile.SmtpServer)
+    smtpServerEntry.SetPlaceHolder("IMAP host with port 587")
+
+    sieveServerEntry := widget.NewEntry()
+    sieveServerEntry.SetText(profile.SieveServer)
+    sieveServerEntry.SetPlaceHolder("IMAP host with port 4190")
+
+    quotaEntry := widget.NewEntry()
+    quotaEntry.SetText(profile.MailboxQuota)
+    quotaEntry.SetPlaceHolder("Server default, e.g. 50M")
+
+    retentionAgeEntry, retentionKeepEntry := newRetentionEntries(profile.Retention)
+
+    tlsPolicies := map[string]string{
+        "Accept self-signed certificates": tlsPolicySkipVerify,
+        "Verify certificates":             tlsPolicyVerify,
     }
-    
-    imapClient, err := client.DialTLS(tm.ImapServer, tlsConfig)
-    if err != nil {
-        return nil, fmt.Errorf("error connecting to IMAP: %w", err)
+    tlsSelect := widget.NewSelect([]string{"Accept self-signed certificates", "Verify certificates"}, nil)
+    if profile.verifyTLS() {
+        tlsSelect.SetSelected("Verify certificates")
+    } else {
+        tlsSelect.SetSelected("Accept self-signed certificates")
     }
-    defer imapClient.Logout()
 
-    if err := imapClient.Login(email, tm.Password); err != nil {
-        return nil, fmt.Errorf("error authenticating IMAP: %w", err)
+    connectTimeoutEntry := widget.NewEntry()
+    connectTimeoutEntry.SetPlaceHolder(fmt.Sprintf("%.0f", tempmail.DefaultTimeouts.Dial.Seconds()))
+    if settings.ConnectTimeout > 0 {
+        connectTimeoutEntry.SetText(strconv.Itoa(settings.ConnectTimeout))
     }
-    log.Printf("Successfully connected to IMAP\n")
 
-    mbox, err := imapClient.Select("INBOX", false)
-    if err != nil {
-        return nil, fmt.Errorf("error selecting folder: %w", err)
+    operationTimeoutEntry := widget.NewEntry()
+    operationTimeoutEntry.SetPlaceHolder(fmt.Sprintf("%.0f", defaultOperationTimeout.Seconds()))
+    if settings.OperationTimeout > 0 {
+        operationTimeoutEntry.SetText(strconv.Itoa(settings.OperationTimeout))
     }
-    log.Printf("Selected INBOX, mails: %d\n", mbox.Messages)
 
-    if mbox.Messages == 0 {
-        return []Email{}, nil
+    quotaWarnEntry := widget.NewEntry()
+    quotaWarnEntry.SetPlaceHolder(strconv.Itoa(defaultQuotaWarnPercent))
+    if settings.QuotaWarnPercent > 0 {
+        quotaWarnEntry.SetText(strconv.Itoa(settings.QuotaWarnPercent))
     }
+    autoPurgeCheck := widget.NewCheck("Delete oldest messages instead of warning", nil)
+    autoPurgeCheck.SetChecked(settings.QuotaAutoPurge)
 
-    seqSet := new(imap.SeqSet)
-    seqSet.AddRange(1, mbox.Messages)
-
-    messages := make(chan *imap.Message, 10)
-    done := make(chan error, 1)
-
-    // Request all message data
-    items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchBody, imap.FetchBodyStructure, "BODY[]"}
-
-    go func() {
-        done <- imapClient.Fetch(seqSet, items, messages)
-    }()
+    // Read settings from form fields, keeping settings edited in other dialogs
+    formSettings := func() (Settings, ServerProfile, error) {
+        newProfile := ServerProfile{
+            Name:          strings.TrimSpace(nameEntry.Text),
+            ApiURL:        apiURLEntry.Text,
+            AdminEmail:    adminEmailEntry.Text,
+            AdminPassword: adminPasswordEntry.Text,
+            Domain:        domainEntry.Text,
+            ImapServer:    imapServerEntry.Text,
+            SmtpServer:    smtpServerEntry.Text,
+            SieveServer:   strings.TrimSpace(sieveServerEntry.Text),
+            MailboxQuota:  strings.ToUpper(strings.TrimSpace(quotaEntry.Text)),
+            TLSPolicy:     tlsPolicies[tlsSelect.Selected],
 
-    var emails []Email
-    for msg := range messages {
-        email := Email{
-            Subject: decodeRFC2047(msg.Envelope.Subject),
-            UID:     msg.Uid,
+            DomainSelection: domainSelections[domainSelect.Selected],
+            Domains:         append([]string{}, domainsGroup.Selected...),
         }
-        
-        if len(msg.Envelope.From) > 0 {
-            addr := msg.Envelope.From[0]
-            if addr.PersonalName != "" {
-                email.From = decodeRFC2047(addr.PersonalName)
-            } else {
-                email.From = fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
-            }
+        if len(newProfile.Domains) == 0 {
+            newProfile.Domains = nil
         }
-
-        log.Printf("Processing mail from %s with subject %s\n", email.From, email.Subject)
-
-        // Get message body
-        for _, literal := range msg.Body {
-            buf := new(bytes.Buffer)
-            _, err := io.Copy(buf, literal)
-            if err != nil {
-                log.Printf("Error reading message body: %v\n", err)
-                continue
-            }
-
-            // Try to read as MIME message
-            m, err := mail.ReadMessage(bytes.NewReader(buf.Bytes()))
-            if err != nil {
-                log.Printf("Error parsing MIME: %v\n", err)
-                // Try to decode as plain text
-                decoded, err := decodeCharset(buf.Bytes(), "")
-                if err == nil {
-                    email.Content = decoded
-                } else {
-                    email.Content = decodeRFC2047(buf.String())
-                }
-                continue
+        if newProfile.MailboxQuota != "" {
+            if err := tempmail.ValidateQuota(newProfile.MailboxQuota); err != nil {
+                return settings, newProfile, err
             }
+        }
+        retention, err := parseRetention(retentionAgeEntry.Text, retentionKeepEntry.Text)
+        if err != nil {
+            return settings, newProfile, err
+        }
+        newProfile.Retention = retention
+        // Session stays valid while account is the same and no password is entered
+        if newProfile.AdminPassword == "" && newProfile.ApiURL == profile.ApiURL && newProfile.AdminEmail == profile.AdminEmail {
+            newProfile.SessionKey = profile.SessionKey
+        }
+        newSettings := settings
+        if newProfile.Name != name && settings.profileIndex(newProfile.Name) >= 0 {
+            return newSettings, newProfile, fmt.Errorf("profile %q already exists", newProfile.Name)
+        }
+        newSettings.setProfile(name, newProfile)
 
-            mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
-            if err != nil {
-                log.Printf("Error determining content type: %v\n", err)
-                decoded, err := decodeCharset(buf.Bytes(), "")
-                if err == nil {
-                    email.Content = decoded
-                } else {
-                    email.Content = decodeRFC2047(buf.String())
-                }
-                continue
+        newSettings.ConnectTimeout = 0
+        if text := strings.TrimSpace(connectTimeoutEntry.Text); text != "" {
+            seconds, err := strconv.Atoi(text)
+            if err != nil || seconds < 0 {
+                return newSettings, newProfile, fmt.Errorf("connect timeout must be a number of seconds")
             }
-
-            log.Printf("Content type: %s\n", mediaType)
-
-            if strings.HasPrefix(mediaType, "multipart/") {
-                mr := multipart.NewReader(m.Body, params["boundary"])
-                
-                // Process only text parts
-                for {
-                    part, err := mr.NextPart()
-                    if err == io.EOF {
-                        break
-                    }
-                    if err != nil {
-                        log.Printf("Error reading part: %v\n", err)
-                        continue
-                    }
-
-                    partType, partParams, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
-                    if err != nil {
-                        continue
-                    }
-                    
-                    partCharset := partParams["charset"]
-                    if partCharset == "" {
-                        partCharset = "utf-8"
-                    }
-
-                    body, err := ioutil.ReadAll(part)
-                    if err != nil {
-                        continue
-                    }
-
-                    decodedBody, err := decodeContent(body, part.Header.Get("Content-Transfer-Encoding"))
-                    if err != nil {
-                        decodedBody = body
-                    }
-
-                    if strings.HasPrefix(partType, "text/plain") {
-                        decoded, err := decodeCharset(decodedBody, partCharset)
-                        if err == nil {
-                            if email.Content == "" {
-                                email.Content = decoded
-                            } else {
-                                email.Content += "\n\n" + decoded
-                            }
-                        } else {
-                            if email.Content == "" {
-                                email.Content = string(decodedBody)
-                            } else {
-                                email.Content += "\n\n" + string(decodedBody)
-                            }
-                        }
-                        log.Printf("Added message text\n")
-                    } else if strings.HasPrefix(partType, "text/html") {
-                        decoded, err := decodeCharset(decodedBody, partCharset)
-                        if err == nil {
-                            email.HTMLContent = decoded
-                            if email.Content == "" {
-                                email.Content = extractTextFromHTML(decoded)
-                            }
-                        } else {
-                            email.HTMLContent = string(decodedBody)
-                            if email.Content == "" {
-                                email.Content = extractTextFromHTML(string(decodedBody))
-                            }
-                        }
-                        log.Printf("Added HTML message text\n")
-                    }
-                }
-            } else if strings.HasPrefix(mediaType, "text/plain") {
-                body, _ := ioutil.ReadAll(m.Body)
-                decodedBody, err := decodeContent(body, m.Header.Get("Content-Transfer-Encoding"))
-                if err != nil {
-                    decodedBody = body
-                }
-                decoded, err := decodeCharset(decodedBody, params["charset"])
-                if err == nil {
-                    email.Content = decoded
-                } else {
-                    email.Content = string(decodedBody)
-                }
-            } else if strings.HasPrefix(mediaType, "text/html") {
-                body, _ := ioutil.ReadAll(m.Body)
-                decodedBody, err := decodeContent(body, m.Header.Get("Content-Transfer-Encoding"))
-                if err != nil {
-                    log.Printf("Error decoding content: %v\n", err)
-                    decodedBody = body
-                }
-                decoded, err := decodeCharset(decodedBody, params["charset"])
-                if err == nil {
-                    email.HTMLContent = decoded
-                    email.Content = extractTextFromHTML(decoded)
-                } else {
-                    email.HTMLContent = string(decodedBody)
-                    email.Content = extractTextFromHTML(string(decodedBody))
-                }
+            newSettings.ConnectTimeout = seconds
+        }
+        newSettings.OperationTimeout = 0
+        if text := strings.TrimSpace(operationTimeoutEntry.Text); text != "" {
+            seconds, err := strconv.Atoi(text)
+            if err != nil || seconds < 0 {
+                return newSettings, newProfile, fmt.Errorf("operation timeout must be a number of seconds")
             }
-
-            if email.Content != "" {
-                // Clear content from null bytes and extra spaces
-                email.Content = strings.TrimSpace(strings.ReplaceAll(email.Content, "\x00", ""))
-                // Add logging for debugging
-                log.Printf("Message content after processing: %s\n", email.Content)
+            newSettings.OperationTimeout = seconds
+        }
+        newSettings.QuotaWarnPercent = 0
+        if text := strings.TrimSpace(quotaWarnEntry.Text); text != "" {
+            percent, err := strconv.Atoi(text)
+            if err != nil || percent < 1 || percent > 100 {
+                return newSettings, newProfile, fmt.Errorf("quota warning must be a percent from 1 to 100")
             }
+            newSettings.QuotaWarnPercent = percent
         }
-
-        log.Printf("Adding message to list\n")
-        emails = append(emails, email)
-    }
-
-    if err := <-done; err != nil {
-        return nil, fmt.Errorf("error getting messages: %w", err)
-    }
-
-    // Sort messages in reverse order (newest on top)
-    for i := len(emails)/2 - 1; i >= 0; i-- {
-        opp := len(emails) - 1 - i
-        emails[i], emails[opp] = emails[opp], emails[i]
+        newSettings.QuotaAutoPurge = autoPurgeCheck.Checked
+        return newSettings, newProfile, nil
     }
 
-    log.Printf("Total processed messages: %d\n", len(emails))
-    return emails, nil
-}
-
-func generateRandomString(length int) string {
-    const charset = "abcdefghijklmnopqrstuvwxyz" // Only small English letters
-    seededRand := rand.New(rand.NewSource(time.Now().UnixNano()))
-    
-    b := strings.Builder{}
-    b.Grow(length)
-    for i := 0; i < length; i++ {
-        b.WriteByte(charset[seededRand.Intn(len(charset))])
-    }
-    return b.String()
-}
+    // Create progress indicator
+    progress := widget.NewProgressBarInfinite()
+    progress.Hide()
 
-func decodeCharset(content []byte, charset string) (string, error) {
-    charset = strings.ToLower(charset)
-    switch charset {
-    case "utf-8", "us-ascii":
-        return string(content), nil
-    case "koi8-r":
-        decoder := charmap.KOI8R.NewDecoder()
-        decoded, err := decoder.Bytes(content)
-        if err != nil {
-            return "", err
-        }
-        return string(decoded), nil
-    case "windows-1251", "cp1251":
-        decoder := charmap.Windows1251.NewDecoder()
-        decoded, err := decoder.Bytes(content)
+    // Create diagnostics button, checks run with values of the form
+    testButton := widget.NewButton("Run diagnostics", func() {
+        newSettings, newProfile, err := formSettings()
         if err != nil {
-            return "", err
+            dialog.ShowError(err, window)
+            return
         }
-        return string(decoded), nil
-    case "iso-8859-5":
-        decoder := charmap.ISO8859_5.NewDecoder()
-        decoded, err := decoder.Bytes(content)
+        showDiagnosticsDialog(window, newSettings, newProfile)
+    })
+
+    // Fill domain choices with domains hosted on server
+    loadDomainsButton := widget.NewButton("Load from server", func() {
+        newSettings, newProfile, err := formSettings()
         if err != nil {
-            return "", err
-        }
-        return string(decoded), nil
-    default:
-        // Try to guess encoding
-        // First try windows-1251 as the most common
-        decoder := charmap.Windows1251.NewDecoder()
-        decoded, err := decoder.Bytes(content)
-        if err == nil && !strings.Contains(string(decoded), "") {
-            return string(decoded), nil
-        }
-        
-        // Then try KOI8-R
-        decoder = charmap.KOI8R.NewDecoder()
-        decoded, err = decoder.Bytes(content)
-        if err == nil && !strings.Contains(string(decoded), "") {
-            return string(decoded), nil
+            dialog.ShowError(err, window)
+            return
         }
+        progress.Show()
 
-        return string(content), fmt.Errorf("unsupported encoding: %s", charset)
-    }
-}
-
-// Create custom theme
-type customTheme struct {
-    fyne.Theme
-}
-
-func newCustomTheme() fyne.Theme {
-    return &customTheme{theme.DefaultTheme()}
-}
-
-func (t *customTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
-    switch name {
-    case theme.ColorNameBackground:
-        return color.NRGBA{R: 33, G: 33, B: 33, A: 255} // Dark gray background
-    case theme.ColorNameForeground:
-        return color.NRGBA{R: 255, G: 255, B: 255, A: 255} // White text
-    case theme.ColorNameInputBackground:
-        return color.NRGBA{R: 45, G: 45, B: 45, A: 255} // Slightly lighter than background for input fields
-    }
-    return t.Theme.Color(name, variant)
-}
-
-func saveMailboxToFile(email, password string) error {
-    file, err := os.OpenFile("saved_mailboxes.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-    if err != nil {
-        return err
-    }
-    defer file.Close()
-
-    timestamp := time.Now().Format("2006-01-02 15:04:05")
-    _, err = fmt.Fprintf(file, "[%s] Email: %s | Password: %s\n", timestamp, email, password)
-    return err
-}
-
-// Updated DeleteMail method with retry support
-func (tm *TempMailbox) DeleteMail(uid uint32) error {
-    retryConfig := RetryConfig{
-        MaxAttempts:     3,
-        InitialInterval: 1 * time.Second,
-        MaxInterval:     5 * time.Second,
-    }
-    
-    return withRetry(retryConfig, func() error {
-        return tm.deleteMailInternal(uid)
-    })
-}
-
-// Renamed original DeleteMail method to deleteMailInternal
-func (tm *TempMailbox) deleteMailInternal(uid uint32) error {
-    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
-    log.Printf("Deleting mail with UID %d for %s\n", uid, email)
-    
-    tlsConfig := &tls.Config{
-        InsecureSkipVerify: true,
-    }
-    
-    imapClient, err := client.DialTLS(tm.ImapServer, tlsConfig)
-    if err != nil {
-        return fmt.Errorf("error connecting to IMAP: %w", err)
-    }
-    defer imapClient.Logout()
-
-    if err := imapClient.Login(email, tm.Password); err != nil {
-        return fmt.Errorf("error authenticating IMAP: %w", err)
-    }
-
-    // Select INBOX
-    _, err = imapClient.Select("INBOX", false)
-    if err != nil {
-        return fmt.Errorf("error selecting folder: %w", err)
-    }
-
-    // Create set for message by UID
-    seqSet := new(imap.SeqSet)
-    seqSet.AddNum(uid)
-
-    // Mark message as deleted
-    item := imap.FormatFlagsOp(imap.AddFlags, true)
-    flags := []interface{}{imap.DeletedFlag}
-    if err := imapClient.UidStore(seqSet, item, flags, nil); err != nil {
-        return fmt.Errorf("error marking message for deletion: %w", err)
-    }
-
-    // Physically delete marked message
-    if err := imapClient.Expunge(nil); err != nil {
-        return fmt.Errorf("error deleting message: %w", err)
-    }
-
-    return nil
-}
-
-func showSettingsDialog(window fyne.Window, settings Settings, onSave func(Settings)) {
-    // Create input fields
-    apiURLEntry := widget.NewEntry()
-    apiURLEntry.SetText(settings.ApiURL)
-    
-    adminEmailEntry := widget.NewEntry()
-    adminEmailEntry.SetText(settings.AdminEmail)
-    
-    adminPasswordEntry := widget.NewEntry()
-    adminPasswordEntry.SetText(settings.AdminPassword)
-    
-    domainEntry := widget.NewEntry()
-    domainEntry.SetText(settings.Domain)
-    
-    imapServerEntry := widget.NewEntry()
-    imapServerEntry.SetText(settings.ImapServer)
-
-    // Create progress indicator
-    progress := widget.NewProgressBarInfinite()
-    progress.Hide()
-
-    // Create test connection button
-    testButton := widget.NewButton("Test connection", func() {
-        progress.Show()
-        newSettings := Settings{
-            ApiURL:        apiURLEntry.Text,
-            AdminEmail:    adminEmailEntry.Text,
-            AdminPassword: adminPasswordEntry.Text,
-            Domain:        domainEntry.Text,
-            ImapServer:    imapServerEntry.Text,
-        }
-
-        // Validate settings in separate goroutine
         go func() {
-            if err := testConnection(newSettings); err != nil {
-                // Return to main goroutine for UI update
-                window.Canvas().Refresh(progress)
-                progress.Hide()
-                dialog.ShowError(err, window)
+            ctx, cancel := context.WithTimeout(context.Background(), newSettings.operationTimeout())
+            defer cancel()
+            defer progress.Hide()
+
+            testMailbox, err := newMailbox(newSettings, newProfile)
+            if err != nil {
+                dialog.ShowError(fmt.Errorf("Error connecting to API: %v", err), window)
                 return
             }
-            
-            window.Canvas().Refresh(progress)
-            progress.Hide()
-            dialog.ShowInformation("Success", "Connection established", window)
+            domains, err := testMailbox.ServerDomains(ctx)
+            if err != nil {
+                slog.Error("Error loading domains", "error", err)
+                dialog.ShowError(fmt.Errorf("Error loading domains: %v", err), window)
+                return
+            }
+            domainEntry.SetOptions(domains)
+            if domainEntry.Text == "" && len(domains) > 0 {
+                domainEntry.SetText(domains[0])
+            }
+            selected := domainsGroup.Selected
+            domainsGroup.Options = domains
+            domainsGroup.SetSelected(selected)
+            domainsGroup.Refresh()
         }()
     })
 
     // Create form
     formContent := container.NewVBox(
+        container.NewHBox(widget.NewLabel("Profile name:"), layout.NewSpacer()),
+        container.NewMax(nameEntry),
         container.NewHBox(widget.NewLabel("API URL:"), layout.NewSpacer()),
         container.NewMax(apiURLEntry),
         container.NewHBox(widget.NewLabel("Admin email:"), layout.NewSpacer()),
@@ -814,9 +596,31 @@ func showSettingsDialog(window fyne.Window, settings Settings, onSave func(Setti
         container.NewHBox(widget.NewLabel("Admin password:"), layout.NewSpacer()),
         container.NewMax(adminPasswordEntry),
         container.NewHBox(widget.NewLabel("Domain:"), layout.NewSpacer()),
-        container.NewMax(domainEntry),
+        container.NewBorder(nil, nil, nil, loadDomainsButton, domainEntry),
+        container.NewHBox(widget.NewLabel("Domain of new mailboxes:"), layout.NewSpacer()),
+        container.NewMax(domainSelect),
+        domainsGroup,
         container.NewHBox(widget.NewLabel("IMAP server:"), layout.NewSpacer()),
         container.NewMax(imapServerEntry),
+        container.NewHBox(widget.NewLabel("SMTP server:"), layout.NewSpacer()),
+        container.NewMax(smtpServerEntry),
+        container.NewHBox(widget.NewLabel("ManageSieve server:"), layout.NewSpacer()),
+        container.NewMax(sieveServerEntry),
+        container.NewHBox(widget.NewLabel("Mailbox quota:"), layout.NewSpacer()),
+        container.NewMax(quotaEntry),
+        container.NewHBox(widget.NewLabel("Delete messages older than:"), layout.NewSpacer()),
+        container.NewMax(retentionAgeEntry),
+        container.NewHBox(widget.NewLabel("Keep only last messages:"), layout.NewSpacer()),
+        container.NewMax(retentionKeepEntry),
+        container.NewHBox(widget.NewLabel("TLS:"), layout.NewSpacer()),
+        container.NewMax(tlsSelect),
+        container.NewHBox(widget.NewLabel("Connect timeout (sec):"), layout.NewSpacer()),
+        container.NewMax(connectTimeoutEntry),
+        container.NewHBox(widget.NewLabel("Operation timeout (sec):"), layout.NewSpacer()),
+        container.NewMax(operationTimeoutEntry),
+        container.NewHBox(widget.NewLabel("Quota warning (%):"), layout.NewSpacer()),
+        container.NewMax(quotaWarnEntry),
+        autoPurgeCheck,
         progress,
         container.NewHBox(
             testButton,
@@ -824,12 +628,11 @@ func showSettingsDialog(window fyne.Window, settings Settings, onSave func(Setti
             widget.NewButton("Save", func() {
                 progress.Show()
                 
-                newSettings := Settings{
-                    ApiURL:        apiURLEntry.Text,
-                    AdminEmail:    adminEmailEntry.Text,
-                    AdminPassword: adminPasswordEntry.Text,
-                    Domain:        domainEntry.Text,
-                    ImapServer:    imapServerEntry.Text,
+                newSettings, _, err := formSettings()
+                if err != nil {
+                    progress.Hide()
+                    dialog.ShowError(err, window)
+                    return
                 }
                 
                 // Validate settings
@@ -854,12 +657,29 @@ func showSettingsDialog(window fyne.Window, settings Settings, onSave func(Setti
     )
 
     // Create dialog with increased size
-    settingsDialog := dialog.NewCustom("Settings", "Close", container.NewPadded(formContent), window)
-    settingsDialog.Resize(fyne.NewSize(400, 400))
+    title := "Settings"
+    if name == "" {
+        title = "New profile"
+    }
+    settingsDialog := dialog.NewCustom(title, "Close", container.NewPadded(container.NewVScroll(formContent)), window)
+    settingsDialog.Resize(fyne.NewSize(400, 500))
     settingsDialog.Show()
 }
 
 func main() {
+    configFlag := flag.String("config", "", "path to settings file")
+    dataDirFlag := flag.String("data-dir", "", "directory for saved mailboxes, log and webhook outbox")
+    totpFlag := flag.String("totp", os.Getenv("TEMPMAIL_TOTP"), "TOTP code for admin login with two-factor authentication")
+    flag.Parse()
+
+    // Find settings file and data directory
+    resolved, err := resolvePaths(*configFlag, *dataDirFlag)
+    if err != nil {
+        slog.Error("Error resolving paths", "error", err)
+    } else {
+        paths = resolved
+    }
+
     // Load settings
     settings, err := loadSettings()
     
@@ -873,8 +693,81 @@ func main() {
     
     window := myApp.NewWindow("Temporary email mailbox")
 
+    store := newSettingsStore(settings)
+
+    // Ask for admin password and TOTP code when server rejects credentials
+    adminSessions.store = store
+    adminSessions.prompt = newAdminPrompt(window)
+    adminSessions.totp = *totpFlag
+
+    // Write logs to rotated file, with message content only when debug
+    // logging is on
+    logging := setupLogging(paths.dataFile(logFileName), settings.DebugLogging)
+
+    // Structured record of provisioning and destructive actions
+    audit := newAuditLog(paths.dataFile(auditLogFile))
+
+    // Start delivery of webhook events
+    webhooks := NewWebhookDispatcher(paths.dataFile(webhookOutboxFile), settings.Webhooks)
+    go webhooks.Run()
+
+    // Mailbox shown in main window, nil until it is created. Replaced as
+    // a whole, so operations keep using mailbox they started with
+    var currentMailbox atomic.Pointer[tempmail.TempMailbox]
+
+    // Start local server with event stream and mail API if configured
+    events := NewEventStream()
+    server := newLocalServer(events, currentMailbox.Load, audit)
+    server.Apply(settings)
+
+    // Reconfigure services when settings change
+    store.Subscribe(func(old, new Settings) {
+        logging.SetDebug(new.DebugLogging)
+        webhooks.SetWebhooks(new.Webhooks)
+        server.Apply(new)
+        if changed := changedSettings(old, new); len(changed) > 0 {
+            audit.Record(auditEntry{
+                Actor:   ActorGUI,
+                Action:  AuditSettingsChange,
+                Target:  paths.Settings,
+                Outcome: OutcomeSuccess,
+                Detail:  "changed " + strings.Join(changed, ", "),
+            })
+        }
+    })
+
+    // Run mail rules with clipboard of main window
+    rules := &ruleEngine{clipboard: window.Clipboard(), webhooks: webhooks, audit: audit}
+
+    // Journal of created mailboxes shown in admin panel
+    journal := newMailboxJournal(paths.dataFile(mailboxJournalFile))
+
+    // Send mailbox event to webhooks and event stream clients and record it
+    // in journal
+    publishEvent := func(event MailEvent) {
+        journal.Record(event)
+        webhooks.Publish(event)
+        events.Publish(event)
+    }
+
+    // Help menu shown in both interfaces
+    newHelpMenu := func() *fyne.Menu {
+        return fyne.NewMenu("Help",
+            fyne.NewMenuItem("Log", func() {
+                showLogWindow(myApp, paths.dataFile(logFileName), store.Get().DebugLogging, func(debug bool) error {
+                    return store.Update(func(s *Settings) {
+                        s.DebugLogging = debug
+                    })
+                })
+            }),
+        )
+    }
+
+    var showSettingsInterface func()
+    var startMailbox func()
+
     // Function to show settings-only interface
-    showSettingsInterface := func() {
+    showSettingsInterface = func() {
         // Show information dialog
         dialog.ShowInformation(
             "Configuration Required",
@@ -886,456 +779,1078 @@ func main() {
         mainMenu := fyne.NewMainMenu(
             fyne.NewMenu("Settings",
                 fyne.NewMenuItem("MailInABox server", func() {
-                    showSettingsDialog(window, settings, func(newSettings Settings) {
-                        settings = newSettings
-                        // After saving settings, restart the application
-                        dialog.ShowInformation(
-                            "Settings Saved",
-                            "Settings have been saved. Please restart the application.",
-                            window,
-                        )
+                    showSettingsDialog(window, store.Get(), func(newSettings Settings) {
+                        store.Set(newSettings)
+                        // Connect with new settings right away
+                        go startMailbox()
                     })
                 }),
             ),
+            newHelpMenu(),
         )
 
         window.SetMainMenu(mainMenu)
-        window.Resize(fyne.NewSize(500, 600))
-        window.CenterOnScreen()
-        window.ShowAndRun()
+        window.SetContent(widget.NewLabel("Mail-in-a-Box server is not configured"))
     }
 
-    // Handle settings and initialization errors
-    if err != nil {
-        showSettingsInterface()
-        return
-    }
+    // Held while mailbox is created and forever after main interface is
+    // shown, so saving settings twice doesn't start second mailbox
+    var starting sync.Mutex
 
-    // Try to create temporary mailbox
-    mailbox, err := NewTempMailbox(
-        settings.ApiURL,
-        settings.AdminEmail,
-        settings.AdminPassword,
-        settings.Domain,
-        settings.ImapServer,
-    )
-    if err != nil {
-        log.Printf("Error creating temporary mailbox: %v\n", err)
-        showSettingsInterface()
-        return
-    }
+    // Create mailbox on active profile and show main interface. Settings-only
+    // interface is shown when server can't be used
+    startMailbox = func() {
+        if !starting.TryLock() {
+            return
+        }
+        settings := store.Get()
+        window.SetContent(container.NewVBox(
+            widget.NewLabel("Creating mailbox..."),
+            widget.NewProgressBarInfinite(),
+        ))
+
+        // Try to create temporary mailbox
+        created, err := newMailbox(settings, settings.Profile())
+        if err != nil {
+            slog.Error("Error creating temporary mailbox", "error", err)
+            starting.Unlock()
+            showSettingsInterface()
+            return
+        }
 
-    if err := mailbox.Create(); err != nil {
-        log.Printf("Error creating mailbox: %v\n", err)
-        showSettingsInterface()
-        return
-    }
+        createCtx, cancelCreate := context.WithTimeout(context.Background(), settings.operationTimeout())
+        err = created.Create(createCtx)
+        cancelCreate()
+        audit.RecordResult(ActorGUI, AuditMailboxCreate, created.Address(), err, "startup")
+        if err != nil {
+            slog.Error("Error creating mailbox", "error", err)
+            starting.Unlock()
+            showSettingsInterface()
+            return
+        }
+        currentMailbox.Store(created)
+        publishEvent(newMailEvent(EventMailboxCreated, created.Address()))
+
+        // Guards mailboxProfile, emails, knownUIDs, selectedUIDs and
+        // quotaWarned, which background operations change and handlers
+        // read, and rebuilds of emailsList. Taken before updateUI
+        var state sync.Mutex
+
+        // Profile of server hosting current mailbox
+        mailboxProfile := settings.Profile()
+        currentProfile := func() ServerProfile {
+            state.Lock()
+            defer state.Unlock()
+            return mailboxProfile
+        }
 
-    // Continue with normal application initialization
-    // Create loading indicator
-    progress := widget.NewProgressBarInfinite()
-    progress.Hide()
+        // Return saved version of current profile, it may have been edited
+        // since mailbox was created
+        savedProfile := func() ServerProfile {
+            profile := currentProfile()
+            if saved, ok := store.Get().findProfile(profile.Name); ok {
+                return saved
+            }
+            return profile
+        }
 
-    // Create fields for displaying mailbox information
-    emailEntry := widget.NewEntry()
-    emailEntry.SetText(fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain))
-    emailEntry.Disable()
-    emailEntry.Resize(fyne.NewSize(200, 36))
+        // Continue with normal application initialization
+        // Create indicator of running operations with cancel button
+        operations := newOperationBar()
+
+        // Message list is refreshed only by poller, so checks never overlap.
+        // Other code asks for refresh, which runs even with automatic update
+        // off or paused
+        refreshNow := make(chan struct{}, 1)
+        requestRefresh := func() {
+            select {
+            case refreshNow <- struct{}{}:
+            default:
+            }
+        }
 
-    passwordEntry := widget.NewEntry()
-    passwordEntry.SetText(mailbox.Password)
-    passwordEntry.Disable()
-    passwordEntry.Resize(fyne.NewSize(200, 36))
+        // Pause automatic updates after repeated failures and show banner
+        var updateEmails func()
+        var breaker *circuitBreaker
+        banner := newBreakerBanner(func() {
+            breaker.Reset()
+            requestRefresh()
+        })
+        breaker = newCircuitBreaker(settings.breakerThreshold(), settings.breakerCooldown(), func(state breakerState) {
+            if state.Open {
+                slog.Warn("Pausing automatic updates", "error", state.Err)
+            }
+            banner.Update(state)
+        })
+
+        // Create fields for displaying mailbox information
+        emailEntry := widget.NewEntry()
+        emailEntry.SetText(created.Address())
+        emailEntry.Disable()
+        emailEntry.Resize(fyne.NewSize(200, 36))
+
+        passwordEntry := widget.NewEntry()
+        passwordEntry.SetText(created.Password)
+        passwordEntry.Disable()
+        passwordEntry.Resize(fyne.NewSize(200, 36))
+
+        // Create copy buttons
+        copyEmailBtn := widget.NewButton("Copy Email", func() {
+            window.Clipboard().SetContent(emailEntry.Text)
+        })
+
+        copyPassBtn := widget.NewButton("Copy Password", func() {
+            window.Clipboard().SetContent(passwordEntry.Text)
+        })
+
+        // Create copy containers with copy buttons
+        emailBox := container.NewHBox(
+            container.NewGridWrap(fyne.NewSize(200, 36), emailEntry),
+            copyEmailBtn,
+        )
+        passwordBox := container.NewHBox(
+            container.NewGridWrap(fyne.NewSize(200, 36), passwordEntry),
+            copyPassBtn,
+        )
 
-    // Create copy buttons
-    copyEmailBtn := widget.NewButton("Copy Email", func() {
-        window.Clipboard().SetContent(emailEntry.Text)
-    })
+        // Create check box for automatic update
+        autoUpdateCheck := widget.NewCheck("Automatic update", nil)
+        autoUpdateCheck.SetChecked(!settings.DisableAutoUpdate)
 
-    copyPassBtn := widget.NewButton("Copy Password", func() {
-        window.Clipboard().SetContent(passwordEntry.Text)
-    })
+        // Create check box for notifications
+        notificationsCheck := widget.NewCheck("Notifications", nil)
+        notificationsCheck.SetChecked(!settings.DisableNotifications)
 
-    // Create copy containers with copy buttons
-    emailBox := container.NewHBox(
-        container.NewGridWrap(fyne.NewSize(200, 36), emailEntry),
-        copyEmailBtn,
-    )
-    passwordBox := container.NewHBox(
-        container.NewGridWrap(fyne.NewSize(200, 36), passwordEntry),
-        copyPassBtn,
-    )
+        // Create slider for update period (5 to 60 seconds)
+        updatePeriodSlider := widget.NewSlider(minUpdatePeriod, maxUpdatePeriod)
+        updatePeriodSlider.SetValue(settings.updatePeriod().Seconds())
+        updatePeriodLabel := widget.NewLabel(fmt.Sprintf("Update period: %.0f sec", updatePeriodSlider.Value))
+        updatePeriodSlider.OnChanged = func(value float64) {
+            updatePeriodLabel.SetText(fmt.Sprintf("Update period: %.0f sec", value))
+        }
 
-    // Create check box for automatic update
-    autoUpdateCheck := widget.NewCheck("Automatic update", nil)
-    autoUpdateCheck.SetChecked(true)
+        // Create manual update button, enabled only when automatic update is off
+        updateButton := widget.NewButton("Update", nil)
+        if !settings.DisableAutoUpdate {
+            updateButton.Disable()
+        }
 
-    // Create check box for notifications
-    notificationsCheck := widget.NewCheck("Notifications", nil)
-    notificationsCheck.SetChecked(true)
+        // Save changed update settings, widgets are updated by listener
+        // when settings change elsewhere
+        saveUpdateSettings := func(change func(*Settings)) {
+            if err := store.Update(change); err != nil {
+                slog.Error("Error saving settings", "error", err)
+                dialog.ShowError(fmt.Errorf("Error saving settings: %v", err), window)
+            }
+        }
 
-    // Create slider for update period (5 to 60 seconds)
-    updatePeriodSlider := widget.NewSlider(5, 60)
-    updatePeriodSlider.SetValue(5)
-    updatePeriodLabel := widget.NewLabel("Update period: 5 sec")
-    updatePeriodSlider.OnChanged = func(value float64) {
-        updatePeriodLabel.SetText(fmt.Sprintf("Update period: %.0f sec", value))
-    }
+        // Create container for update management
+        container.NewVBox(
+            container.NewHBox(
+                autoUpdateCheck,
+                updateButton,
+            ),
+            container.NewHBox(
+                notificationsCheck,
+            ),
+            updatePeriodLabel,
+            updatePeriodSlider,
+        )
 
-    // Create manual update button
-    updateButton := widget.NewButton("Update", nil)
-    updateButton.Disable() // Initially disabled, as automatic update is enabled
+        // Create list for displaying messages
+        var emails []tempmail.Email
 
-    // Create container for update management
-    container.NewVBox(
-        container.NewHBox(
-            autoUpdateCheck,
-            updateButton,
-        ),
-        container.NewHBox(
-            notificationsCheck,
-        ),
-        updatePeriodLabel,
-        updatePeriodSlider,
-    )
+        // UIDs of messages already shown to the user, used to detect new
+        // mail. Mailboxes are always freshly created, so everything found by
+        // first check is new, such as verification mail arriving right away
+        knownUIDs := map[uint32]bool{}
 
-    // Create list for displaying messages
-    var emails []Email
+        // UIDs of messages selected for export
+        selectedUIDs := map[uint32]bool{}
     
-    // Use VBox instead of GridWrap for better adaptability
-    emailsList := container.NewVBox()
+        // Use VBox instead of GridWrap for better adaptability
+        emailsList := container.NewVBox()
+
+        // Create bar offering to undo deletion
+        undo := newUndoBar()
+
+        // Messages update function
+        var updateEmailsList func([]tempmail.Email)
+
+        // Show storage usage and warn or purge oldest messages when
+        // mailbox gets near its quota
+        quota := newQuotaIndicator()
+        quotaWarned := false
+        checkQuota := func() {
+            mailbox := currentMailbox.Load()
+            ctx, cancel := context.WithTimeout(context.Background(), store.Get().operationTimeout())
+            defer cancel()
+
+            usage, err := mailbox.Quota(ctx)
+            if errors.Is(err, tempmail.ErrQuotaUnsupported) {
+                updateUI(quota.Hide)
+                return
+            }
+            if err != nil {
+                slog.Error("Error checking quota", "error", err)
+                return
+            }
 
-    // Create delete all button
-    deleteAllButton := widget.NewButton("Delete all mails", func() {
-        progress.Show()
-        if err := mailbox.DeleteAllMails(); err != nil {
-            log.Printf("Error deleting mails: %v\n", err)
-            dialog.ShowError(fmt.Errorf("Error deleting mails: %v", err), window)
-        } else {
-            // Clear message list in interface
-            emails = []Email{}
-            emailsList.Objects = nil
-            emailsList.Refresh()
+            settings := store.Get()
+            warnPercent := settings.quotaWarnPercent()
+            if usage.Limit > 0 && usage.Percent() >= warnPercent {
+                if settings.QuotaAutoPurge {
+                    purged, err := mailbox.PurgeOldest(ctx, settings.quotaPurgeTarget(usage))
+                    if err != nil {
+                        slog.Error("Error purging oldest messages", "error", err)
+                    }
+                    if purged > 0 || err != nil {
+                        audit.RecordResult(ActorJanitor, AuditMessagePurge, mailbox.Address(), err,
+                            fmt.Sprintf("%d oldest messages deleted to fit quota of %s", purged, formatBytes(usage.Limit)))
+                    }
+                    if purged > 0 {
+                        myApp.SendNotification(fyne.NewNotification("Mailbox almost full",
+                            fmt.Sprintf("Deleted %d oldest messages to stay within quota", purged)))
+                        if updated, err := mailbox.Quota(ctx); err == nil {
+                            usage = updated
+                        }
+                        requestRefresh()
+                    }
+                } else {
+                    state.Lock()
+                    warn := !quotaWarned
+                    quotaWarned = true
+                    state.Unlock()
+                    if warn {
+                        myApp.SendNotification(fyne.NewNotification("Mailbox almost full",
+                            fmt.Sprintf("%s of %s used", formatBytes(usage.Used), formatBytes(usage.Limit))))
+                    }
+                }
+            } else {
+                state.Lock()
+                quotaWarned = false
+                state.Unlock()
+            }
+            updateUI(func() {
+                quota.Update(usage, warnPercent)
+            })
         }
-        progress.Hide()
-    })
 
-    // Messages update function
-    var updateEmailsList func([]Email)
-    updateEmailsList = func(newEmails []Email) {
-        emailsList.Objects = nil // Clear list
-        
-        for _, email := range newEmails {
-            email := email // Create new variable for closure
-            
-            // Create labels for headers
-            fromLabel := widget.NewLabelWithStyle(
-                "From: "+email.From,
-                fyne.TextAlignLeading,
-                fyne.TextStyle{Bold: true},
+        // Offer undo for messages moved to trash. Server without UIDPLUS
+        // doesn't report their UIDs in trash, then undo is unavailable
+        showUndo := func(text string, trashUIDs []uint32) {
+            if len(trashUIDs) == 0 {
+                undo.Show(text+", undo unavailable", nil)
+                return
+            }
+            undoMailbox := currentMailbox.Load()
+            undo.Show(text, func() {
+                go func() {
+                    ctx, done := operations.Start("Restoring messages...", store.Get().operationTimeout())
+                    err := undoMailbox.RestoreMails(ctx, trashUIDs)
+                    done()
+                    if err != nil {
+                        slog.Error("Error restoring messages", "error", err)
+                        if !cancelled(ctx) {
+                            dialog.ShowError(fmt.Errorf("Error restoring messages: %v", err), window)
+                        }
+                        return
+                    }
+                    if undoMailbox == currentMailbox.Load() {
+                        requestRefresh()
+                    }
+                }()
+            })
+        }
+
+        // Create delete all button
+        deleteAllButton := widget.NewButton("Delete all mails", func() {
+            dialog.ShowConfirm(
+                "Confirmation",
+                "Move all mails to trash?",
+                func(confirmed bool) {
+                    if !confirmed {
+                        return
+                    }
+                    // Run in background so hung server doesn't freeze the window
+                    mailbox := currentMailbox.Load()
+                    go func() {
+                        ctx, done := operations.Start("Deleting all mails...", store.Get().operationTimeout())
+                        defer done()
+
+                        moved, trashUIDs, err := mailbox.DeleteAllMails(ctx)
+                        audit.RecordResult(ActorGUI, AuditMessageDeleteAll, mailbox.Address(), err,
+                            fmt.Sprintf("%d messages moved to trash", moved))
+                        if err != nil {
+                            slog.Error("Error deleting mails", "error", err)
+                            if !cancelled(ctx) {
+                                dialog.ShowError(fmt.Errorf("Error deleting mails: %v", err), window)
+                            }
+                            return
+                        }
+                        // Clear message list in interface
+                        state.Lock()
+                        emails = []tempmail.Email{}
+                        updateUI(func() {
+                            emailsList.Objects = nil
+                            emailsList.Refresh()
+                        })
+                        state.Unlock()
+                        showUndo(fmt.Sprintf("%d messages moved to trash", moved), trashUIDs)
+                    }()
+                },
+                window,
             )
-            fromLabel.Wrapping = fyne.TextWrapWord
+        })
+        // Rebuild message list, called with state held
+        updateEmailsList = func(newEmails []tempmail.Email) {
+            // Buttons act on mailbox the messages were read from
+            mailbox := currentMailbox.Load()
+            var cards []fyne.CanvasObject
+        
+            for _, email := range newEmails {
+                email := email // Create new variable for closure
             
-            subjectLabel := widget.NewLabelWithStyle(
-                "Subject: "+email.Subject,
-                fyne.TextAlignLeading,
-                fyne.TextStyle{Bold: true},
-            )
-            subjectLabel.Wrapping = fyne.TextWrapWord
+                // Create delete button
+                deleteBtn := widget.NewButton("Delete", func() {
+                    go func() {
+                        ctx, done := operations.Start("Deleting message...", store.Get().operationTimeout())
+                        trashUIDs, err := mailbox.DeleteMail(ctx, email.UID)
+                        done()
+                        audit.RecordResult(ActorGUI, AuditMessageDelete, mailbox.Address(), err, fmt.Sprintf("UID %d", email.UID))
+                        if err != nil {
+                            slog.Error("Error deleting message", "error", err)
+                            if !cancelled(ctx) {
+                                dialog.ShowError(fmt.Errorf("Error deleting message: %v", err), window)
+                            }
+                            return
+                        }
+                        showUndo("Message moved to trash", trashUIDs)
+                        // Get new message list
+                        requestRefresh()
+                    }()
+                })
 
-            // Create delete button
-            deleteBtn := widget.NewButton("Delete", func() {
-                progress.Show()
-                if err := mailbox.DeleteMail(email.UID); err != nil {
-                    log.Printf("Error deleting message: %v\n", err)
-                    dialog.ShowError(fmt.Errorf("Error deleting message: %v", err), window)
-                    progress.Hide()
-                    return
-                }
-                // Get new message list
-                newEmails, err := mailbox.CheckMail()
-                if err != nil {
-                    log.Printf("Error updating message list: %v\n", err)
-                    dialog.ShowError(fmt.Errorf("Error updating message list: %v", err), window)
-                    progress.Hide()
-                    return
+                // Create read state button
+                readBtnText := "Mark read"
+                if email.Seen {
+                    readBtnText = "Mark unread"
                 }
-                emails = newEmails
-                updateEmailsList(emails)
-                progress.Hide()
-            })
+                readBtn := widget.NewButton(readBtnText, func() {
+                    go func() {
+                        ctx, done := operations.Start("Changing read state...", store.Get().operationTimeout())
+                        defer done()
+
+                        var err error
+                        if email.Seen {
+                            err = mailbox.MarkUnread(ctx, email.UID)
+                        } else {
+                            err = mailbox.MarkRead(ctx, email.UID)
+                        }
+                        if err != nil {
+                            slog.Error("Error changing read state", "error", err)
+                            if !cancelled(ctx) {
+                                dialog.ShowError(fmt.Errorf("Error changing read state: %v", err), window)
+                            }
+                            return
+                        }
+                        state.Lock()
+                        defer state.Unlock()
+                        for i := range emails {
+                            if emails[i].UID == email.UID {
+                                emails[i].Seen = !email.Seen
+                            }
+                        }
+                        updateEmailsList(emails)
+                    }()
+                })
 
-            // Create switch between HTML and text representation
-            var content *widget.Entry
-            var htmlView *widget.RichText
-
-            content = widget.NewMultiLineEntry()
-            content.SetText(email.Content)
-            content.Disable()
-            content.Wrapping = fyne.TextWrapWord
-            content.TextStyle = fyne.TextStyle{Bold: true}
-            content.SetMinRowsVisible(8)
-
-            htmlView = widget.NewRichTextFromMarkdown(email.HTMLContent)
-            htmlView.Wrapping = fyne.TextWrapWord
-            htmlView.Hide()
-
-            viewTypeBtn := widget.NewButton("Switch view", func() {
-                if content.Visible() {
-                    content.Hide()
-                    htmlView.Show()
-                } else {
-                    htmlView.Hide()
-                    content.Show()
+                // Create star button
+                starBtnText := "Star"
+                if email.Flagged {
+                    starBtnText = "Unstar"
                 }
-            })
+                starBtn := widget.NewButton(starBtnText, func() {
+                    go func() {
+                        ctx, done := operations.Start("Changing star...", store.Get().operationTimeout())
+                        defer done()
+
+                        if err := mailbox.SetFlagged(ctx, email.UID, !email.Flagged); err != nil {
+                            slog.Error("Error changing star", "error", err)
+                            if !cancelled(ctx) {
+                                dialog.ShowError(fmt.Errorf("Error changing star: %v", err), window)
+                            }
+                            return
+                        }
+                        state.Lock()
+                        defer state.Unlock()
+                        for i := range emails {
+                            if emails[i].UID == email.UID {
+                                emails[i].Flagged = !email.Flagged
+                            }
+                        }
+                        updateEmailsList(emails)
+                    }()
+                })
 
-            // Create content container
-            contentBox := container.NewVBox(
-                content,
-                htmlView,
-            )
+                // Create reply button
+                replyBtn := widget.NewButton("Reply", func() {
+                    showComposeWindow(myApp, mailbox, tempmail.NewReply(email), store.Get().operationTimeout())
+                })
 
-            // Create card for message with adaptive size
-            card := widget.NewCard(
-                "",
-                "",
-                container.NewVBox(
-                    container.NewPadded(
-                        container.NewVBox(
-                            fromLabel,
-                            subjectLabel,
-                            widget.NewSeparator(),
-                            contentBox,
-                            container.NewHBox(
-                                viewTypeBtn,
-                                layout.NewSpacer(),
-                                deleteBtn,
-                            ),
-                        ),
-                    ),
-                ),
-            )
+                // Create export button
+                exportBtn := widget.NewButton("Export", func() {
+                    saveEmailAsEML(window, email)
+                })
+
+                // Create check box for selecting message for bulk export.
+                // Handler is set after initial state, list is rebuilt with
+                // state held
+                selectCheck := widget.NewCheck("", nil)
+                selectCheck.SetChecked(selectedUIDs[email.UID])
+                selectCheck.OnChanged = func(checked bool) {
+                    state.Lock()
+                    defer state.Unlock()
+                    if checked {
+                        selectedUIDs[email.UID] = true
+                    } else {
+                        delete(selectedUIDs, email.UID)
+                    }
+                }
+
+                card := newEmailCard(
+                    email,
+                    []fyne.CanvasObject{selectCheck},
+                    []fyne.CanvasObject{readBtn, starBtn, replyBtn, exportBtn, layout.NewSpacer(), deleteBtn},
+                )
             
-            emailsList.Add(container.NewPadded(card))
+                cards = append(cards, container.NewPadded(card))
+            }
+            updateUI(func() {
+                emailsList.Objects = cards
+                emailsList.Refresh()
+            })
         }
-        emailsList.Refresh()
-    }
 
-    // Messages update function
-    updateEmails := func() {
-        progress.Show()
-        newEmails, err := mailbox.CheckMail()
-        if err != nil {
-            log.Printf("Error checking mail: %v\n", err)
-            progress.Hide()
-            return
+        // Show mailbox that replaced current one, with empty message list
+        showMailbox := func(mailbox *tempmail.TempMailbox, profile ServerProfile) {
+            state.Lock()
+            defer state.Unlock()
+            currentMailbox.Store(mailbox)
+            mailboxProfile = profile
+            emails = []tempmail.Email{}
+            knownUIDs = map[uint32]bool{}
+            selectedUIDs = map[uint32]bool{}
+            updateUI(func() {
+                emailsList.Objects = nil
+                emailsList.Refresh()
+                emailEntry.SetText(mailbox.Address())
+                passwordEntry.SetText(mailbox.Password)
+            })
+            requestRefresh()
         }
 
-        log.Printf("Found messages: %d\n", len(newEmails))
+        // Messages update function, run only by poller
+        updateEmails = func() {
+            mailbox := currentMailbox.Load()
+            ctx, done := operations.Start("Checking mail...", store.Get().operationTimeout())
+            defer done()
+
+            newEmails, err := mailbox.CheckMail(ctx)
+            if err != nil {
+                slog.Error("Error checking mail", "error", err)
+                if !cancelled(ctx) {
+                    breaker.Failure(err)
+                }
+                return
+            }
+            breaker.Success()
+
+            slog.Debug("Found messages", "messages", len(newEmails))
 
-        if len(newEmails) > 0 {
-            // Check if there are new messages
-            if len(newEmails) > len(emails) && notificationsCheck.Checked {
-                // Get new message count
-                newCount := len(newEmails) - len(emails)
+            // Check if there are new unseen messages. Messages of mailbox
+            // replaced during check are not shown, known UIDs belong to the
+            // new one
+            state.Lock()
+            if mailbox != currentMailbox.Load() {
+                state.Unlock()
+                return
+            }
+            freshEmails := detectNewEmails(knownUIDs, newEmails)
+            state.Unlock()
+            for _, email := range freshEmails {
+                publishEvent(newMessageEvent(mailbox.Address(), email))
+            }
+
+            // Run mail rules, messages deleted by rules are not shown or
+            // notified about
+            if mailRules := store.Get().Rules; len(mailRules) > 0 {
+                var kept []tempmail.Email
+                for _, email := range freshEmails {
+                    result := rules.Apply(ctx, mailRules, mailbox, email)
+                    if result.Deleted {
+                        newEmails = removeEmail(newEmails, email.UID)
+                        continue
+                    }
+                    if result.Read {
+                        newEmails = markEmailSeen(newEmails, email.UID)
+                    }
+                    kept = append(kept, email)
+                }
+                freshEmails = kept
+            }
+
+            if len(freshEmails) > 0 {
+                go checkQuota()
+            }
+
+            if len(freshEmails) > 0 && !store.Get().DisableNotifications {
+                text := fmt.Sprintf("Received %d new messages", len(freshEmails))
+                if len(freshEmails) == 1 {
+                    text = fmt.Sprintf("%s: %s", freshEmails[0].From, freshEmails[0].Subject)
+                }
                 // Send notification
-                notification := fyne.NewNotification(
-                    "New messages",
-                    fmt.Sprintf("Received %d new messages", newCount),
-                )
+                notification := fyne.NewNotification("New messages", text)
                 myApp.SendNotification(notification)
-                log.Printf("Sent notification about %d new messages\n", newCount)
+                slog.Info("Sent notification about new messages", "mailbox", mailbox.Address(), "messages", len(freshEmails))
             }
-            
+            state.Lock()
+            if mailbox != currentMailbox.Load() {
+                state.Unlock()
+                return
+            }
+            removed := detectRemovedEmails(knownUIDs, newEmails)
             emails = newEmails
-            window.Canvas().Refresh(emailsList)
             updateEmailsList(emails)
+            state.Unlock()
+            for _, uid := range removed {
+                publishEvent(newMessageDeletedEvent(mailbox.Address(), uid))
+            }
         }
-        
-        progress.Hide()
-    }
 
-    // Set handlers
-    updateButton.OnTapped = updateEmails
-    autoUpdateCheck.OnChanged = func(checked bool) {
-        updateButton.Disable()
-        if !checked {
-            updateButton.Enable()
+        // Set handlers
+        updateButton.OnTapped = requestRefresh
+        autoUpdateCheck.OnChanged = func(checked bool) {
+            updateButton.Disable()
+            if !checked {
+                updateButton.Enable()
+            }
+            if checked == store.Get().DisableAutoUpdate {
+                saveUpdateSettings(func(s *Settings) { s.DisableAutoUpdate = !checked })
+            }
+        }
+        notificationsCheck.OnChanged = func(checked bool) {
+            if checked == store.Get().DisableNotifications {
+                saveUpdateSettings(func(s *Settings) { s.DisableNotifications = !checked })
+            }
+        }
+        updatePeriodSlider.OnChangeEnded = func(value float64) {
+            if int(value) != int(store.Get().updatePeriod().Seconds()) {
+                saveUpdateSettings(func(s *Settings) { s.UpdatePeriod = int(value) })
+            }
         }
-    }
 
-    // Create container for mailbox information
-    infoBox := container.NewVBox(
-        widget.NewLabelWithStyle("Email:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-        container.NewHBox(
-            container.NewMax(emailBox),
-            layout.NewSpacer(),
-        ),
-        widget.NewLabelWithStyle("Password:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-        container.NewHBox(
-            container.NewMax(passwordBox),
-            layout.NewSpacer(),
-        ),
-        widget.NewSeparator(),
-        container.NewHBox(
-            deleteAllButton,
-            layout.NewSpacer(),
-            updateButton,
-        ),
-        progress,
-    )
+        // Create container for mailbox information
+        infoBox := container.NewVBox(
+            banner.Container,
+            widget.NewLabelWithStyle("Email:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+            container.NewHBox(
+                container.NewMax(emailBox),
+                layout.NewSpacer(),
+            ),
+            widget.NewLabelWithStyle("Password:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+            container.NewHBox(
+                container.NewMax(passwordBox),
+                layout.NewSpacer(),
+            ),
+            widget.NewSeparator(),
+            container.NewHBox(
+                deleteAllButton,
+                widget.NewButton("Forwarding", func() {
+                    showForwardingDialog(window, currentMailbox.Load(), operations, store.Get().operationTimeout())
+                }),
+                widget.NewButton("Filters", func() {
+                    showSieveWindow(myApp, currentMailbox.Load(), store.Get().operationTimeout())
+                }),
+                widget.NewButton("Retention", func() {
+                    showRetentionDialog(window, currentMailbox.Load().Address(), store.Get(), currentProfile(), store.Update)
+                }),
+                layout.NewSpacer(),
+                updateButton,
+            ),
+            quota.Container,
+            operations.Container,
+        )
+        go checkQuota()
 
-    // Create scrollable container for messages with adaptive size
-    scrollContainer := container.NewScroll(container.NewPadded(emailsList))
+        // Create scrollable container for messages with adaptive size
+        scrollContainer := container.NewScroll(container.NewPadded(emailsList))
     
-    // Create main container with adaptive layout
-    content := container.NewBorder(
-        infoBox,
-        nil,
-        nil,
-        nil,
-        scrollContainer,
-    )
+        // Create main container with adaptive layout
+        content := container.NewBorder(
+            infoBox,
+            undo.Container,
+            nil,
+            nil,
+            scrollContainer,
+        )
 
-    // Create main menu
-    mainMenu := fyne.NewMainMenu(
-        fyne.NewMenu("File",
-            fyne.NewMenuItem("Create new mailbox", func() {
-                progress.Show()
-                if err := mailbox.Delete(); err != nil {
-                    log.Printf("Error deleting mailbox: %v\n", err)
-                }
-                if err := mailbox.Create(); err != nil {
-                    log.Printf("Error creating new mailbox: %v\n", err)
-                    progress.Hide()
-                    return
+        // Status of server hosting current mailbox, checked in background.
+        // Notification is sent when status check turns red
+        monitor := newStatusMonitor()
+        statusWake := make(chan struct{}, 1)
+        wakeStatus := func() {
+            select {
+            case statusWake <- struct{}{}:
+            default:
+            }
+        }
+        checkServerStatus := func() {
+            ctx, cancel := context.WithTimeout(context.Background(), store.Get().operationTimeout())
+            defer cancel()
+
+            turnedRed, err := monitor.Refresh(ctx, currentProfile().Name, currentMailbox.Load())
+            if err != nil {
+                slog.Error("Error checking server status", "error", err)
+                return
+            }
+            if len(turnedRed) > 0 && !store.Get().DisableNotifications {
+                text := fmt.Sprintf("%d status checks failed", len(turnedRed))
+                if len(turnedRed) == 1 {
+                    text = fmt.Sprintf("%s: %s", turnedRed[0].Section, turnedRed[0].Text)
                 }
-                emails = []Email{}
-                emailsList.Objects = nil
-                emailsList.Refresh()
-                emailEntry.SetText(fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain))
-                passwordEntry.SetText(mailbox.Password)
-                progress.Hide()
-            }),
-            fyne.NewMenuItem("Create additional mailbox", func() {
-                progress.Show()
-                currentEmail := fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain)
-                if err := saveMailboxToFile(currentEmail, mailbox.Password); err != nil {
-                    log.Printf("Error saving mailbox: %v\n", err)
-                    dialog.ShowError(fmt.Errorf("Error saving mailbox: %v", err), window)
-                    progress.Hide()
-                    return
+                myApp.SendNotification(fyne.NewNotification("Server status", text))
+                slog.Info("Sent notification about failed status checks", "checks", len(turnedRed))
+            }
+        }
+
+        // Delete messages not allowed by retention policy of mailbox and
+        // record them in audit log
+        retentionWake := make(chan struct{}, 1)
+        enforceRetention := func() {
+            settings := store.Get()
+            profile := savedProfile()
+            mailbox := currentMailbox.Load()
+            address := mailbox.Address()
+            policy := settings.retention(profile, address).policy()
+            if !policy.Enabled() {
+                return
+            }
+
+            ctx, cancel := context.WithTimeout(context.Background(), settings.operationTimeout())
+            defer cancel()
+
+            removed, err := mailbox.EnforceRetention(ctx, policy)
+            for _, message := range removed {
+                audit.Record(auditEntry{
+                    Actor:   ActorJanitor,
+                    Action:  AuditMessageDelete,
+                    Target:  address,
+                    Outcome: OutcomeSuccess,
+                    Detail: fmt.Sprintf("%s UID %d received %s, Message-ID %s, policy: %s",
+                        message.Folder, message.UID, message.Received.UTC().Format(time.RFC3339), message.MessageID, policy),
+                })
+            }
+            if err != nil {
+                slog.Error("Error enforcing retention", "error", err)
+                audit.Record(auditEntry{
+                    Actor:   ActorJanitor,
+                    Action:  AuditMessageDelete,
+                    Target:  address,
+                    Outcome: OutcomeFailure,
+                    Detail:  fmt.Sprintf("policy: %s: %v", policy, err),
+                })
+            }
+            if len(removed) > 0 {
+                slog.Info("Retention removed messages", "mailbox", address, "messages", len(removed))
+                requestRefresh()
+            }
+        }
+
+        // Replace current mailbox with new one on the same server, on domain
+        // chosen by profile when domain is empty
+        createNewMailbox := func(domain string) {
+            go func() {
+                ctx, done := operations.Start("Creating new mailbox...", store.Get().operationTimeout())
+                defer done()
+
+                mailbox := currentMailbox.Load()
+                err := mailbox.Delete(ctx)
+                audit.RecordResult(ActorGUI, AuditMailboxDelete, mailbox.Address(), err, "replaced by new mailbox")
+                if err != nil {
+                    slog.Error("Error deleting mailbox", "error", err)
+                } else {
+                    publishEvent(newMailEvent(EventMailboxDeleted, mailbox.Address()))
                 }
-                if err := mailbox.Create(); err != nil {
-                    log.Printf("Error creating new mailbox: %v\n", err)
+
+                // New mailbox object, operations running on the old one
+                // keep its credentials
+                profile := savedProfile()
+                created, err := newMailbox(store.Get(), profile)
+                if err != nil {
                     dialog.ShowError(fmt.Errorf("Error creating new mailbox: %v", err), window)
-                    progress.Hide()
                     return
                 }
-                emails = []Email{}
-                emailsList.Objects = nil
-                emailsList.Refresh()
-                emailEntry.SetText(fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain))
-                passwordEntry.SetText(mailbox.Password)
-                dialog.ShowInformation("Success", "Previous mailbox saved to saved_mailboxes.txt", window)
-                progress.Hide()
-            }),
-        ),
-        fyne.NewMenu("Settings",
-            fyne.NewMenuItem("MailInABox server", func() {
-                showSettingsDialog(window, settings, func(newSettings Settings) {
-                    settings = newSettings
-                    if err := mailbox.Delete(); err != nil {
-                        log.Printf("Error deleting mailbox: %v\n", err)
-                    }
-                    newMailbox, err := NewTempMailbox(
-                        settings.ApiURL,
-                        settings.AdminEmail,
-                        settings.AdminPassword,
-                        settings.Domain,
-                        settings.ImapServer,
-                    )
-                    if err != nil {
-                        dialog.ShowError(fmt.Errorf("Error creating mailbox: %v", err), window)
-                        return
+                if domain == "" {
+                    err = created.Create(ctx)
+                } else {
+                    err = created.CreateOnDomain(ctx, domain)
+                }
+                audit.RecordResult(ActorGUI, AuditMailboxCreate, created.Address(), err, "")
+                if err != nil {
+                    slog.Error("Error creating new mailbox", "error", err)
+                    if !cancelled(ctx) {
+                        dialog.ShowError(fmt.Errorf("Error creating new mailbox: %v", err), window)
                     }
-                    if err := newMailbox.Create(); err != nil {
-                        dialog.ShowError(fmt.Errorf("Error creating mailbox: %v", err), window)
+                    return
+                }
+                publishEvent(newMailEvent(EventMailboxCreated, created.Address()))
+                showMailbox(created, profile)
+            }()
+        }
+
+        // Replace current mailbox with new one created on server profile
+        switchMailbox := func(text string, profile ServerProfile) {
+            ctx, done := operations.Start(text, store.Get().operationTimeout())
+            defer done()
+
+            mailbox := currentMailbox.Load()
+            err := mailbox.Delete(ctx)
+            audit.RecordResult(ActorGUI, AuditMailboxDelete, mailbox.Address(), err, "switched to profile "+profile.Name)
+            if err != nil {
+                slog.Error("Error deleting mailbox", "error", err)
+            } else {
+                publishEvent(newMailEvent(EventMailboxDeleted, mailbox.Address()))
+            }
+            newMailbox, err := newMailbox(store.Get(), profile)
+            if err != nil {
+                dialog.ShowError(fmt.Errorf("Error creating mailbox: %v", err), window)
+                return
+            }
+            err = newMailbox.Create(ctx)
+            audit.RecordResult(ActorGUI, AuditMailboxCreate, newMailbox.Address(), err, "profile "+profile.Name)
+            if err != nil {
+                if !cancelled(ctx) {
+                    dialog.ShowError(fmt.Errorf("Error creating mailbox: %v", err), window)
+                }
+                return
+            }
+            publishEvent(newMailEvent(EventMailboxCreated, newMailbox.Address()))
+            showMailbox(newMailbox, profile)
+            wakeStatus()
+        }
+
+        // Profile switcher, rebuilt whenever profiles change
+        profilesMenu := fyne.NewMenu("Profiles")
+        refreshProfilesMenu := func() {
+            updateProfilesMenu(profilesMenu, store.Get(), func(name string) {
+                err := store.Update(func(s *Settings) {
+                    s.ActiveProfile = name
+                })
+                if err != nil {
+                    dialog.ShowError(err, window)
+                }
+            }, func() {
+                showProfilesDialog(window, store.Get(), store.Set)
+            })
+        }
+        refreshProfilesMenu()
+
+        // Create main menu
+        mainMenu := fyne.NewMainMenu(
+            fyne.NewMenu("File",
+                fyne.NewMenuItem("Compose", func() {
+                    showComposeWindow(myApp, currentMailbox.Load(), tempmail.OutgoingEmail{}, store.Get().operationTimeout())
+                }),
+                fyne.NewMenuItem("Trash", func() {
+                    trashMailbox := currentMailbox.Load()
+                    showTrashWindow(myApp, trashMailbox, audit, store.Get().operationTimeout(), func() {
+                        if trashMailbox == currentMailbox.Load() {
+                            requestRefresh()
+                        }
+                    })
+                }),
+                fyne.NewMenuItem("Audit log", func() {
+                    showAuditWindow(myApp, audit)
+                }),
+                fyne.NewMenuItem("Export to mbox", func() {
+                    state.Lock()
+                    selected := selectedEmails(emails, selectedUIDs)
+                    state.Unlock()
+                    saveEmailsAsMbox(window, selected)
+                }),
+                fyne.NewMenuItem("Export to Maildir", func() {
+                    state.Lock()
+                    selected := selectedEmails(emails, selectedUIDs)
+                    state.Unlock()
+                    saveEmailsAsMaildir(window, selected)
+                }),
+                fyne.NewMenuItem("Import messages", func() {
+                    importEmails(myApp, window)
+                }),
+                fyne.NewMenuItemSeparator(),
+                fyne.NewMenuItem("Create new mailbox", func() {
+                    go func() {
+                        // Offer domains hosted on server, profile domains are
+                        // used when server can't list them
+                        ctx, done := operations.Start("Loading domains...", store.Get().operationTimeout())
+                        domains, err := currentMailbox.Load().ServerDomains(ctx)
+                        done()
+                        if err != nil {
+                            slog.Error("Error loading domains", "error", err)
+                            if cancelled(ctx) {
+                                return
+                            }
+                            domains = currentProfile().Domains
+                        }
+                        showDomainPickerDialog(window, currentProfile(), domains, createNewMailbox)
+                    }()
+                }),
+                fyne.NewMenuItem("Create mailbox on profile", func() {
+                    showCreateOnProfileDialog(window, store.Get(), func(profile ServerProfile) {
+                        breaker.Reset()
+                        go switchMailbox(fmt.Sprintf("Creating mailbox on %s...", profile.Name), profile)
+                    })
+                }),
+                fyne.NewMenuItem("Create additional mailbox", func() {
+                    previous := currentMailbox.Load()
+                    if err := saveMailboxToFile(previous.Address(), previous.Password); err != nil {
+                        slog.Error("Error saving mailbox", "error", err)
+                        dialog.ShowError(fmt.Errorf("Error saving mailbox: %v", err), window)
                         return
                     }
-                    mailbox = newMailbox
-                    emails = []Email{}
-                    emailsList.Objects = nil
-                    emailsList.Refresh()
-                    emailEntry.SetText(fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain))
-                    passwordEntry.SetText(mailbox.Password)
-                })
-            }),
-            fyne.NewMenuItem("Update and notifications", func() {
-                // Create update settings dialog
-                updateSettingsContent := container.NewVBox(
-                    autoUpdateCheck,
-                    notificationsCheck,
-                    updatePeriodLabel,
-                    updatePeriodSlider,
-                )
-                updateDialog := dialog.NewCustom(
-                    "Update settings",
-                    "Close",
-                    container.NewPadded(updateSettingsContent),
-                    window,
-                )
-                updateDialog.Resize(fyne.NewSize(300, 200))
-                updateDialog.Show()
-            }),
-        ),
-    )
+                    go func() {
+                        ctx, done := operations.Start("Creating additional mailbox...", store.Get().operationTimeout())
+                        defer done()
 
-    window.SetMainMenu(mainMenu)
-    window.SetContent(content)
-    window.Resize(fyne.NewSize(500, 600))
-    window.CenterOnScreen()
+                        profile := savedProfile()
+                        created, err := newMailbox(store.Get(), profile)
+                        if err == nil {
+                            err = created.Create(ctx)
+                            audit.RecordResult(ActorGUI, AuditMailboxCreate, created.Address(), err, "previous mailbox saved")
+                        }
+                        if err != nil {
+                            slog.Error("Error creating new mailbox", "error", err)
+                            if !cancelled(ctx) {
+                                dialog.ShowError(fmt.Errorf("Error creating new mailbox: %v", err), window)
+                            }
+                            return
+                        }
+                        publishEvent(newMailEvent(EventMailboxCreated, created.Address()))
+                        showMailbox(created, profile)
+                        dialog.ShowInformation("Success", "Previous mailbox saved to "+paths.dataFile(savedMailboxesFile), window)
+                    }()
+                }),
+            ),
+            fyne.NewMenu("Settings",
+                fyne.NewMenuItem("MailInABox server", func() {
+                    showSettingsDialog(window, store.Get(), store.Set)
+                }),
+                fyne.NewMenuItem("Webhooks", func() {
+                    showWebhooksDialog(window, store.Get(), store.Update)
+                }),
+                fyne.NewMenuItem("Mail rules", func() {
+                    showRulesDialog(window, store.Get(), store.Update)
+                }),
+                fyne.NewMenuItem("Retry policy", func() {
+                    showRetrySettingsDialog(window, store.Get(), store.Update)
+                }),
+                fyne.NewMenuItem("Diagnostics", func() {
+                    showDiagnosticsDialog(window, store.Get(), currentProfile())
+                }),
+                fyne.NewMenuItem("Log out admin session", func() {
+                    go func() {
+                        ctx, done := operations.Start("Logging out...", store.Get().operationTimeout())
+                        defer done()
+
+                        if err := adminSessions.logout(ctx, currentProfile().Name); err != nil {
+                            dialog.ShowError(fmt.Errorf("Error logging out: %v", err), window)
+                            return
+                        }
+                        dialog.ShowInformation("Success", "Admin session closed, you will be asked to log in again", window)
+                    }()
+                }),
+                fyne.NewMenuItem("Local server", func() {
+                    showServerSettingsDialog(window, store.Get(), store.Update)
+                }),
+                fyne.NewMenuItem("Update and notifications", func() {
+                    // Create update settings dialog
+                    updateSettingsContent := container.NewVBox(
+                        autoUpdateCheck,
+                        notificationsCheck,
+                        updatePeriodLabel,
+                        updatePeriodSlider,
+                    )
+                    updateDialog := dialog.NewCustom(
+                        "Update settings",
+                        "Close",
+                        container.NewPadded(updateSettingsContent),
+                        window,
+                    )
+                    updateDialog.Resize(fyne.NewSize(300, 200))
+                    updateDialog.Show()
+                }),
+            ),
+            fyne.NewMenu("Server",
+                fyne.NewMenuItem("Mail users", func() {
+                    showUsersWindow(myApp, currentMailbox.Load(), currentProfile().AdminEmail, journal, audit, store.Get().operationTimeout(), publishEvent)
+                }),
+                fyne.NewMenuItem("Status", func() {
+                    showStatusWindow(myApp, monitor, store.Get(), currentProfile().Name, checkServerStatus, func(minutes int) {
+                        if err := store.Update(func(s *Settings) { s.StatusCheckPeriod = minutes }); err != nil {
+                            dialog.ShowError(err, window)
+                        }
+                    })
+                }),
+            ),
+            profilesMenu,
+            newHelpMenu(),
+        )
 
-    // Start mail checking in background mode
-    go func() {
-        time.Sleep(2 * time.Second)
+        window.SetMainMenu(mainMenu)
+        window.SetContent(content)
+
+        // Wakes poller when update settings change, so new period applies
+        // without waiting for the old one to pass
+        pollerWake := make(chan struct{}, 1)
+
+        // Apply changed settings to running mailbox and widgets
+        store.Subscribe(func(old, new Settings) {
+            mailbox := currentMailbox.Load()
+            mailbox.SetTimeouts(new.mailboxTimeouts())
+            mailbox.SetRetry(new.retryPolicies())
+            breaker.Configure(new.breakerThreshold(), new.breakerCooldown())
+            if !reflect.DeepEqual(old.Retry, new.Retry) || old.BreakerThreshold != new.BreakerThreshold ||
+                old.BreakerCooldown != new.BreakerCooldown {
+                breaker.Reset()
+            }
 
-        for {
-            if autoUpdateCheck.Checked {
-                updateEmails()
+            refreshProfilesMenu()
+            if !old.Profile().sameServer(new.Profile()) {
+                breaker.Reset()
+                go switchMailbox("Switching server...", new.Profile())
+            } else if currentProfile().sameServer(new.Profile()) {
+                // Edited profile still hosts current mailbox, keep it
+                applyProfile(mailbox, new.Profile())
+                state.Lock()
+                mailboxProfile = new.Profile()
+                state.Unlock()
             }
-            time.Sleep(time.Duration(updatePeriodSlider.Value) * time.Second)
-        }
-    }()
 
-    // Create file for logs
-    logFile, err := os.OpenFile("tempmail.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-    if err == nil {
-        log.SetOutput(logFile)
-    }
+            updateUI(func() {
+                autoUpdateCheck.SetChecked(!new.DisableAutoUpdate)
+                notificationsCheck.SetChecked(!new.DisableNotifications)
+                updatePeriodSlider.SetValue(new.updatePeriod().Seconds())
+            })
+            select {
+            case pollerWake <- struct{}{}:
+            default:
+            }
+            if old.StatusCheckPeriod != new.StatusCheckPeriod {
+                wakeStatus()
+            }
+            select {
+            case retentionWake <- struct{}{}:
+            default:
+            }
+        })
+
+        // Start mail checking in background mode
+        go func() {
+            time.Sleep(2 * time.Second)
+
+            requested := false
+            for {
+                settings := store.Get()
+                if requested || (!settings.DisableAutoUpdate && breaker.Allow()) {
+                    updateEmails()
+                }
+                requested = false
+                select {
+                case <-time.After(settings.updatePeriod()):
+                case <-pollerWake:
+                case <-refreshNow:
+                    requested = true
+                }
+            }
+        }()
+
+        // Check server status in background, checks are slow on server, so
+        // first one waits until mailbox is in use
+        go func() {
+            time.Sleep(10 * time.Second)
 
-    // Set window close interceptor
-    window.SetCloseIntercept(func() {
-        dialog.ShowConfirm(
-            "Confirmation",
-            "Do you want to delete the current mailbox?\nClick 'Yes' to delete or 'No' to save.",
-            func(delete bool) {
-                if delete {
-                    if err := mailbox.Delete(); err != nil {
-                        log.Printf("Error deleting mailbox: %v\n", err)
+            for {
+                var next <-chan time.Time
+                if period := store.Get().statusCheckPeriod(); period > 0 {
+                    checkServerStatus()
+                    next = time.After(period)
+                }
+                select {
+                case <-next:
+                case <-statusWake:
+                }
+            }
+        }()
+
+        // Enforce retention in background, also right after settings change
+        go func() {
+            for {
+                enforceRetention()
+                select {
+                case <-time.After(retentionCheckPeriod):
+                case <-retentionWake:
+                }
+            }
+        }()
+
+        // Set window close interceptor
+        window.SetCloseIntercept(func() {
+            dialog.ShowConfirm(
+                "Confirmation",
+                "Do you want to delete the current mailbox?\nClick 'Yes' to delete or 'No' to save.",
+                func(delete bool) {
+                    if delete {
+                        // Delete in background with timeout, window closes when
+                        // deletion finishes, fails or is cancelled
+                        go func() {
+                            ctx, done := operations.Start("Deleting mailbox...", store.Get().operationTimeout())
+                            defer done()
+
+                            mailbox := currentMailbox.Load()
+                            err := mailbox.Delete(ctx)
+                            audit.RecordResult(ActorGUI, AuditMailboxDelete, mailbox.Address(), err, "application closed")
+                            if err != nil {
+                                slog.Error("Error deleting mailbox", "error", err)
+                            } else {
+                                // Event stays in outbox and is delivered on next launch if needed
+                                publishEvent(newMailEvent(EventMailboxDeleted, mailbox.Address()))
+                            }
+                            window.Close()
+                        }()
+                        return
                     }
-                } else {
-                    currentEmail := fmt.Sprintf("%s@%s", mailbox.Username, mailbox.Domain)
-                    if err := saveMailboxToFile(currentEmail, mailbox.Password); err != nil {
-                        log.Printf("Error saving mailbox: %v\n", err)
+
+                    mailbox := currentMailbox.Load()
+                    if err := saveMailboxToFile(mailbox.Address(), mailbox.Password); err != nil {
+                        slog.Error("Error saving mailbox", "error", err)
                     }
-                }
-                window.Close()
-            },
-            window,
-        )
-    })
+                    window.Close()
+                },
+                window,
+            )
+        })
+    }
+
+    // Handle settings and initialization errors
+    if err != nil {
+        showSettingsInterface()
+    } else {
+        go startMailbox()
+    }
+
+    window.Resize(fyne.NewSize(500, 600))
+    window.CenterOnScreen()
 
     // Show window and start main loop
     window.ShowAndRun()
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Bar with progress indicator and Cancel button shown while network
+// operations run in background
+type operationBar struct {
+    Container *fyne.Container
+
+    label   *widget.Label
+    mu      sync.Mutex
+    nextID  int
+    cancels map[int]context.CancelFunc
+}
+
+func newOperationBar() *operationBar {
+    bar := &operationBar{
+        label:   widget.NewLabel(""),
+        cancels: map[int]context.CancelFunc{},
+    }
+
+    cancelButton := widget.NewButton("Cancel", bar.Cancel)
+    bar.Container = container.NewBorder(
+        nil,
+        nil,
+        nil,
+        cancelButton,
+        container.NewVBox(bar.label, widget.NewProgressBarInfinite()),
+    )
+    bar.Container.Hide()
+    return bar
+}
+
+// Start shows bar with text and returns context of operation limited by
+// timeout. Returned function must be called when operation finishes
+func (b *operationBar) Start(text string, timeout time.Duration) (context.Context, func()) {
+    ctx, cancel := context.WithTimeout(context.Background(), timeout)
+
+    b.mu.Lock()
+    b.nextID++
+    id := b.nextID
+    b.cancels[id] = cancel
+    b.mu.Unlock()
+
+    b.label.SetText(text)
+    b.Container.Show()
+
+    return ctx, func() {
+        cancel()
+
+        b.mu.Lock()
+        delete(b.cancels, id)
+        idle := len(b.cancels) == 0
+        b.mu.Unlock()
+
+        if idle {
+            b.Container.Hide()
+        }
+    }
+}
+
+// Cancel interrupts all running operations
+func (b *operationBar) Cancel() {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    for _, cancel := range b.cancels {
+        cancel()
+    }
+}
+
+// Serializes widget changes made by background operations
+var uiMu sync.Mutex
+
+// Change widgets from background operation. Fyne 2.5 widgets may be changed
+// from any goroutine, but changes spanning several widgets, such as rebuild
+// of message list, must not interleave
+func updateUI(update func()) {
+    uiMu.Lock()
+    defer uiMu.Unlock()
+    update()
+}
+
+// Check whether operation was cancelled by user, such errors are not shown
+func cancelled(ctx context.Context) bool {
+    return ctx.Err() == context.Canceled
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "runtime"
+)
+
+// Name of application directory inside OS config and data directories
+const appDirName = "malinatemp"
+
+// Files kept in data directory
+const (
+    savedMailboxesFile = "saved_mailboxes.txt"
+    logFileName        = "tempmail.log"
+)
+
+// Locations of settings file and data directory holding saved mailboxes,
+// log and webhook outbox
+type appPaths struct {
+    Settings string
+    DataDir  string
+}
+
+// Paths used by application, resolved on startup
+var paths = appPaths{Settings: "settings.json", DataDir: "."}
+
+// Return path of file in data directory
+func (p appPaths) dataFile(name string) string {
+    return filepath.Join(p.DataDir, name)
+}
+
+// Resolve file locations. Settings file is taken from configFlag, then
+// TEMPMAIL_CONFIG, then settings.json in working directory left by older
+// versions, then OS config directory. Data directory is taken from
+// dataDirFlag, then TEMPMAIL_DATA_DIR, then working directory when legacy
+// settings file is used, then OS data directory
+func resolvePaths(configFlag, dataDirFlag string) (appPaths, error) {
+    var p appPaths
+    legacy := false
+
+    switch {
+    case configFlag != "":
+        p.Settings = configFlag
+    case os.Getenv("TEMPMAIL_CONFIG") != "":
+        p.Settings = os.Getenv("TEMPMAIL_CONFIG")
+    default:
+        if _, err := os.Stat("settings.json"); err == nil {
+            p.Settings = "settings.json"
+            legacy = true
+            break
+        }
+        configDir, err := os.UserConfigDir()
+        if err != nil {
+            return p, fmt.Errorf("error finding config directory: %w", err)
+        }
+        p.Settings = filepath.Join(configDir, appDirName, "settings.json")
+    }
+
+    switch {
+    case dataDirFlag != "":
+        p.DataDir = dataDirFlag
+    case os.Getenv("TEMPMAIL_DATA_DIR") != "":
+        p.DataDir = os.Getenv("TEMPMAIL_DATA_DIR")
+    case legacy:
+        p.DataDir = "."
+    default:
+        dataDir, err := userDataDir()
+        if err != nil {
+            return p, fmt.Errorf("error finding data directory: %w", err)
+        }
+        p.DataDir = filepath.Join(dataDir, appDirName)
+    }
+
+    if err := os.MkdirAll(p.DataDir, 0700); err != nil {
+        return p, fmt.Errorf("error creating data directory: %w", err)
+    }
+    return p, nil
+}
+
+// Return OS directory for application data: XDG_DATA_HOME or
+// ~/.local/share on Unix, %LocalAppData% on Windows and Application
+// Support on macOS
+func userDataDir() (string, error) {
+    switch runtime.GOOS {
+    case "windows":
+        if dir := os.Getenv("LocalAppData"); dir != "" {
+            return dir, nil
+        }
+        return os.UserConfigDir()
+    case "darwin", "ios":
+        return os.UserConfigDir()
+    }
+
+    if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+        return dir, nil
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return "", err
+    }
+    return filepath.Join(home, ".local", "share"), nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/url"
+    "strings"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// TLS policies of server profile
+const (
+    tlsPolicySkipVerify = "skip-verify" // Accept self-signed certificates, default
+    tlsPolicyVerify     = "verify"      // Verify IMAP and SMTP certificates
+)
+
+// Name of profile created from settings of older versions
+const defaultProfileName = "Default"
+
+// Named Mail-in-a-Box server configuration
+type ServerProfile struct {
+    Name          string
+    ApiURL        string
+    AdminEmail    string
+    AdminPassword string `json:",omitempty"` // Never exported, asked on login when empty
+    SessionKey    string `json:",omitempty"` // Admin session key replacing password of accounts with TOTP, never exported
+    Domain        string
+    ImapServer    string
+    SmtpServer    string // Optional, defaults to IMAP host with port 587
+    SieveServer   string `json:",omitempty"` // Optional, defaults to IMAP host with port 4190
+    MailboxQuota  string `json:",omitempty"` // Storage quota of new mailboxes, such as "50M"
+    Retention     RetentionConfig                // Retention of mailboxes unless mailbox has its own
+    TLSPolicy     string `json:",omitempty"` // tlsPolicySkipVerify when empty
+
+    // How domain of new mailbox is chosen, tempmail.DomainFixed uses Domain
+    DomainSelection string   `json:",omitempty"`
+    Domains         []string `json:",omitempty"` // Domains to choose from, all server domains when empty
+}
+
+// File format of exported profiles
+type profilesFile struct {
+    Profiles []ServerProfile
+}
+
+// Return secret sent to admin API, session key when logged in with TOTP
+func (p ServerProfile) adminSecret() string {
+    if p.SessionKey != "" {
+        return p.SessionKey
+    }
+    return p.AdminPassword
+}
+
+// Report whether profiles describe the same server and account. Other
+// settings and admin credentials may differ, they apply to mailbox in use
+func (p ServerProfile) sameServer(other ServerProfile) bool {
+    return p.ApiURL == other.ApiURL && p.AdminEmail == other.AdminEmail && p.Domain == other.Domain &&
+        p.ImapServer == other.ImapServer && p.SmtpServer == other.SmtpServer
+}
+
+// Report whether certificates of profile servers are verified
+func (p ServerProfile) verifyTLS() bool {
+    return p.TLSPolicy == tlsPolicyVerify
+}
+
+// Validate profile. Admin password is optional, it's asked on login when
+// missing
+func (p ServerProfile) Validate() error {
+    if strings.TrimSpace(p.Name) == "" {
+        return fmt.Errorf("Profile name cannot be empty")
+    }
+    if p.ApiURL == "" {
+        return fmt.Errorf("%s: API URL cannot be empty", p.Name)
+    }
+    if p.AdminEmail == "" {
+        return fmt.Errorf("%s: admin email cannot be empty", p.Name)
+    }
+    if p.Domain == "" {
+        return fmt.Errorf("%s: domain cannot be empty", p.Name)
+    }
+    if p.ImapServer == "" {
+        return fmt.Errorf("%s: IMAP server cannot be empty", p.Name)
+    }
+
+    // Check URL format
+    if _, err := url.Parse(p.ApiURL); err != nil {
+        return fmt.Errorf("%s: invalid API URL format: %w", p.Name, err)
+    }
+
+    // Check email format
+    if !strings.Contains(p.AdminEmail, "@") {
+        return fmt.Errorf("%s: invalid admin email format", p.Name)
+    }
+
+    switch p.TLSPolicy {
+    case "", tlsPolicySkipVerify, tlsPolicyVerify:
+    default:
+        return fmt.Errorf("%s: unknown TLS policy %q", p.Name, p.TLSPolicy)
+    }
+    switch p.DomainSelection {
+    case tempmail.DomainFixed, tempmail.DomainRandom, tempmail.DomainRoundRobin:
+    default:
+        return fmt.Errorf("%s: unknown domain selection %q", p.Name, p.DomainSelection)
+    }
+    return nil
+}
+
+// Return index of profile with name or -1
+func (s Settings) profileIndex(name string) int {
+    for i, profile := range s.Profiles {
+        if profile.Name == name {
+            return i
+        }
+    }
+    return -1
+}
+
+// Return active profile, first profile is used when active one is missing
+func (s Settings) Profile() ServerProfile {
+    if i := s.profileIndex(s.ActiveProfile); i >= 0 {
+        return s.Profiles[i]
+    }
+    if len(s.Profiles) > 0 {
+        return s.Profiles[0]
+    }
+    return ServerProfile{Name: defaultProfileName}
+}
+
+// Return profile with name
+func (s Settings) findProfile(name string) (ServerProfile, bool) {
+    if i := s.profileIndex(name); i >= 0 {
+        return s.Profiles[i], true
+    }
+    return ServerProfile{}, false
+}
+
+// Replace profile named oldName or add new one when oldName is not found.
+// Active profile follows rename
+func (s *Settings) setProfile(oldName string, profile ServerProfile) {
+    profiles := append([]ServerProfile{}, s.Profiles...)
+    if i := s.profileIndex(oldName); i >= 0 {
+        profiles[i] = profile
+    } else {
+        profiles = append(profiles, profile)
+    }
+    s.Profiles = profiles
+
+    if s.ActiveProfile == oldName || s.ActiveProfile == "" {
+        s.ActiveProfile = profile.Name
+    }
+}
+
+// Remove profile with name
+func (s *Settings) removeProfile(name string) {
+    var profiles []ServerProfile
+    for _, profile := range s.Profiles {
+        if profile.Name != name {
+            profiles = append(profiles, profile)
+        }
+    }
+    s.Profiles = profiles
+}
+
+// Move server settings of older versions stored at top level of settings
+// file into default profile
+func migrateLegacySettings(settings *Settings, data []byte) error {
+    if len(settings.Profiles) > 0 {
+        return nil
+    }
+
+    var legacy ServerProfile
+    if err := json.Unmarshal(data, &legacy); err != nil {
+        return err
+    }
+    legacy.Name = defaultProfileName
+    settings.Profiles = []ServerProfile{legacy}
+    settings.ActiveProfile = legacy.Name
+    return nil
+}
+
+// Write profiles without admin passwords, so file can be shared
+func exportProfiles(w io.Writer, profiles []ServerProfile) error {
+    file := profilesFile{}
+    for _, profile := range profiles {
+        profile.AdminPassword = ""
+        profile.SessionKey = ""
+        file.Profiles = append(file.Profiles, profile)
+    }
+
+    data, err := json.MarshalIndent(file, "", "    ")
+    if err != nil {
+        return fmt.Errorf("error serializing profiles: %w", err)
+    }
+    if _, err := w.Write(data); err != nil {
+        return fmt.Errorf("error writing profiles: %w", err)
+    }
+    return nil
+}
+
+// Read exported profiles and merge them into settings. Profiles with
+// existing names are replaced keeping their passwords and sessions. Returns number of
+// imported profiles
+func importProfiles(r io.Reader, settings *Settings) (int, error) {
+    var file profilesFile
+    if err := json.NewDecoder(r).Decode(&file); err != nil {
+        return 0, fmt.Errorf("error parsing profiles: %w", err)
+    }
+
+    for _, profile := range file.Profiles {
+        if err := profile.Validate(); err != nil {
+            return 0, fmt.Errorf("invalid profile: %w", err)
+        }
+    }
+
+    for _, profile := range file.Profiles {
+        profile.AdminPassword, profile.SessionKey = "", ""
+        if existing, ok := settings.findProfile(profile.Name); ok {
+            profile.AdminPassword = existing.AdminPassword
+            profile.SessionKey = existing.SessionKey
+        }
+        settings.setProfile(profile.Name, profile)
+    }
+    return len(file.Profiles), nil
+}
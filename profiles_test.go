@@ -0,0 +1,42 @@
+package main
+
+import (
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+func TestSameServer(t *testing.T) {
+    profile := ServerProfile{
+        Name:       "Work",
+        ApiURL:     "https://box.example.com/admin",
+        AdminEmail: "admin@example.com",
+        Domain:     "example.com",
+        ImapServer: "box.example.com:993",
+    }
+
+    tests := []struct {
+        name string
+        edit func(p *ServerProfile)
+        same bool
+    }{
+        {"retention", func(p *ServerProfile) { p.Retention = RetentionConfig{MaxAgeMinutes: 60, MaxMessages: 10} }, true},
+        {"quota", func(p *ServerProfile) { p.MailboxQuota = "50M" }, true},
+        {"sieve server", func(p *ServerProfile) { p.SieveServer = "box.example.com:4190" }, true},
+        {"domains", func(p *ServerProfile) { p.DomainSelection, p.Domains = tempmail.DomainRandom, []string{"example.org"} }, true},
+        {"TLS policy", func(p *ServerProfile) { p.TLSPolicy = tlsPolicyVerify }, true},
+        {"credentials", func(p *ServerProfile) { p.AdminPassword, p.SessionKey = "secret", "key" }, true},
+        {"API URL", func(p *ServerProfile) { p.ApiURL = "https://other.example.com/admin" }, false},
+        {"admin", func(p *ServerProfile) { p.AdminEmail = "root@example.com" }, false},
+        {"domain", func(p *ServerProfile) { p.Domain = "example.org" }, false},
+        {"IMAP server", func(p *ServerProfile) { p.ImapServer = "imap.example.com:993" }, false},
+        {"SMTP server", func(p *ServerProfile) { p.SmtpServer = "smtp.example.com:587" }, false},
+    }
+    for _, test := range tests {
+        edited := profile
+        test.edit(&edited)
+        if got := profile.sameServer(edited); got != test.same {
+            t.Errorf("editing %s: sameServer = %t, want %t", test.name, got, test.same)
+        }
+    }
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/storage"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Fill menu with profile switcher, active profile is checked
+func updateProfilesMenu(menu *fyne.Menu, settings Settings, onSwitch func(name string), onManage func()) {
+    menu.Items = nil
+    active := settings.Profile().Name
+    for _, profile := range settings.Profiles {
+        name := profile.Name // Create new variable for closure
+        item := fyne.NewMenuItem(name, func() {
+            onSwitch(name)
+        })
+        item.Checked = name == active
+        menu.Items = append(menu.Items, item)
+    }
+    menu.Items = append(menu.Items,
+        fyne.NewMenuItemSeparator(),
+        fyne.NewMenuItem("Manage profiles", onManage),
+    )
+    menu.Refresh()
+}
+
+// Show dialog for adding, editing, removing, importing and exporting
+// server profiles, changes are saved to settings file
+func showProfilesDialog(window fyne.Window, settings Settings, onSave func(Settings)) {
+    profilesList := container.NewVBox()
+    var updateList func()
+
+    // Keep local copy in sync with changes saved by nested dialogs
+    save := func(newSettings Settings) {
+        settings = newSettings
+        updateList()
+        onSave(newSettings)
+    }
+
+    updateList = func() {
+        profilesList.Objects = nil
+        active := settings.Profile().Name
+        for _, profile := range settings.Profiles {
+            name := profile.Name // Create new variable for closure
+
+            text := fmt.Sprintf("%s\n%s@%s", name, profile.AdminEmail, profile.Domain)
+            if name == active {
+                text = fmt.Sprintf("%s (active)\n%s@%s", name, profile.AdminEmail, profile.Domain)
+            }
+            switch {
+            case profile.SessionKey != "":
+                text += ", logged in with TOTP"
+            case profile.AdminPassword == "":
+                text += ", password asked on login"
+            }
+            label := widget.NewLabel(text)
+            label.Wrapping = fyne.TextWrapWord
+
+            editBtn := widget.NewButton("Edit", func() {
+                showProfileDialog(window, settings, name, save)
+            })
+            removeBtn := widget.NewButton("Remove", func() {
+                newSettings := settings
+                newSettings.removeProfile(name)
+                if err := saveSettings(newSettings); err != nil {
+                    dialog.ShowError(err, window)
+                    return
+                }
+                save(newSettings)
+            })
+            if name == active {
+                removeBtn.Disable()
+            }
+
+            profilesList.Add(container.NewBorder(nil, nil, nil, container.NewHBox(editBtn, removeBtn), label))
+        }
+        profilesList.Refresh()
+    }
+    updateList()
+
+    addButton := widget.NewButton("Add", func() {
+        showProfileDialog(window, settings, "", save)
+    })
+
+    importButton := widget.NewButton("Import", func() {
+        openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+            if err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            if reader == nil {
+                return
+            }
+            defer reader.Close()
+
+            newSettings := settings
+            count, err := importProfiles(reader, &newSettings)
+            if err != nil {
+                slog.Error("Error importing profiles", "error", err)
+                dialog.ShowError(fmt.Errorf("Error importing profiles: %v", err), window)
+                return
+            }
+            if err := saveSettings(newSettings); err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            save(newSettings)
+            dialog.ShowInformation("Success", fmt.Sprintf("Imported %d profiles, admin passwords are asked on first login", count), window)
+        }, window)
+        openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+        openDialog.Show()
+    })
+
+    exportButton := widget.NewButton("Export", func() {
+        saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+            if err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+            if writer == nil {
+                return
+            }
+            defer writer.Close()
+
+            if err := exportProfiles(writer, settings.Profiles); err != nil {
+                slog.Error("Error exporting profiles", "error", err)
+                dialog.ShowError(fmt.Errorf("Error exporting profiles: %v", err), window)
+                return
+            }
+            dialog.ShowInformation("Success", fmt.Sprintf("Exported %d profiles without passwords and sessions", len(settings.Profiles)), window)
+        }, window)
+        saveDialog.SetFileName("profiles.json")
+        saveDialog.Show()
+    })
+
+    formContent := container.NewBorder(
+        nil,
+        container.NewVBox(
+            widget.NewSeparator(),
+            widget.NewLabel("Exported profiles don't contain admin passwords and session keys."),
+            container.NewHBox(addButton, layout.NewSpacer(), importButton, exportButton),
+        ),
+        nil,
+        nil,
+        container.NewVScroll(profilesList),
+    )
+
+    profilesDialog := dialog.NewCustom("Server profiles", "Close", container.NewPadded(formContent), window)
+    profilesDialog.Resize(fyne.NewSize(500, 400))
+    profilesDialog.Show()
+}
+
+// Show dialog choosing profile on which new mailbox is created, active
+// profile stays unchanged
+func showCreateOnProfileDialog(window fyne.Window, settings Settings, onCreate func(ServerProfile)) {
+    var names []string
+    for _, profile := range settings.Profiles {
+        names = append(names, profile.Name)
+    }
+    profileSelect := widget.NewSelect(names, nil)
+    profileSelect.SetSelected(settings.Profile().Name)
+
+    dialog.ShowCustomConfirm("Create mailbox on profile", "Create", "Cancel",
+        container.NewVBox(widget.NewLabel("Profile:"), profileSelect),
+        func(create bool) {
+            if !create {
+                return
+            }
+            profile, ok := settings.findProfile(profileSelect.Selected)
+            if !ok {
+                return
+            }
+            onCreate(profile)
+        },
+        window,
+    )
+}
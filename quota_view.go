@@ -0,0 +1,89 @@
+package main
+
+import (
+    "fmt"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Default percent of quota used when warning is shown
+const defaultQuotaWarnPercent = 80
+
+// Return percent of quota used when user is warned or oldest messages are
+// purged
+func (s Settings) quotaWarnPercent() float64 {
+    if s.QuotaWarnPercent > 0 && s.QuotaWarnPercent <= 100 {
+        return float64(s.QuotaWarnPercent)
+    }
+    return defaultQuotaWarnPercent
+}
+
+// Return usage purge brings mailbox down to, three quarters of warning level
+func (s Settings) quotaPurgeTarget(quota tempmail.Quota) int64 {
+    return int64(float64(quota.Limit) * s.quotaWarnPercent() * 3 / 4 / 100)
+}
+
+// Format byte count with binary units
+func formatBytes(n int64) string {
+    const unit = 1024
+    if n < unit {
+        return fmt.Sprintf("%d B", n)
+    }
+    value := float64(n)
+    for _, suffix := range []string{"KB", "MB", "GB"} {
+        value /= unit
+        if value < unit {
+            return fmt.Sprintf("%.1f %s", value, suffix)
+        }
+    }
+    return fmt.Sprintf("%.1f TB", value/unit)
+}
+
+// Storage usage of mailbox shown in mailbox header, hidden while server
+// doesn't report quota
+type quotaIndicator struct {
+    Container *fyne.Container
+
+    label *widget.Label
+    bar   *widget.ProgressBar
+}
+
+func newQuotaIndicator() *quotaIndicator {
+    q := &quotaIndicator{
+        label: widget.NewLabel(""),
+        bar:   widget.NewProgressBar(),
+    }
+    q.bar.TextFormatter = func() string {
+        return ""
+    }
+    q.Container = container.NewBorder(nil, nil, q.label, nil, q.bar)
+    q.Container.Hide()
+    return q
+}
+
+// Update shows usage, marking it when warning level is reached
+func (q *quotaIndicator) Update(quota tempmail.Quota, warnPercent float64) {
+    if quota.Limit <= 0 {
+        q.label.SetText("Storage: " + formatBytes(quota.Used) + ", no quota")
+        q.bar.Hide()
+        q.Container.Show()
+        return
+    }
+
+    text := fmt.Sprintf("Storage: %s of %s (%.0f%%)", formatBytes(quota.Used), formatBytes(quota.Limit), quota.Percent())
+    if quota.Percent() >= warnPercent {
+        text += ", almost full"
+    }
+    q.label.SetText(text)
+    q.bar.SetValue(quota.Percent() / 100)
+    q.bar.Show()
+    q.Container.Show()
+}
+
+// Hide hides indicator when quota is not available
+func (q *quotaIndicator) Hide() {
+    q.Container.Hide()
+}
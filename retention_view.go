@@ -0,0 +1,161 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/widget"
+)
+
+// How often retention janitor checks current mailbox
+const retentionCheckPeriod = 5 * time.Minute
+
+// RetentionConfig is retention policy saved in settings, zero fields keep
+// messages
+type RetentionConfig struct {
+    MaxAgeMinutes int `json:",omitempty"` // Delete messages older than this
+    MaxMessages   int `json:",omitempty"` // Keep only the last messages of INBOX
+}
+
+// Return policy enforced by tempmail
+func (c RetentionConfig) policy() tempmail.RetentionPolicy {
+    return tempmail.RetentionPolicy{
+        MaxAge:      time.Duration(c.MaxAgeMinutes) * time.Minute,
+        MaxMessages: c.MaxMessages,
+    }
+}
+
+// Return retention of mailbox, its own policy when set, otherwise policy of
+// profile
+func (s Settings) retention(profile ServerProfile, address string) RetentionConfig {
+    if config, ok := s.MailboxRetention[strings.ToLower(address)]; ok {
+        return config
+    }
+    return profile.Retention
+}
+
+// Format minutes as duration accepted by parseRetention
+func formatMinutes(minutes int) string {
+    if minutes == 0 {
+        return ""
+    }
+    if minutes%(24*60) == 0 {
+        return fmt.Sprintf("%dd", minutes/(24*60))
+    }
+    if minutes%60 == 0 {
+        return fmt.Sprintf("%dh", minutes/60)
+    }
+    return fmt.Sprintf("%dm", minutes)
+}
+
+// Parse retention fields, age is duration such as 30m, 2h or 7d
+func parseRetention(ageText, keepText string) (RetentionConfig, error) {
+    var config RetentionConfig
+    if ageText = strings.TrimSpace(ageText); ageText != "" {
+        var age time.Duration
+        var err error
+        if days, ok := strings.CutSuffix(ageText, "d"); ok {
+            var n int
+            n, err = strconv.Atoi(days)
+            age = time.Duration(n) * 24 * time.Hour
+        } else {
+            age, err = time.ParseDuration(ageText)
+        }
+        if err != nil || age < time.Minute {
+            return config, fmt.Errorf("message age must be a duration such as 30m, 2h or 7d")
+        }
+        config.MaxAgeMinutes = int(age / time.Minute)
+    }
+    if keepText = strings.TrimSpace(keepText); keepText != "" {
+        keep, err := strconv.Atoi(keepText)
+        if err != nil || keep < 1 {
+            return config, fmt.Errorf("number of kept messages must be a positive number")
+        }
+        config.MaxMessages = keep
+    }
+    return config, nil
+}
+
+// Create entries editing retention policy
+func newRetentionEntries(config RetentionConfig) (*widget.Entry, *widget.Entry) {
+    ageEntry := widget.NewEntry()
+    ageEntry.SetPlaceHolder("Keep forever, e.g. 2h or 7d")
+    ageEntry.SetText(formatMinutes(config.MaxAgeMinutes))
+
+    keepEntry := widget.NewEntry()
+    keepEntry.SetPlaceHolder("Keep all, e.g. 50")
+    if config.MaxMessages > 0 {
+        keepEntry.SetText(strconv.Itoa(config.MaxMessages))
+    }
+    return ageEntry, keepEntry
+}
+
+// Show dialog setting retention of mailbox, which overrides policy of
+// profile. Janitor is woken after saving
+func showRetentionDialog(window fyne.Window, address string, settings Settings, profile ServerProfile, update func(change func(*Settings)) error) {
+    _, hasOwn := settings.MailboxRetention[strings.ToLower(address)]
+    ageEntry, keepEntry := newRetentionEntries(settings.retention(profile, address))
+
+    ownCheck := widget.NewCheck("Own policy for this mailbox", func(checked bool) {
+        if checked {
+            ageEntry.Enable()
+            keepEntry.Enable()
+            return
+        }
+        ageEntry.SetText(formatMinutes(profile.Retention.MaxAgeMinutes))
+        keepEntry.SetText("")
+        if profile.Retention.MaxMessages > 0 {
+            keepEntry.SetText(strconv.Itoa(profile.Retention.MaxMessages))
+        }
+        ageEntry.Disable()
+        keepEntry.Disable()
+    })
+    ownCheck.SetChecked(hasOwn)
+    if !hasOwn {
+        ownCheck.OnChanged(false)
+    }
+
+    items := []*widget.FormItem{
+        widget.NewFormItem("", ownCheck),
+        widget.NewFormItem("Delete older than", ageEntry),
+        widget.NewFormItem("Keep only last", keepEntry),
+        widget.NewFormItem("", widget.NewLabel("Messages are deleted permanently, also from trash")),
+    }
+    dialog.ShowForm("Retention of "+address, "Save", "Cancel", items, func(confirmed bool) {
+        if !confirmed {
+            return
+        }
+        var config RetentionConfig
+        if ownCheck.Checked {
+            var err error
+            if config, err = parseRetention(ageEntry.Text, keepEntry.Text); err != nil {
+                dialog.ShowError(err, window)
+                return
+            }
+        }
+        err := update(func(s *Settings) {
+            retention := map[string]RetentionConfig{}
+            for key, value := range s.MailboxRetention {
+                retention[key] = value
+            }
+            if ownCheck.Checked {
+                retention[strings.ToLower(address)] = config
+            } else {
+                delete(retention, strings.ToLower(address))
+            }
+            if len(retention) == 0 {
+                retention = nil
+            }
+            s.MailboxRetention = retention
+        })
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+    }, window)
+}
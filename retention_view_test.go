@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestParseRetention(t *testing.T) {
+    tests := []struct {
+        age, keep string
+        want      RetentionConfig
+        valid     bool
+    }{
+        {"", "", RetentionConfig{}, true},
+        {"30m", "", RetentionConfig{MaxAgeMinutes: 30}, true},
+        {"2h", "", RetentionConfig{MaxAgeMinutes: 120}, true},
+        {" 7d ", "50", RetentionConfig{MaxAgeMinutes: 7 * 24 * 60, MaxMessages: 50}, true},
+        {"1h30m", "", RetentionConfig{MaxAgeMinutes: 90}, true},
+        {"", "10", RetentionConfig{MaxMessages: 10}, true},
+        {"30s", "", RetentionConfig{}, false},
+        {"week", "", RetentionConfig{}, false},
+        {"xd", "", RetentionConfig{}, false},
+        {"", "0", RetentionConfig{}, false},
+        {"", "many", RetentionConfig{}, false},
+    }
+    for _, test := range tests {
+        got, err := parseRetention(test.age, test.keep)
+        if (err == nil) != test.valid {
+            t.Errorf("parseRetention(%q, %q) error %v, want valid %t", test.age, test.keep, err, test.valid)
+            continue
+        }
+        if test.valid && got != test.want {
+            t.Errorf("parseRetention(%q, %q) = %+v, want %+v", test.age, test.keep, got, test.want)
+        }
+    }
+
+    // Formatted age is parsed back to the same value
+    for _, minutes := range []int{45, 120, 90, 3 * 24 * 60} {
+        got, err := parseRetention(formatMinutes(minutes), "")
+        if err != nil || got.MaxAgeMinutes != minutes {
+            t.Errorf("%d minutes formatted as %q parsed to %+v, %v", minutes, formatMinutes(minutes), got, err)
+        }
+    }
+}
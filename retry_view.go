@@ -0,0 +1,162 @@
+package main
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Entries editing retry policy of one kind of operation
+type retryEntries struct {
+    attempts *widget.Entry
+    initial  *widget.Entry
+    max      *widget.Entry
+    jitter   *widget.Entry
+}
+
+func newRetryEntries(config tempmail.RetryConfig) retryEntries {
+    entries := retryEntries{
+        attempts: widget.NewEntry(),
+        initial:  widget.NewEntry(),
+        max:      widget.NewEntry(),
+        jitter:   widget.NewEntry(),
+    }
+    entries.attempts.SetText(strconv.Itoa(config.MaxAttempts))
+    entries.initial.SetText(strconv.FormatFloat(config.InitialInterval.Seconds(), 'f', -1, 64))
+    entries.max.SetText(strconv.FormatFloat(config.MaxInterval.Seconds(), 'f', -1, 64))
+    entries.jitter.SetText(strconv.FormatFloat(config.Jitter*100, 'f', -1, 64))
+    return entries
+}
+
+// Read retry policy from entries, name is used in error messages
+func (e retryEntries) config(name string) (tempmail.RetryConfig, error) {
+    var config tempmail.RetryConfig
+
+    attempts, err := strconv.Atoi(strings.TrimSpace(e.attempts.Text))
+    if err != nil || attempts < 1 {
+        return config, fmt.Errorf("%s: attempts must be a positive number", name)
+    }
+    initial, err := strconv.ParseFloat(strings.TrimSpace(e.initial.Text), 64)
+    if err != nil || initial < 0 {
+        return config, fmt.Errorf("%s: initial interval must be a number of seconds", name)
+    }
+    max, err := strconv.ParseFloat(strings.TrimSpace(e.max.Text), 64)
+    if err != nil || max < initial {
+        return config, fmt.Errorf("%s: maximum interval must be a number of seconds not less than initial", name)
+    }
+    jitter, err := strconv.ParseFloat(strings.TrimSpace(e.jitter.Text), 64)
+    if err != nil || jitter < 0 || jitter > 100 {
+        return config, fmt.Errorf("%s: jitter must be a percentage from 0 to 100", name)
+    }
+
+    config.MaxAttempts = attempts
+    config.InitialInterval = time.Duration(initial * float64(time.Second))
+    config.MaxInterval = time.Duration(max * float64(time.Second))
+    config.Jitter = jitter / 100
+    return config, nil
+}
+
+// Show dialog for configuring retry policies and circuit breaker
+func showRetrySettingsDialog(window fyne.Window, settings Settings, update func(change func(*Settings)) error) {
+    policies := settings.retryPolicies()
+    read := newRetryEntries(policies.Read)
+    modify := newRetryEntries(policies.Modify)
+    account := newRetryEntries(policies.Account)
+    send := newRetryEntries(policies.Send)
+
+    grid := container.NewGridWithColumns(5,
+        widget.NewLabel("Operation"),
+        widget.NewLabel("Attempts"),
+        widget.NewLabel("Initial (sec)"),
+        widget.NewLabel("Max (sec)"),
+        widget.NewLabel("Jitter (%)"),
+    )
+    for _, row := range []struct {
+        name    string
+        entries retryEntries
+    }{
+        {"Check mail", read},
+        {"Change messages", modify},
+        {"Create/delete mailbox", account},
+        {"Send mail", send},
+    } {
+        grid.Add(widget.NewLabel(row.name))
+        grid.Add(row.entries.attempts)
+        grid.Add(row.entries.initial)
+        grid.Add(row.entries.max)
+        grid.Add(row.entries.jitter)
+    }
+
+    thresholdEntry := widget.NewEntry()
+    thresholdEntry.SetText(strconv.Itoa(settings.breakerThreshold()))
+    cooldownEntry := widget.NewEntry()
+    cooldownEntry.SetText(strconv.Itoa(int(settings.breakerCooldown().Seconds())))
+
+    saveButton := widget.NewButton("Save", func() {
+        var newPolicies tempmail.RetryPolicies
+        var err error
+        if newPolicies.Read, err = read.config("Check mail"); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if newPolicies.Modify, err = modify.config("Change messages"); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if newPolicies.Account, err = account.config("Create/delete mailbox"); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if newPolicies.Send, err = send.config("Send mail"); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+
+        threshold, err := strconv.Atoi(strings.TrimSpace(thresholdEntry.Text))
+        if err != nil || threshold < 1 {
+            dialog.ShowError(fmt.Errorf("failures before pause must be a positive number"), window)
+            return
+        }
+        cooldown, err := strconv.Atoi(strings.TrimSpace(cooldownEntry.Text))
+        if err != nil || cooldown < 1 {
+            dialog.ShowError(fmt.Errorf("pause must be a positive number of seconds"), window)
+            return
+        }
+
+        err = update(func(s *Settings) {
+            s.Retry = newPolicies
+            s.BreakerThreshold = threshold
+            s.BreakerCooldown = cooldown
+        })
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        dialog.ShowInformation("Success", "Retry settings saved", window)
+    })
+
+    formContent := container.NewVBox(
+        widget.NewLabelWithStyle("Retry policies", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+        grid,
+        widget.NewLabel("Rejected logins and 4xx API responses are never retried."),
+        widget.NewSeparator(),
+        widget.NewLabelWithStyle("Pause automatic updates", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+        widget.NewLabel("Consecutive failures before pause:"),
+        thresholdEntry,
+        widget.NewLabel("Pause (sec):"),
+        cooldownEntry,
+        container.NewHBox(layout.NewSpacer(), saveButton),
+    )
+
+    retryDialog := dialog.NewCustom("Retry policy", "Close", container.NewPadded(container.NewVScroll(formContent)), window)
+    retryDialog.Resize(fyne.NewSize(600, 500))
+    retryDialog.Show()
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "os/exec"
+    "path"
+    "path/filepath"
+    "regexp"
+    "runtime"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+)
+
+// Actions of mail rules
+const (
+    RuleActionDelete   = "delete"    // Move message to trash
+    RuleActionMarkRead = "mark_read" // Mark message read
+    RuleActionCopyCode = "copy_code" // Copy first verification code to clipboard
+    RuleActionWebhook  = "webhook"   // Send rule.matched event to webhook with URL in Argument
+    RuleActionSound    = "sound"     // Play sound file in Argument
+    RuleActionCommand  = "command"   // Run command line in Argument with event JSON on stdin
+    RuleActionExport   = "export"    // Save message as .eml file to folder in Argument
+)
+
+// Time limit of command run by mail rule
+const ruleCommandTimeout = time.Minute
+
+// RuleAction is action run when mail rule matches
+type RuleAction struct {
+    Type     string
+    Argument string `json:",omitempty"`
+}
+
+// MailRule runs actions on new messages matching all its set conditions.
+// Rules are evaluated by the app on each update, unlike server-side
+// filters in sieve_view.go
+type MailRule struct {
+    Name           string
+    Enabled        bool
+    From           string `json:",omitempty"` // Text contained in sender name or address, case-insensitive
+    Subject        string `json:",omitempty"` // Regular expression matching subject
+    Body           string `json:",omitempty"` // Text contained in message text, case-insensitive
+    AttachmentType string `json:",omitempty"` // Media type of attachment, such as application/pdf or image/*
+    Actions        []RuleAction
+}
+
+// Validate checks that rule has actions with arguments and valid subject
+// expression
+func (r MailRule) Validate() error {
+    if strings.TrimSpace(r.Name) == "" {
+        return fmt.Errorf("rule needs name")
+    }
+    if _, err := regexp.Compile(r.Subject); err != nil {
+        return fmt.Errorf("invalid subject expression: %w", err)
+    }
+    if _, err := path.Match(strings.ToLower(r.AttachmentType), ""); err != nil {
+        return fmt.Errorf("invalid attachment type %q", r.AttachmentType)
+    }
+    if len(r.Actions) == 0 {
+        return fmt.Errorf("rule %q has no actions", r.Name)
+    }
+    for _, action := range r.Actions {
+        switch action.Type {
+        case RuleActionDelete, RuleActionMarkRead, RuleActionCopyCode:
+        case RuleActionWebhook, RuleActionSound, RuleActionCommand, RuleActionExport:
+            if strings.TrimSpace(action.Argument) == "" {
+                return fmt.Errorf("action %s needs argument", action.Type)
+            }
+        default:
+            return fmt.Errorf("unknown action %q", action.Type)
+        }
+    }
+    return nil
+}
+
+// Matches reports whether email meets all conditions of rule
+func (r MailRule) Matches(email tempmail.Email) bool {
+    if from := strings.ToLower(r.From); from != "" &&
+        !strings.Contains(strings.ToLower(email.From), from) &&
+        !strings.Contains(strings.ToLower(email.FromAddress), from) {
+        return false
+    }
+    if r.Subject != "" {
+        re, err := regexp.Compile(r.Subject)
+        if err != nil || !re.MatchString(email.Subject) {
+            return false
+        }
+    }
+    if r.Body != "" && !strings.Contains(strings.ToLower(email.Content), strings.ToLower(r.Body)) {
+        return false
+    }
+    if r.AttachmentType != "" {
+        pattern := strings.ToLower(r.AttachmentType)
+        found := false
+        for _, attachmentType := range tempmail.AttachmentTypes(email.Raw) {
+            if matched, _ := path.Match(pattern, attachmentType); matched {
+                found = true
+                break
+            }
+        }
+        if !found {
+            return false
+        }
+    }
+    return true
+}
+
+// Result of rules applied to message
+type ruleResult struct {
+    Deleted bool
+    Read    bool
+}
+
+// ruleEngine runs actions of mail rules
+type ruleEngine struct {
+    clipboard fyne.Clipboard
+    webhooks  *WebhookDispatcher
+    audit     *auditLog
+}
+
+// Apply runs actions of enabled rules matching email. Failed actions are
+// logged and don't stop other actions. Message is deleted after all other
+// actions ran. Each matched rule is recorded in audit log
+func (e *ruleEngine) Apply(ctx context.Context, rules []MailRule, mailbox *tempmail.TempMailbox, email tempmail.Email) ruleResult {
+    var result ruleResult
+    deleteMessage := false
+    for _, rule := range rules {
+        if !rule.Enabled || !rule.Matches(email) {
+            continue
+        }
+        slog.Info("Mail rule matched message", "rule", rule.Name, "uid", email.UID)
+        var actions, failures []string
+        for _, action := range rule.Actions {
+            actions = append(actions, action.Type)
+            if action.Type == RuleActionDelete {
+                deleteMessage = true
+                continue
+            }
+            if err := e.run(ctx, rule, action, mailbox, email); err != nil {
+                slog.Error("Error running action of mail rule", "action", action.Type, "rule", rule.Name, "error", err)
+                failures = append(failures, fmt.Sprintf("%s: %v", action.Type, err))
+                continue
+            }
+            if action.Type == RuleActionMarkRead {
+                result.Read = true
+            }
+        }
+        var err error
+        if len(failures) > 0 {
+            err = errors.New(strings.Join(failures, "; "))
+        }
+        e.audit.RecordResult(ActorRules, AuditRuleRun, mailbox.Address(), err,
+            fmt.Sprintf("rule %q on UID %d, actions %s", rule.Name, email.UID, strings.Join(actions, ", ")))
+    }
+
+    if deleteMessage {
+        _, err := mailbox.DeleteMail(ctx, email.UID)
+        if err != nil {
+            slog.Error("Error deleting message by mail rule", "uid", email.UID, "error", err)
+        } else {
+            result.Deleted = true
+        }
+        e.audit.RecordResult(ActorRules, AuditMessageDelete, mailbox.Address(), err, fmt.Sprintf("UID %d", email.UID))
+    }
+    return result
+}
+
+// Run single action other than delete
+func (e *ruleEngine) run(ctx context.Context, rule MailRule, action RuleAction, mailbox *tempmail.TempMailbox, email tempmail.Email) error {
+    switch action.Type {
+    case RuleActionMarkRead:
+        return mailbox.MarkRead(ctx, email.UID)
+    case RuleActionCopyCode:
+        codes := tempmail.ExtractCodes(email.Content)
+        if len(codes) == 0 {
+            return fmt.Errorf("no code found")
+        }
+        e.clipboard.SetContent(codes[0])
+        return nil
+    case RuleActionWebhook:
+        return e.webhooks.PublishTo(action.Argument, ruleEvent(rule, mailbox, email))
+    case RuleActionSound:
+        return playSound(action.Argument)
+    case RuleActionCommand:
+        e.startCommand(rule, action.Argument, ruleEvent(rule, mailbox, email))
+        return nil
+    case RuleActionExport:
+        return exportToFolder(action.Argument, mailbox.Address(), email)
+    }
+    return fmt.Errorf("unknown action %q", action.Type)
+}
+
+// Create rule.matched event with message data
+func ruleEvent(rule MailRule, mailbox *tempmail.TempMailbox, email tempmail.Email) MailEvent {
+    event := newMessageEvent(mailbox.Address(), email)
+    event.Type = EventRuleMatched
+    event.Rule = rule.Name
+    return event
+}
+
+// Play sound file with player of the operating system without waiting
+// for it to finish
+func playSound(file string) error {
+    var cmd *exec.Cmd
+    switch runtime.GOOS {
+    case "darwin":
+        cmd = exec.Command("afplay", file)
+    case "windows":
+        script := fmt.Sprintf("(New-Object Media.SoundPlayer '%s').PlaySync()", strings.ReplaceAll(file, "'", "''"))
+        cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+    default:
+        player, err := exec.LookPath("paplay")
+        if err != nil {
+            player = "aplay"
+        }
+        cmd = exec.Command(player, file)
+    }
+    if err := cmd.Start(); err != nil {
+        return fmt.Errorf("error playing sound: %w", err)
+    }
+    go cmd.Wait()
+    return nil
+}
+
+// Run command of rule in background, so slow command doesn't hold up mail
+// checks. Failure is logged and recorded in audit log when command ends
+func (e *ruleEngine) startCommand(rule MailRule, command string, event MailEvent) {
+    go func() {
+        ctx, cancel := context.WithTimeout(context.Background(), ruleCommandTimeout)
+        defer cancel()
+        if err := runRuleCommand(ctx, command, event); err != nil {
+            slog.Error("Error running command of mail rule", "rule", rule.Name, "uid", event.Email.UID, "error", err)
+            e.audit.RecordResult(ActorRules, AuditRuleRun, event.Mailbox, err,
+                fmt.Sprintf("command of rule %q on UID %d", rule.Name, event.Email.UID))
+        }
+    }()
+}
+
+// Run command line with shell of the operating system, event JSON is
+// written to its stdin
+func runRuleCommand(ctx context.Context, command string, event MailEvent) error {
+    payload, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("error serializing event: %w", err)
+    }
+
+    var cmd *exec.Cmd
+    if runtime.GOOS == "windows" {
+        cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+    } else {
+        cmd = exec.CommandContext(ctx, "sh", "-c", command)
+    }
+    cmd.Stdin = bytes.NewReader(payload)
+    // Processes started by command may keep output open after it's killed
+    cmd.WaitDelay = time.Second
+    output, err := cmd.CombinedOutput()
+    if err != nil {
+        return fmt.Errorf("error running command: %w: %s", err, strings.TrimSpace(string(output)))
+    }
+    return nil
+}
+
+// Save message as .eml file in folder, named by mailbox and UID
+func exportToFolder(dir, address string, email tempmail.Email) error {
+    if err := os.MkdirAll(dir, 0700); err != nil {
+        return fmt.Errorf("error creating folder: %w", err)
+    }
+    file, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s_%d.eml", address, email.UID)))
+    if err != nil {
+        return fmt.Errorf("error creating file: %w", err)
+    }
+    defer file.Close()
+    return tempmail.WriteEML(file, email)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Describe conditions and actions of rule in one line each
+func ruleSummary(rule MailRule) string {
+    var conditions []string
+    if rule.From != "" {
+        conditions = append(conditions, fmt.Sprintf("from contains %q", rule.From))
+    }
+    if rule.Subject != "" {
+        conditions = append(conditions, fmt.Sprintf("subject matches %q", rule.Subject))
+    }
+    if rule.Body != "" {
+        conditions = append(conditions, fmt.Sprintf("body contains %q", rule.Body))
+    }
+    if rule.AttachmentType != "" {
+        conditions = append(conditions, "has "+rule.AttachmentType+" attachment")
+    }
+    if len(conditions) == 0 {
+        conditions = append(conditions, "any message")
+    }
+
+    var actions []string
+    for _, action := range rule.Actions {
+        text := action.Type
+        if action.Argument != "" {
+            text += " " + action.Argument
+        }
+        actions = append(actions, text)
+    }
+    return fmt.Sprintf("%s\nIf %s: %s", rule.Name, strings.Join(conditions, ", "), strings.Join(actions, ", "))
+}
+
+// Show dialog for managing mail rules, changes are saved to settings file
+func showRulesDialog(window fyne.Window, settings Settings, update func(change func(*Settings)) error) {
+    rules := append([]MailRule{}, settings.Rules...)
+    editing := -1 // Index of rule loaded in form, -1 when adding new one
+
+    // Create fields of rule form
+    nameEntry := widget.NewEntry()
+    nameEntry.SetPlaceHolder("Rule name")
+    fromEntry := widget.NewEntry()
+    fromEntry.SetPlaceHolder("noreply@example.com")
+    subjectEntry := widget.NewEntry()
+    subjectEntry.SetPlaceHolder(`(?i)verification|code`)
+    bodyEntry := widget.NewEntry()
+    bodyEntry.SetPlaceHolder("Text in message body")
+    attachmentEntry := widget.NewEntry()
+    attachmentEntry.SetPlaceHolder("application/pdf or image/*")
+
+    deleteCheck := widget.NewCheck("Delete", nil)
+    markReadCheck := widget.NewCheck("Mark read", nil)
+    copyCodeCheck := widget.NewCheck("Copy code to clipboard", nil)
+
+    var webhookURLs []string
+    for _, hook := range settings.Webhooks {
+        webhookURLs = append(webhookURLs, hook.URL)
+    }
+    webhookSelect := widget.NewSelect(append([]string{"None"}, webhookURLs...), nil)
+    webhookSelect.SetSelected("None")
+
+    soundEntry := widget.NewEntry()
+    soundEntry.SetPlaceHolder("Sound file (.wav)")
+    soundBrowse := widget.NewButton("Browse", func() {
+        dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+            if err != nil || reader == nil {
+                return
+            }
+            defer reader.Close()
+            soundEntry.SetText(reader.URI().Path())
+        }, window)
+    })
+
+    commandEntry := widget.NewEntry()
+    commandEntry.SetPlaceHolder("Command, message JSON on stdin")
+
+    exportEntry := widget.NewEntry()
+    exportEntry.SetPlaceHolder("Folder for .eml files")
+    exportBrowse := widget.NewButton("Browse", func() {
+        dialog.ShowFolderOpen(func(uri fyne.ListableURI, err error) {
+            if err != nil || uri == nil {
+                return
+            }
+            exportEntry.SetText(uri.Path())
+        }, window)
+    })
+
+    // Read rule from form fields
+    formRule := func() MailRule {
+        rule := MailRule{
+            Name:           strings.TrimSpace(nameEntry.Text),
+            Enabled:        true,
+            From:           strings.TrimSpace(fromEntry.Text),
+            Subject:        subjectEntry.Text,
+            Body:           bodyEntry.Text,
+            AttachmentType: strings.TrimSpace(attachmentEntry.Text),
+        }
+        if editing >= 0 {
+            rule.Enabled = rules[editing].Enabled
+        }
+        if markReadCheck.Checked {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionMarkRead})
+        }
+        if copyCodeCheck.Checked {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionCopyCode})
+        }
+        if webhookSelect.SelectedIndex() > 0 {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionWebhook, Argument: webhookSelect.Selected})
+        }
+        if text := strings.TrimSpace(soundEntry.Text); text != "" {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionSound, Argument: text})
+        }
+        if text := strings.TrimSpace(commandEntry.Text); text != "" {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionCommand, Argument: text})
+        }
+        if text := strings.TrimSpace(exportEntry.Text); text != "" {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionExport, Argument: text})
+        }
+        if deleteCheck.Checked {
+            rule.Actions = append(rule.Actions, RuleAction{Type: RuleActionDelete})
+        }
+        return rule
+    }
+
+    // Fill form fields with rule
+    setForm := func(rule MailRule) {
+        nameEntry.SetText(rule.Name)
+        fromEntry.SetText(rule.From)
+        subjectEntry.SetText(rule.Subject)
+        bodyEntry.SetText(rule.Body)
+        attachmentEntry.SetText(rule.AttachmentType)
+        deleteCheck.SetChecked(false)
+        markReadCheck.SetChecked(false)
+        copyCodeCheck.SetChecked(false)
+        webhookSelect.SetSelected("None")
+        soundEntry.SetText("")
+        commandEntry.SetText("")
+        exportEntry.SetText("")
+        for _, action := range rule.Actions {
+            switch action.Type {
+            case RuleActionDelete:
+                deleteCheck.SetChecked(true)
+            case RuleActionMarkRead:
+                markReadCheck.SetChecked(true)
+            case RuleActionCopyCode:
+                copyCodeCheck.SetChecked(true)
+            case RuleActionWebhook:
+                webhookSelect.SetSelected(action.Argument)
+            case RuleActionSound:
+                soundEntry.SetText(action.Argument)
+            case RuleActionCommand:
+                commandEntry.SetText(action.Argument)
+            case RuleActionExport:
+                exportEntry.SetText(action.Argument)
+            }
+        }
+    }
+
+    addButton := widget.NewButton("Add", nil)
+
+    rulesList := container.NewVBox()
+    var updateList func()
+    updateList = func() {
+        rulesList.Objects = nil
+        if len(rules) == 0 {
+            rulesList.Add(widget.NewLabel("No mail rules configured"))
+        }
+        for i, rule := range rules {
+            i := i // Create new variable for closure
+
+            label := widget.NewLabel(ruleSummary(rule))
+            label.Wrapping = fyne.TextWrapWord
+
+            enabledCheck := widget.NewCheck("Enabled", func(checked bool) {
+                rules[i].Enabled = checked
+            })
+            enabledCheck.SetChecked(rule.Enabled)
+
+            editBtn := widget.NewButton("Edit", func() {
+                editing = i
+                setForm(rules[i])
+                addButton.SetText("Update")
+            })
+            removeBtn := widget.NewButton("Remove", func() {
+                rules = append(rules[:i], rules[i+1:]...)
+                editing = -1
+                setForm(MailRule{})
+                addButton.SetText("Add")
+                updateList()
+            })
+
+            rulesList.Add(container.NewBorder(nil, nil, nil, container.NewHBox(enabledCheck, editBtn, removeBtn), label))
+        }
+        rulesList.Refresh()
+    }
+    updateList()
+
+    addButton.OnTapped = func() {
+        rule := formRule()
+        if err := rule.Validate(); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        if editing >= 0 {
+            rules[editing] = rule
+        } else {
+            rules = append(rules, rule)
+        }
+        editing = -1
+        setForm(MailRule{})
+        addButton.SetText("Add")
+        updateList()
+    }
+
+    saveButton := widget.NewButton("Save", func() {
+        if err := update(func(s *Settings) { s.Rules = rules }); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        dialog.ShowInformation("Success", "Mail rules saved", window)
+    })
+
+    formContent := container.NewVBox(
+        widget.NewLabelWithStyle("Mail rules", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+        widget.NewLabel("Rules run in order on each new message matching all filled conditions"),
+        rulesList,
+        widget.NewSeparator(),
+        widget.NewForm(
+            widget.NewFormItem("Name", nameEntry),
+            widget.NewFormItem("From contains", fromEntry),
+            widget.NewFormItem("Subject regex", subjectEntry),
+            widget.NewFormItem("Body contains", bodyEntry),
+            widget.NewFormItem("Attachment type", attachmentEntry),
+        ),
+        container.NewHBox(markReadCheck, copyCodeCheck, deleteCheck),
+        widget.NewForm(
+            widget.NewFormItem("Webhook", webhookSelect),
+            widget.NewFormItem("Sound", container.NewBorder(nil, nil, nil, soundBrowse, soundEntry)),
+            widget.NewFormItem("Command", commandEntry),
+            widget.NewFormItem("Export to", container.NewBorder(nil, nil, nil, exportBrowse, exportEntry)),
+        ),
+        container.NewHBox(addButton, layout.NewSpacer(), saveButton),
+    )
+
+    rulesDialog := dialog.NewCustom("Mail rules", "Close", container.NewPadded(container.NewVScroll(formContent)), window)
+    rulesDialog.Resize(fyne.NewSize(600, 650))
+    rulesDialog.Show()
+}
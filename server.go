@@ -0,0 +1,128 @@
+package main
+
+import (
+    "crypto/subtle"
+    "log/slog"
+    "net"
+    "net/http"
+    "strings"
+    "sync"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Check bearer token of request. Token may also be passed as "token" query
+// parameter because browser EventSource cannot set headers
+func authorized(r *http.Request, token string) bool {
+    if token == "" {
+        return true
+    }
+
+    provided := r.URL.Query().Get("token")
+    if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+        provided = strings.TrimPrefix(auth, "Bearer ")
+    }
+    return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// Report whether Host header of request names loopback address, such as
+// localhost:8025 or 127.0.0.1:8025
+func loopbackHost(r *http.Request) bool {
+    host, _, err := net.SplitHostPort(r.Host)
+    if err != nil {
+        host = strings.Trim(r.Host, "[]")
+    }
+    if strings.EqualFold(host, "localhost") {
+        return true
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback()
+}
+
+// Wrap handler with token check and CORS headers for browser dashboards.
+// Without token any web page open in browser could read and delete mail
+// through the server, so browser requests, which carry Origin header, are
+// then refused and CORS is not allowed. Requests for other hosts than
+// loopback are refused too, page of DNS rebinding domain resolving to
+// 127.0.0.1 sends no Origin to same origin but still has its own Host
+func withServerAuth(token string, handler http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if token == "" {
+            if r.Header.Get("Origin") != "" {
+                http.Error(w, "access token is required for browser requests", http.StatusForbidden)
+                return
+            }
+            if !loopbackHost(r) {
+                http.Error(w, "access token is required for requests to host "+r.Host, http.StatusForbidden)
+                return
+            }
+            handler.ServeHTTP(w, r)
+            return
+        }
+
+        w.Header().Set("Access-Control-Allow-Origin", "*")
+        w.Header().Set("Access-Control-Allow-Headers", "Authorization, Last-Event-ID, Content-Type")
+        w.Header().Set("Access-Control-Allow-Methods", "GET, DELETE, OPTIONS")
+        if r.Method == http.MethodOptions {
+            w.WriteHeader(http.StatusNoContent)
+            return
+        }
+
+        if !authorized(r, token) {
+            http.Error(w, "unauthorized", http.StatusUnauthorized)
+            return
+        }
+        handler.ServeHTTP(w, r)
+    })
+}
+
+// Local HTTP server serving event stream and MailHog/Mailpit compatible
+// API for mailbox returned by provider. Restarted when its settings change
+type localServer struct {
+    mu      sync.Mutex
+    events  *EventStream
+    mailbox func() *tempmail.TempMailbox
+    audit   *auditLog
+    server  *http.Server
+    listen  string
+    token   string
+}
+
+func newLocalServer(events *EventStream, mailbox func() *tempmail.TempMailbox, audit *auditLog) *localServer {
+    return &localServer{events: events, mailbox: mailbox, audit: audit}
+}
+
+// Apply starts, stops or restarts server when listen address or token
+// changed. Server is disabled when address is empty
+func (s *localServer) Apply(settings Settings) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.server != nil && settings.ServerListen == s.listen && settings.ServerToken == s.token {
+        return
+    }
+    if s.server != nil {
+        // Close instead of graceful shutdown, event streams never finish
+        slog.Info("Stopping local server", "listen", s.listen)
+        s.server.Close()
+        s.server = nil
+    }
+    s.listen = settings.ServerListen
+    s.token = settings.ServerToken
+    if s.listen == "" {
+        return
+    }
+
+    mux := http.NewServeMux()
+    mux.Handle("/events", s.events)
+    NewMailAPI(s.mailbox, s.audit, apiActor(s.token)).Register(mux)
+
+    server := &http.Server{Addr: s.listen, Handler: withServerAuth(s.token, mux)}
+    s.server = server
+    slog.Info("Starting local server", "listen", s.listen)
+    go func() {
+        if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+            slog.Error("Error running local server", "error", err)
+        }
+    }()
+}
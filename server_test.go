@@ -0,0 +1,54 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+func TestWithServerAuth(t *testing.T) {
+    ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+    })
+
+    tests := []struct {
+        name   string
+        token  string
+        method string
+        target string
+        host   string
+        header map[string]string
+        want   int
+        cors   bool
+    }{
+        {"loopback IPv4", "", http.MethodGet, "/api/v1/messages", "127.0.0.1:8025", nil, http.StatusOK, false},
+        {"localhost", "", http.MethodGet, "/api/v1/messages", "localhost:8025", nil, http.StatusOK, false},
+        {"loopback IPv6", "", http.MethodGet, "/api/v1/messages", "[::1]:8025", nil, http.StatusOK, false},
+        {"without port", "", http.MethodGet, "/api/v1/messages", "localhost", nil, http.StatusOK, false},
+        {"DNS rebinding", "", http.MethodGet, "/api/v1/messages", "rebind.example.com:8025", nil, http.StatusForbidden, false},
+        {"LAN address", "", http.MethodGet, "/api/v1/messages", "192.168.1.10:8025", nil, http.StatusForbidden, false},
+        {"browser", "", http.MethodGet, "/events", "127.0.0.1:8025", map[string]string{"Origin": "https://example.com"}, http.StatusForbidden, false},
+        {"browser preflight", "", http.MethodOptions, "/events", "127.0.0.1:8025", map[string]string{"Origin": "https://example.com"}, http.StatusForbidden, false},
+        {"missing token", "secret", http.MethodGet, "/events", "127.0.0.1:8025", nil, http.StatusUnauthorized, true},
+        {"wrong token", "secret", http.MethodGet, "/events", "127.0.0.1:8025", map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized, true},
+        {"bearer token", "secret", http.MethodGet, "/events", "127.0.0.1:8025", map[string]string{"Authorization": "Bearer secret"}, http.StatusOK, true},
+        {"query token", "secret", http.MethodGet, "/events?token=secret", "127.0.0.1:8025", nil, http.StatusOK, true},
+        {"token from other host", "secret", http.MethodGet, "/events?token=secret", "box.example.com:8025", map[string]string{"Origin": "https://example.com"}, http.StatusOK, true},
+        {"preflight", "secret", http.MethodOptions, "/events", "127.0.0.1:8025", map[string]string{"Origin": "https://example.com"}, http.StatusNoContent, true},
+    }
+    for _, test := range tests {
+        r := httptest.NewRequest(test.method, test.target, nil)
+        r.Host = test.host
+        for key, value := range test.header {
+            r.Header.Set(key, value)
+        }
+        w := httptest.NewRecorder()
+        withServerAuth(test.token, ok).ServeHTTP(w, r)
+        if w.Code != test.want {
+            t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.want)
+        }
+        if cors := w.Header().Get("Access-Control-Allow-Origin") != ""; cors != test.cors {
+            t.Errorf("%s: CORS allowed %t, want %t", test.name, cors, test.cors)
+        }
+    }
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+    "fmt"
+    "net"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Show dialog for configuring local HTTP server
+func showServerSettingsDialog(window fyne.Window, settings Settings, update func(change func(*Settings)) error) {
+    listenEntry := widget.NewEntry()
+    listenEntry.SetText(settings.ServerListen)
+    listenEntry.SetPlaceHolder("127.0.0.1:8025 (empty to disable)")
+
+    tokenEntry := widget.NewPasswordEntry()
+    tokenEntry.SetText(settings.ServerToken)
+    tokenEntry.SetPlaceHolder("Bearer token, required for browser dashboards")
+
+    formContent := container.NewVBox(
+        widget.NewLabel("Listen address:"),
+        listenEntry,
+        widget.NewLabel("Access token:"),
+        tokenEntry,
+        widget.NewLabel("Event stream: GET /events?mailbox=<address>"),
+        widget.NewLabel("MailHog API: /api/v2/messages, Mailpit API: /api/v1/messages"),
+        container.NewHBox(
+            layout.NewSpacer(),
+            widget.NewButton("Save", func() {
+                if listenEntry.Text != "" {
+                    if _, _, err := net.SplitHostPort(listenEntry.Text); err != nil {
+                        dialog.ShowError(fmt.Errorf("invalid listen address: %w", err), window)
+                        return
+                    }
+                }
+
+                err := update(func(s *Settings) {
+                    s.ServerListen = listenEntry.Text
+                    s.ServerToken = tokenEntry.Text
+                })
+                if err != nil {
+                    dialog.ShowError(err, window)
+                    return
+                }
+                dialog.ShowInformation("Success", "Local server settings applied", window)
+            }),
+        ),
+    )
+
+    serverDialog := dialog.NewCustom("Local server", "Close", container.NewPadded(formContent), window)
+    serverDialog.Resize(fyne.NewSize(400, 300))
+    serverDialog.Show()
+}
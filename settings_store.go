@@ -0,0 +1,117 @@
+package main
+
+import (
+    "sync"
+)
+
+// Settings before and after change, delivered to listeners
+type settingsChange struct {
+    old, new Settings
+}
+
+// Current settings shared by subsystems. Listeners are notified after each
+// change so new values are applied without restart
+type settingsStore struct {
+    // Serializes changes, held from reading settings until they're saved,
+    // so concurrent updates don't lose each other's changes
+    changeMu sync.Mutex
+
+    mu        sync.Mutex // Guards fields below
+    settings  Settings
+    listeners []func(old, new Settings)
+    pending   []settingsChange // Changes not yet delivered, in order
+    notifying bool             // Some goroutine is delivering pending changes
+}
+
+func newSettingsStore(settings Settings) *settingsStore {
+    return &settingsStore{settings: settings}
+}
+
+// Get returns current settings
+func (s *settingsStore) Get() Settings {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.settings
+}
+
+// Set replaces current settings already written to file, used by dialogs
+// which save settings themselves
+func (s *settingsStore) Set(settings Settings) {
+    s.changeMu.Lock()
+    s.replace(settings)
+    s.changeMu.Unlock()
+    s.notify()
+}
+
+// Save writes settings to file and applies them
+func (s *settingsStore) Save(settings Settings) error {
+    s.changeMu.Lock()
+    err := saveSettings(settings)
+    if err == nil {
+        s.replace(settings)
+    }
+    s.changeMu.Unlock()
+    if err != nil {
+        return err
+    }
+    s.notify()
+    return nil
+}
+
+// Update applies change to current settings and saves them
+func (s *settingsStore) Update(change func(*Settings)) error {
+    s.changeMu.Lock()
+    settings := s.Get()
+    change(&settings)
+    err := saveSettings(settings)
+    if err == nil {
+        s.replace(settings)
+    }
+    s.changeMu.Unlock()
+    if err != nil {
+        return err
+    }
+    s.notify()
+    return nil
+}
+
+// Subscribe adds listener called with previous and new settings after
+// each change
+func (s *settingsStore) Subscribe(listener func(old, new Settings)) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.listeners = append(s.listeners, listener)
+}
+
+// Replace current settings and queue change for listeners
+func (s *settingsStore) replace(settings Settings) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.pending = append(s.pending, settingsChange{old: s.settings, new: settings})
+    s.settings = settings
+}
+
+// Deliver queued changes to listeners in the order they were made. Only
+// one goroutine delivers at a time; others, including listeners changing
+// settings, leave their changes to it
+func (s *settingsStore) notify() {
+    s.mu.Lock()
+    if s.notifying {
+        s.mu.Unlock()
+        return
+    }
+    s.notifying = true
+    for len(s.pending) > 0 {
+        change := s.pending[0]
+        s.pending = s.pending[1:]
+        listeners := append([]func(old, new Settings){}, s.listeners...)
+        s.mu.Unlock()
+
+        for _, listener := range listeners {
+            listener(change.old, change.new)
+        }
+        s.mu.Lock()
+    }
+    s.notifying = false
+    s.mu.Unlock()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Options of rule editor selects
+var (
+    sieveFields       = []string{tempmail.SieveFieldFrom, tempmail.SieveFieldSubject, tempmail.SieveFieldHeader, tempmail.SieveFieldSize}
+    sieveTextMatches  = []string{"contains", "is", "matches"}
+    sieveSizeMatches  = []string{"over", "under"}
+    sieveActions      = []string{tempmail.SieveDiscard, tempmail.SieveFileInto, tempmail.SieveRedirect, tempmail.SieveFlag}
+    sieveArgumentHint = map[string]string{
+        tempmail.SieveFileInto: "Folder",
+        tempmail.SieveRedirect: "address@example.com",
+        tempmail.SieveFlag:     `\Flagged`,
+    }
+)
+
+// Editor row of one rule
+type sieveRuleRow struct {
+    field    *widget.Select
+    header   *widget.Entry
+    match    *widget.Select
+    value    *widget.Entry
+    action   *widget.Select
+    argument *widget.Entry
+}
+
+func newSieveRuleRow(rule tempmail.SieveRule) *sieveRuleRow {
+    row := &sieveRuleRow{
+        header:   widget.NewEntry(),
+        match:    widget.NewSelect(sieveTextMatches, nil),
+        value:    widget.NewEntry(),
+        argument: widget.NewEntry(),
+    }
+    row.header.SetPlaceHolder("X-Header")
+    row.value.SetPlaceHolder("Value")
+
+    row.field = widget.NewSelect(sieveFields, func(field string) {
+        if field == tempmail.SieveFieldHeader {
+            row.header.Show()
+        } else {
+            row.header.Hide()
+        }
+        matches := sieveTextMatches
+        if field == tempmail.SieveFieldSize {
+            matches = sieveSizeMatches
+            row.value.SetPlaceHolder("100K")
+        } else {
+            row.value.SetPlaceHolder("Value")
+        }
+        row.match.Options = matches
+        if !contains(matches, row.match.Selected) {
+            row.match.SetSelected(matches[0])
+        }
+        row.match.Refresh()
+    })
+    row.action = widget.NewSelect(sieveActions, func(action string) {
+        if hint, ok := sieveArgumentHint[action]; ok {
+            row.argument.SetPlaceHolder(hint)
+            row.argument.Show()
+        } else {
+            row.argument.Hide()
+        }
+    })
+
+    if rule.Field == "" {
+        rule = tempmail.SieveRule{Field: tempmail.SieveFieldFrom, Match: "contains", Action: tempmail.SieveFileInto}
+    }
+    row.header.SetText(rule.Header)
+    row.value.SetText(rule.Value)
+    row.argument.SetText(rule.Argument)
+    row.field.SetSelected(rule.Field)
+    row.match.SetSelected(rule.Match)
+    row.action.SetSelected(rule.Action)
+    return row
+}
+
+// Return whether list contains value
+func contains(list []string, value string) bool {
+    for _, item := range list {
+        if item == value {
+            return true
+        }
+    }
+    return false
+}
+
+func (row *sieveRuleRow) rule() tempmail.SieveRule {
+    rule := tempmail.SieveRule{
+        Field:  row.field.Selected,
+        Match:  row.match.Selected,
+        Value:  row.value.Text,
+        Action: row.action.Selected,
+    }
+    if rule.Field == tempmail.SieveFieldHeader {
+        rule.Header = row.header.Text
+    }
+    if _, ok := sieveArgumentHint[rule.Action]; ok {
+        rule.Argument = row.argument.Text
+    }
+    return rule
+}
+
+// Show editor of server-side filter rules of mailbox. Rules are compiled to
+// Sieve and uploaded over ManageSieve, so they apply even when the app is
+// closed
+func showSieveWindow(myApp fyne.App, mailbox *tempmail.TempMailbox, timeout time.Duration) {
+    window := myApp.NewWindow("Filter rules - " + mailbox.Address())
+
+    operations := newOperationBar()
+    rulesList := container.NewVBox()
+    var rows []*sieveRuleRow
+
+    var showRows func()
+    showRows = func() {
+        rulesList.Objects = nil
+        for i, row := range rows {
+            index := i // Create new variable for closure
+            removeButton := widget.NewButton("Remove", func() {
+                rows = append(rows[:index], rows[index+1:]...)
+                showRows()
+            })
+            rulesList.Add(container.NewVBox(
+                container.NewGridWithColumns(4, row.field, row.header, row.match, row.value),
+                container.NewBorder(nil, nil, widget.NewLabel(fmt.Sprintf("%d. then", index+1)), removeButton,
+                    container.NewGridWithColumns(2, row.action, row.argument)),
+                widget.NewSeparator(),
+            ))
+        }
+        if len(rows) == 0 {
+            rulesList.Add(widget.NewLabel("No rules, all mail is kept in Inbox"))
+        }
+        rulesList.Refresh()
+    }
+
+    formRules := func() []tempmail.SieveRule {
+        var rules []tempmail.SieveRule
+        for _, row := range rows {
+            rules = append(rules, row.rule())
+        }
+        return rules
+    }
+
+    addButton := widget.NewButton("Add rule", func() {
+        rows = append(rows, newSieveRuleRow(tempmail.SieveRule{}))
+        showRows()
+    })
+
+    showScriptButton := widget.NewButton("Show script", func() {
+        script, err := tempmail.CompileSieve(formRules())
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        scriptEntry := widget.NewMultiLineEntry()
+        scriptEntry.SetText(script)
+        scriptEntry.SetMinRowsVisible(12)
+        dialog.ShowCustom("Sieve script", "Close", scriptEntry, window)
+    })
+
+    checkButton := widget.NewButton("Check", func() {
+        script, err := tempmail.CompileSieve(formRules())
+        if err == nil {
+            err = tempmail.CheckSieveSyntax(script)
+        }
+        if err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        go func() {
+            ctx, done := operations.Start("Checking script on server...", timeout)
+            defer done()
+            if err := mailbox.CheckSieveScript(ctx, script); err != nil {
+                slog.Error("Error checking Sieve script", "error", err)
+                if !cancelled(ctx) {
+                    dialog.ShowError(fmt.Errorf("Error checking script: %v", err), window)
+                }
+                return
+            }
+            dialog.ShowInformation("Success", "Server accepted the script", window)
+        }()
+    })
+
+    saveButton := widget.NewButton("Save", func() {
+        rules := formRules()
+        if _, err := tempmail.CompileSieve(rules); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        go func() {
+            ctx, done := operations.Start("Uploading rules...", timeout)
+            defer done()
+            if _, err := mailbox.SetSieveRules(ctx, rules); err != nil {
+                slog.Error("Error saving filter rules", "error", err)
+                if !cancelled(ctx) {
+                    dialog.ShowError(fmt.Errorf("Error saving filter rules: %v", err), window)
+                }
+                return
+            }
+            if len(rules) == 0 {
+                dialog.ShowInformation("Success", "Filter rules removed", window)
+                return
+            }
+            dialog.ShowInformation("Success", fmt.Sprintf("%d filter rules active", len(rules)), window)
+        }()
+    })
+
+    load := func() {
+        ctx, done := operations.Start("Loading rules...", timeout)
+        defer done()
+        rules, err := mailbox.SieveRules(ctx)
+        if err != nil {
+            slog.Error("Error loading filter rules", "error", err)
+            if !cancelled(ctx) {
+                dialog.ShowError(fmt.Errorf("Error loading filter rules: %v", err), window)
+            }
+            return
+        }
+        rows = nil
+        for _, rule := range rules {
+            rows = append(rows, newSieveRuleRow(rule))
+        }
+        showRows()
+    }
+
+    window.SetContent(container.NewBorder(
+        container.NewHBox(widget.NewLabel("Rules run on server in order, each matching rule applies its action"), layout.NewSpacer(), addButton),
+        container.NewVBox(
+            container.NewHBox(checkButton, showScriptButton, layout.NewSpacer(), saveButton),
+            operations.Container,
+        ),
+        nil,
+        nil,
+        container.NewVScroll(rulesList),
+    ))
+    window.Resize(fyne.NewSize(700, 500))
+    window.Show()
+
+    showRows()
+    go load()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+    "context"
+    "sync"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Default interval between server status checks
+const defaultStatusCheckPeriod = 10 * time.Minute
+
+// Keeps latest status of Mail-in-a-Box server and reports status checks
+// which turned red since previous refresh
+type statusMonitor struct {
+    mu        sync.Mutex
+    profile   string // Profile of latest status
+    status    *tempmail.ServerStatus
+    err       error
+    failing   map[string]bool // Failed checks of latest status by section and text
+    nextID    int
+    listeners map[int]func(*tempmail.ServerStatus, error)
+}
+
+func newStatusMonitor() *statusMonitor {
+    return &statusMonitor{listeners: map[int]func(*tempmail.ServerStatus, error){}}
+}
+
+// Load status of server of profile and return failed checks which were
+// not failed on previous refresh. First status of profile is baseline,
+// its failed checks are not reported
+func (m *statusMonitor) Refresh(ctx context.Context, profile string, mailbox *tempmail.TempMailbox) ([]tempmail.StatusCheck, error) {
+    status, err := mailbox.ServerStatus(ctx)
+
+    m.mu.Lock()
+    if profile != m.profile {
+        m.profile = profile
+        m.status = nil
+        m.failing = nil
+    }
+    var turnedRed []tempmail.StatusCheck
+    if err == nil {
+        failing := map[string]bool{}
+        for _, check := range status.Failed() {
+            key := check.Section + "\n" + check.Text
+            failing[key] = true
+            if m.failing != nil && !m.failing[key] {
+                turnedRed = append(turnedRed, check)
+            }
+        }
+        m.failing = failing
+        m.status = status
+    }
+    m.err = err
+    listeners := make([]func(*tempmail.ServerStatus, error), 0, len(m.listeners))
+    for _, listener := range m.listeners {
+        listeners = append(listeners, listener)
+    }
+    latest := m.status
+    m.mu.Unlock()
+
+    for _, listener := range listeners {
+        listener(latest, err)
+    }
+    return turnedRed, err
+}
+
+// Latest returns last loaded status, which is kept when refresh fails, and
+// error of last refresh
+func (m *statusMonitor) Latest() (*tempmail.ServerStatus, error) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.status, m.err
+}
+
+// Subscribe calls listener after each refresh. Returned function removes it
+func (m *statusMonitor) Subscribe(listener func(*tempmail.ServerStatus, error)) func() {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    id := m.nextID
+    m.nextID++
+    m.listeners[id] = listener
+    return func() {
+        m.mu.Lock()
+        defer m.mu.Unlock()
+        delete(m.listeners, id)
+    }
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/theme"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Choices of status check period in minutes, negative disables checks
+var statusPeriodChoices = []struct {
+    label   string
+    minutes int
+}{
+    {"Every 5 minutes", 5},
+    {"Every 10 minutes", 10},
+    {"Every 30 minutes", 30},
+    {"Every hour", 60},
+    {"Only on refresh", -1},
+}
+
+// Return icon of Mail-in-a-Box check or certificate status
+func statusTypeIcon(status string) fyne.Resource {
+    switch status {
+    case tempmail.StatusOK, "success":
+        return theme.ConfirmIcon()
+    case tempmail.StatusWarning:
+        return theme.WarningIcon()
+    case tempmail.StatusError, "danger":
+        return theme.ErrorIcon()
+    default:
+        return theme.InfoIcon()
+    }
+}
+
+// Build row with status icon and wrapped text
+func newStatusRow(status, text string) fyne.CanvasObject {
+    label := widget.NewLabel(text)
+    label.Wrapping = fyne.TextWrapWord
+    return container.NewBorder(nil, nil, widget.NewIcon(statusTypeIcon(status)), nil, label)
+}
+
+// Describe latest backup of server
+func backupSummary(status *tempmail.ServerStatus) (string, string) {
+    switch {
+    case status.Backup == nil:
+        return "", "Backup status unknown"
+    case status.Backup.Error != "":
+        return tempmail.StatusError, "Backup error: " + status.Backup.Error
+    case len(status.Backup.Backups) == 0:
+        return tempmail.StatusWarning, "No backups made yet"
+    }
+    latest := status.Backup.Backups[0]
+    kind := "incremental"
+    if latest.Full {
+        kind = "full"
+    }
+    return tempmail.StatusOK, fmt.Sprintf("Latest backup: %s (%s ago), %s, %.1f MB, %d backups kept",
+        latest.DateStr, latest.DateDelta, kind, float64(latest.Size)/(1<<20), len(status.Backup.Backups))
+}
+
+// Fill tabs of status window with server status
+func fillStatusTabs(status *tempmail.ServerStatus, checksList, systemList, certificatesList, usersList *fyne.Container) {
+    checksList.Objects = nil
+    section := ""
+    for _, check := range status.Checks {
+        if check.Section != section {
+            section = check.Section
+            checksList.Add(widget.NewLabelWithStyle(section, fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+        }
+        text := check.Text
+        if len(check.Extra) > 0 {
+            text += "\n" + strings.Join(check.Extra, "\n")
+        }
+        checksList.Add(newStatusRow(check.Type, text))
+    }
+    checksList.Refresh()
+
+    systemList.Objects = nil
+    if status.DiskUsage != "" {
+        systemList.Add(newStatusRow(tempmail.StatusOK, status.DiskUsage))
+    }
+    if status.RebootRequired {
+        systemList.Add(newStatusRow(tempmail.StatusWarning, "Reboot required to finish installing updates"))
+    } else {
+        systemList.Add(newStatusRow(tempmail.StatusOK, "No reboot required"))
+    }
+    systemList.Add(newStatusRow(backupSummary(status)))
+    for _, err := range status.Errors {
+        systemList.Add(newStatusRow(tempmail.StatusError, err))
+    }
+    systemList.Refresh()
+
+    certificatesList.Objects = nil
+    for _, certificate := range status.Certificates {
+        certificatesList.Add(newStatusRow(certificate.Status, certificate.Domain+": "+certificate.Text))
+    }
+    certificatesList.Refresh()
+
+    usersList.Objects = nil
+    usersList.Add(widget.NewLabelWithStyle(fmt.Sprintf("Users (%d)", len(status.Users)), fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+    for _, user := range status.Users {
+        text := user.Email
+        if len(user.Privileges) > 0 {
+            text += " (" + strings.Join(user.Privileges, ", ") + ")"
+        }
+        if user.Status != "" && user.Status != "active" {
+            text += ", " + user.Status
+        }
+        usersList.Add(widget.NewLabel(text))
+    }
+    usersList.Add(widget.NewLabelWithStyle(fmt.Sprintf("Aliases (%d)", len(status.Aliases)), fyne.TextAlignLeading, fyne.TextStyle{Bold: true}))
+    for _, alias := range status.Aliases {
+        label := widget.NewLabel(fmt.Sprintf("%s -> %s", alias.AddressDisplay, strings.Join(alias.ForwardsTo, ", ")))
+        label.Wrapping = fyne.TextWrapWord
+        usersList.Add(label)
+    }
+    usersList.Refresh()
+}
+
+// Show window with status of Mail-in-a-Box server. It shows latest status
+// of monitor and follows its refreshes until closed
+func showStatusWindow(myApp fyne.App, monitor *statusMonitor, settings Settings, profile string, refresh func(), onPeriodChange func(minutes int)) {
+    window := myApp.NewWindow("Server status - " + profile)
+
+    checksList := container.NewVBox()
+    systemList := container.NewVBox()
+    certificatesList := container.NewVBox()
+    usersList := container.NewVBox()
+
+    updatedLabel := widget.NewLabel("Loading status...")
+    progress := widget.NewProgressBarInfinite()
+
+    show := func(status *tempmail.ServerStatus, err error) {
+        progress.Hide()
+        switch {
+        case status == nil && err != nil:
+            updatedLabel.SetText(fmt.Sprintf("Error loading status: %v", err))
+            return
+        case status == nil:
+            return
+        case err != nil:
+            updatedLabel.SetText(fmt.Sprintf("Updated %s, last refresh failed: %v", status.Updated.Format("15:04:05"), err))
+        default:
+            updatedLabel.SetText(fmt.Sprintf("Updated %s, %d failed checks", status.Updated.Format("15:04:05"), len(status.Failed())))
+        }
+        fillStatusTabs(status, checksList, systemList, certificatesList, usersList)
+    }
+    unsubscribe := monitor.Subscribe(show)
+    window.SetOnClosed(unsubscribe)
+
+    refreshButton := widget.NewButton("Refresh", func() {
+        progress.Show()
+        go refresh()
+    })
+
+    var periodLabels []string
+    selected := ""
+    for _, choice := range statusPeriodChoices {
+        periodLabels = append(periodLabels, choice.label)
+        if choice.minutes == settings.StatusCheckPeriod || (settings.StatusCheckPeriod == 0 && choice.minutes == 10) {
+            selected = choice.label
+        }
+    }
+    periodSelect := widget.NewSelect(periodLabels, nil)
+    periodSelect.SetSelected(selected)
+    periodSelect.OnChanged = func(label string) {
+        for _, choice := range statusPeriodChoices {
+            if choice.label == label {
+                onPeriodChange(choice.minutes)
+            }
+        }
+    }
+
+    tabs := container.NewAppTabs(
+        container.NewTabItem("Status checks", container.NewVScroll(checksList)),
+        container.NewTabItem("System", container.NewVScroll(systemList)),
+        container.NewTabItem("Certificates", container.NewVScroll(certificatesList)),
+        container.NewTabItem("Users", container.NewVScroll(usersList)),
+    )
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(
+            container.NewHBox(refreshButton, layout.NewSpacer(), widget.NewLabel("Check:"), periodSelect),
+            updatedLabel,
+            progress,
+        ),
+        nil,
+        nil,
+        nil,
+        tabs,
+    ))
+
+    // Show status loaded in background, load it when there is none
+    if status, err := monitor.Latest(); status != nil || err != nil {
+        show(status, err)
+    } else {
+        go refresh()
+    }
+
+    window.Resize(fyne.NewSize(600, 600))
+    window.Show()
+}
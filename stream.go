@@ -0,0 +1,176 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Number of recent events kept for clients resuming with Last-Event-ID
+const streamHistorySize = 1000
+
+// Interval of comments keeping idle connections alive
+const streamHeartbeatInterval = 30 * time.Second
+
+// Event with stream sequence number. SSE event ID is "<epoch>-<seq>"
+type streamEvent struct {
+    Seq   uint64
+    Event MailEvent
+    Data  []byte
+}
+
+// EventStream broadcasts mailbox events to Server-Sent Events clients.
+// Sequence restarts with the process, so event IDs carry epoch of the
+// process and IDs of other epoch can't be mistaken for current ones
+type EventStream struct {
+    epoch       string
+    mu          sync.Mutex
+    lastSeq     uint64
+    history     []streamEvent
+    subscribers map[chan streamEvent]bool
+}
+
+// NewEventStream creates empty event stream
+func NewEventStream() *EventStream {
+    return &EventStream{
+        epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+        subscribers: map[chan streamEvent]bool{},
+    }
+}
+
+// Publish sends event to all connected clients and keeps it in history
+func (s *EventStream) Publish(event MailEvent) {
+    data, err := json.Marshal(event)
+    if err != nil {
+        slog.Error("Error serializing stream event", "error", err)
+        return
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    s.lastSeq++
+    item := streamEvent{Seq: s.lastSeq, Event: event, Data: data}
+    s.history = append(s.history, item)
+    if len(s.history) > streamHistorySize {
+        s.history = s.history[len(s.history)-streamHistorySize:]
+    }
+
+    for ch := range s.subscribers {
+        select {
+        case ch <- item:
+        default:
+            // Client is too slow, drop it. It can reconnect and resume
+            // from the last received event ID
+            delete(s.subscribers, ch)
+            close(ch)
+        }
+    }
+}
+
+// Subscribe returns events published after lastSeq and channel receiving
+// new events
+func (s *EventStream) subscribe(lastSeq uint64) ([]streamEvent, chan streamEvent) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var backlog []streamEvent
+    for _, item := range s.history {
+        if item.Seq > lastSeq {
+            backlog = append(backlog, item)
+        }
+    }
+
+    ch := make(chan streamEvent, 64)
+    s.subscribers[ch] = true
+    return backlog, ch
+}
+
+func (s *EventStream) unsubscribe(ch chan streamEvent) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    if s.subscribers[ch] {
+        delete(s.subscribers, ch)
+        close(ch)
+    }
+}
+
+// ServeHTTP streams events as text/event-stream. Optional "mailbox" query
+// parameter limits events to one mailbox. Clients resume with Last-Event-ID
+// header or "last_event_id" query parameter
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+        return
+    }
+
+    lastEventID := r.Header.Get("Last-Event-ID")
+    if lastEventID == "" {
+        lastEventID = r.URL.Query().Get("last_event_id")
+    }
+    // ID of earlier process, or of version without epoch, is replayed
+    // from start of history, which holds only events of this process
+    var lastSeq uint64
+    if seqText, ok := strings.CutPrefix(lastEventID, s.epoch+"-"); ok {
+        seq, err := strconv.ParseUint(seqText, 10, 64)
+        if err != nil {
+            http.Error(w, "invalid event ID", http.StatusBadRequest)
+            return
+        }
+        lastSeq = seq
+    }
+    mailbox := r.URL.Query().Get("mailbox")
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.Header().Set("Connection", "keep-alive")
+    w.WriteHeader(http.StatusOK)
+
+    backlog, ch := s.subscribe(lastSeq)
+    defer s.unsubscribe(ch)
+
+    write := func(item streamEvent) error {
+        if mailbox != "" && item.Event.Mailbox != mailbox {
+            return nil
+        }
+        _, err := fmt.Fprintf(w, "id: %s-%d\nevent: %s\ndata: %s\n\n", s.epoch, item.Seq, item.Event.Type, item.Data)
+        return err
+    }
+
+    for _, item := range backlog {
+        if err := write(item); err != nil {
+            return
+        }
+    }
+    flusher.Flush()
+
+    heartbeat := time.NewTicker(streamHeartbeatInterval)
+    defer heartbeat.Stop()
+
+    for {
+        select {
+        case <-r.Context().Done():
+            return
+        case item, ok := <-ch:
+            if !ok {
+                return
+            }
+            if err := write(item); err != nil {
+                return
+            }
+            flusher.Flush()
+        case <-heartbeat.C:
+            if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+                return
+            }
+            flusher.Flush()
+        }
+    }
+}
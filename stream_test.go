@@ -0,0 +1,117 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "runtime"
+    "strings"
+    "testing"
+)
+
+// Connect to event stream and read IDs of first count events
+func readEventIDs(t *testing.T, server *httptest.Server, query, lastEventID string, count int) []string {
+    t.Helper()
+    request, err := http.NewRequest(http.MethodGet, server.URL+"/events"+query, nil)
+    if err != nil {
+        t.Error(err)
+        return nil
+    }
+    if lastEventID != "" {
+        request.Header.Set("Last-Event-ID", lastEventID)
+    }
+    resp, err := http.DefaultClient.Do(request)
+    if err != nil {
+        t.Error(err)
+        return nil
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+        t.Errorf("got %s, %s", resp.Status, resp.Header.Get("Content-Type"))
+        return nil
+    }
+
+    var ids []string
+    scanner := bufio.NewScanner(resp.Body)
+    for len(ids) < count && scanner.Scan() {
+        if id, ok := strings.CutPrefix(scanner.Text(), "id: "); ok {
+            ids = append(ids, id)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        t.Error(err)
+        return nil
+    }
+    return ids
+}
+
+func TestEventStreamResume(t *testing.T) {
+    stream := NewEventStream()
+    for i := 0; i < 4; i++ {
+        mailbox := "a@example.com"
+        if i%2 == 1 {
+            mailbox = "b@example.com"
+        }
+        stream.Publish(newMailEvent(EventMailboxCreated, mailbox))
+    }
+    mux := http.NewServeMux()
+    mux.Handle("/events", stream)
+    server := httptest.NewServer(mux)
+    defer server.Close()
+
+    id := func(seq int) string {
+        return fmt.Sprintf("%s-%d", stream.epoch, seq)
+    }
+
+    tests := []struct {
+        name        string
+        query       string
+        lastEventID string
+        want        []string
+    }{
+        {"whole history", "", "", []string{id(1), id(2), id(3), id(4)}},
+        {"resume", "", id(2), []string{id(3), id(4)}},
+        {"resume by query", "?last_event_id=" + id(3), "", []string{id(4)}},
+        {"earlier process", "", "1a2b3c-3", []string{id(1), id(2), id(3), id(4)}},
+        {"without epoch", "", "3", []string{id(1), id(2), id(3), id(4)}},
+        {"one mailbox", "?mailbox=b@example.com", id(1), []string{id(2), id(4)}},
+    }
+    for _, test := range tests {
+        if got := readEventIDs(t, server, test.query, test.lastEventID, len(test.want)); !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s: got events %v, want %v", test.name, got, test.want)
+        }
+    }
+
+    // Connected client receives new events after backlog. Wait for
+    // clients above to leave, then for the new one to subscribe
+    subscribers := func() int {
+        stream.mu.Lock()
+        defer stream.mu.Unlock()
+        return len(stream.subscribers)
+    }
+    for subscribers() > 0 {
+        runtime.Gosched()
+    }
+    done := make(chan []string)
+    go func() {
+        done <- readEventIDs(t, server, "", id(4), 1)
+    }()
+    for subscribers() == 0 {
+        runtime.Gosched()
+    }
+    stream.Publish(newMailEvent(EventMailboxDeleted, "a@example.com"))
+    if got := <-done; !reflect.DeepEqual(got, []string{id(5)}) {
+        t.Errorf("live: got events %v, want %v", got, []string{id(5)})
+    }
+
+    resp, err := http.Get(server.URL + "/events?last_event_id=" + stream.epoch + "-x")
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusBadRequest {
+        t.Errorf("invalid event ID: %s, want 400", resp.Status)
+    }
+}
@@ -0,0 +1,377 @@
+package tempmail
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "net"
+    "net/url"
+    "strings"
+    "time"
+
+    "github.com/nrdcg/mailinabox"
+)
+
+// CheckStatus is outcome of diagnostic check
+type CheckStatus int
+
+const (
+    CheckPassed  CheckStatus = iota
+    CheckWarning             // Works, but something should be fixed
+    CheckFailed
+    CheckSkipped // Not run because check it depends on failed
+)
+
+func (s CheckStatus) String() string {
+    switch s {
+    case CheckPassed:
+        return "passed"
+    case CheckWarning:
+        return "warning"
+    case CheckFailed:
+        return "failed"
+    default:
+        return "skipped"
+    }
+}
+
+// CheckResult is result of single diagnostic check
+type CheckResult struct {
+    Name     string
+    Status   CheckStatus
+    Detail   string        // What was found
+    Hint     string        // How to fix failed check or warning
+    Duration time.Duration // Time spent on check
+}
+
+// Certificates expiring sooner are reported as warning
+const certificateExpiryWarning = 14 * 24 * time.Hour
+
+// Longest wait for self-sent message in Diagnose
+const selfSendTimeout = 60 * time.Second
+
+// Diagnose checks whether server described by mailbox settings works: API
+// reachability and admin credentials, creating, logging in to and deleting
+// test user, IMAP and SMTP, DNS records of domain, TLS certificates and
+// delivery of message sent to itself. Checks run without retries, so
+// results show the first error. Each result is passed to progress, which
+// may be nil, as soon as check finishes. Test user is created on mailbox
+// and always deleted, failed deletion is reported with its address
+func (tm *TempMailbox) Diagnose(ctx context.Context, progress func(CheckResult)) []CheckResult {
+    var results []CheckResult
+    run := func(name string, check func() (CheckStatus, string, string)) CheckStatus {
+        start := time.Now()
+        status, detail, hint := check()
+        result := CheckResult{Name: name, Status: status, Detail: detail, Hint: hint, Duration: time.Since(start)}
+        results = append(results, result)
+        if progress != nil {
+            progress(result)
+        }
+        return status
+    }
+    skip := func(name, reason string) {
+        run(name, func() (CheckStatus, string, string) {
+            return CheckSkipped, reason, ""
+        })
+    }
+
+    // API and user round trip
+    apiOK := run("API connection", func() (CheckStatus, string, string) {
+        return tm.checkAPI(ctx)
+    }) != CheckFailed
+
+    userCreated := false
+    if apiOK {
+        userCreated = run("Create test user", func() (CheckStatus, string, string) {
+            domain := tm.Domain
+            if domain == "" {
+                var err error
+                if domain, err = tm.pickDomain(ctx); err != nil {
+                    return CheckFailed, err.Error(), "Set domain of new mailboxes"
+                }
+            }
+            tm.newCredentials(domain)
+            if err := tm.createInternal(ctx); err != nil {
+                return CheckFailed, err.Error(), "Check that domain " + domain + " is hosted on the server and the admin account may add users"
+            }
+            return CheckPassed, "Created " + tm.Address(), ""
+        }) == CheckPassed
+    } else {
+        skip("Create test user", "API is not available")
+    }
+
+    if userCreated {
+        run("IMAP login", func() (CheckStatus, string, string) {
+            return tm.checkIMAP(ctx)
+        })
+        run("SMTP submission", func() (CheckStatus, string, string) {
+            return tm.checkSMTP(ctx)
+        })
+        run("Self-send delivery", func() (CheckStatus, string, string) {
+            return tm.checkSelfSend(ctx)
+        })
+
+        // Delete even when context is done, so test user is not leaked
+        run("Delete test user", func() (CheckStatus, string, string) {
+            deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tm.timeouts().API)
+            defer cancel()
+            address := tm.Address()
+            if err := tm.Delete(deleteCtx); err != nil {
+                return CheckFailed, err.Error(), "Remove user " + address + " manually in Mail-in-a-Box admin panel"
+            }
+            return CheckPassed, "Deleted " + address, ""
+        })
+    } else {
+        for _, name := range []string{"IMAP login", "SMTP submission", "Self-send delivery", "Delete test user"} {
+            skip(name, "Test user was not created")
+        }
+    }
+
+    // DNS records, domain is unknown when it's chosen on creation and
+    // test user wasn't created
+    domain := tm.Domain
+    dnsChecks := []string{"MX record", "SPF record", "DKIM record", "DMARC record"}
+    if domain == "" {
+        for _, name := range dnsChecks {
+            skip(name, "Domain is not known")
+        }
+    } else {
+        run(dnsChecks[0], func() (CheckStatus, string, string) {
+            return checkMX(ctx, domain, tm.ImapServer)
+        })
+        run(dnsChecks[1], func() (CheckStatus, string, string) {
+            return checkTXT(ctx, domain, "v=spf1",
+                "Publish TXT record \"v=spf1 mx -all\" for "+domain+", see System -> Status Checks of Mail-in-a-Box")
+        })
+        run(dnsChecks[2], func() (CheckStatus, string, string) {
+            return checkTXT(ctx, "mail._domainkey."+domain, "v=DKIM1",
+                "Publish DKIM key shown in System -> External DNS of Mail-in-a-Box as mail._domainkey."+domain)
+        })
+        run(dnsChecks[3], func() (CheckStatus, string, string) {
+            return checkTXT(ctx, "_dmarc."+domain, "v=DMARC1",
+                "Publish TXT record \"v=DMARC1; p=quarantine;\" for _dmarc."+domain)
+        })
+    }
+
+    // Certificates
+    if host := apiHost(tm.apiURL); host != "" {
+        run("API certificate", func() (CheckStatus, string, string) {
+            return checkCertificate(ctx, tm.timeouts(), host)
+        })
+    }
+    run("IMAP certificate", func() (CheckStatus, string, string) {
+        return checkCertificate(ctx, tm.timeouts(), tm.ImapServer)
+    })
+
+    return results
+}
+
+// Check API is reachable and accepts admin credentials
+func (tm *TempMailbox) checkAPI(ctx context.Context) (CheckStatus, string, string) {
+    var domains []string
+    err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+        var err error
+        domains, err = client.Mail.GetDomains(ctx)
+        return err
+    })
+    switch {
+    case isAuthError(err):
+        return CheckFailed, err.Error(), "Check admin email and password, accounts with two-factor authentication need TOTP code"
+    case err != nil:
+        return CheckFailed, err.Error(), "Check API URL, it's address of the box without /admin, e.g. https://box.example.com"
+    }
+
+    detail := fmt.Sprintf("Server hosts %d domains", len(domains))
+    if tm.Domain == "" {
+        return CheckPassed, detail, ""
+    }
+    for _, domain := range domains {
+        if strings.EqualFold(domain, tm.Domain) {
+            return CheckPassed, detail, ""
+        }
+    }
+    return CheckWarning, detail, "Domain " + tm.Domain + " is not among server domains (" + strings.Join(domains, ", ") + ")"
+}
+
+// Check test user can log in to IMAP and select INBOX
+func (tm *TempMailbox) checkIMAP(ctx context.Context) (CheckStatus, string, string) {
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        if IsPermanent(err) {
+            return CheckFailed, err.Error(), "Server rejected login of new user, check that IMAP server belongs to the same box as API"
+        }
+        return CheckFailed, err.Error(), "Check IMAP server address and port (usually 993) and that firewall allows connection"
+    }
+    defer logout()
+
+    mbox, err := imapClient.Select("INBOX", true)
+    if err != nil {
+        return CheckFailed, fmt.Sprintf("error selecting folder: %v", err), "Mailbox of new user may be not created yet, try again later"
+    }
+    return CheckPassed, fmt.Sprintf("Logged in, INBOX has %d messages", mbox.Messages), ""
+}
+
+// Check test user can log in to SMTP submission server
+func (tm *TempMailbox) checkSMTP(ctx context.Context) (CheckStatus, string, string) {
+    server := tm.smtpServer()
+    smtpClient, closeClient, err := dialSMTP(ctx, tm.timeouts(), tm.verifyTLS(), server, tm.Address(), tm.Password)
+    if err != nil {
+        return CheckFailed, err.Error(), "Check SMTP server address and port (587 or 465) and that firewall allows connection"
+    }
+    defer closeClient()
+
+    if _, ok := smtpClient.TLSConnectionState(); !ok {
+        return CheckWarning, "Logged in to " + server + " without TLS", "Enable STARTTLS on submission port or use port 465"
+    }
+    smtpClient.Quit()
+    return CheckPassed, "Logged in to " + server, ""
+}
+
+// Send message to test user itself and wait until it arrives
+func (tm *TempMailbox) checkSelfSend(ctx context.Context) (CheckStatus, string, string) {
+    subject := "MalinaTEMP diagnostics " + generateRandomString(8)
+    data, err := buildMessage(tm.Address(), OutgoingEmail{
+        To:      []string{tm.Address()},
+        Subject: subject,
+        Text:    "Test message sent by MalinaTEMP diagnostics",
+    })
+    if err != nil {
+        return CheckFailed, fmt.Sprintf("error building message: %v", err), ""
+    }
+
+    start := time.Now()
+    err = sendSMTP(ctx, tm.timeouts(), tm.verifyTLS(), tm.smtpServer(), tm.Address(), tm.Password, tm.Address(),
+        []string{tm.Address()}, data)
+    if err != nil {
+        return CheckFailed, err.Error(), "Server didn't accept message, see SMTP submission check"
+    }
+
+    waitCtx, cancel := context.WithTimeout(ctx, selfSendTimeout)
+    defer cancel()
+    for {
+        emails, err := tm.checkMailInternal(waitCtx)
+        if err == nil {
+            for _, email := range emails {
+                if email.Subject == subject {
+                    return CheckPassed, fmt.Sprintf("Delivered in %s", time.Since(start).Round(time.Millisecond)), ""
+                }
+            }
+        }
+
+        select {
+        case <-waitCtx.Done():
+            return CheckFailed, fmt.Sprintf("Message not delivered within %s", selfSendTimeout),
+                "Check mail queue of the box (System -> Status Checks) and spam filter settings"
+        case <-time.After(DefaultPollInterval):
+        }
+    }
+}
+
+// Check domain has MX record and, when IMAP server is set, that MX points
+// to the same host
+func checkMX(ctx context.Context, domain, imapServer string) (CheckStatus, string, string) {
+    records, err := net.DefaultResolver.LookupMX(ctx, domain)
+    if err != nil || len(records) == 0 {
+        return CheckFailed, fmt.Sprintf("no MX record: %v", err), "Publish MX record of " + domain + " pointing to the box"
+    }
+
+    var hosts []string
+    for _, record := range records {
+        hosts = append(hosts, strings.TrimSuffix(record.Host, "."))
+    }
+    detail := strings.Join(hosts, ", ")
+
+    imapHost, _, err := net.SplitHostPort(imapServer)
+    if err != nil {
+        imapHost = imapServer
+    }
+    for _, host := range hosts {
+        if strings.EqualFold(host, imapHost) {
+            return CheckPassed, detail, ""
+        }
+    }
+    return CheckWarning, detail, "MX doesn't point to " + imapHost + ", mail from outside may go to another server"
+}
+
+// Check name has TXT record starting with prefix
+func checkTXT(ctx context.Context, name, prefix, hint string) (CheckStatus, string, string) {
+    records, err := net.DefaultResolver.LookupTXT(ctx, name)
+    if err != nil {
+        return CheckFailed, fmt.Sprintf("no TXT record: %v", err), hint
+    }
+    for _, record := range records {
+        if strings.HasPrefix(strings.ToLower(record), strings.ToLower(prefix)) {
+            return CheckPassed, record, ""
+        }
+    }
+    return CheckFailed, fmt.Sprintf("no %s record among %d TXT records", prefix, len(records)), hint
+}
+
+// Return host:port of API URL, port 443 when URL has none
+func apiHost(apiURL string) string {
+    parsed, err := url.Parse(apiURL)
+    if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+        return ""
+    }
+    port := parsed.Port()
+    if port == "" {
+        port = "443"
+    }
+    return net.JoinHostPort(parsed.Hostname(), port)
+}
+
+// Check TLS certificate of server is trusted and doesn't expire soon
+func checkCertificate(ctx context.Context, timeouts Timeouts, server string) (CheckStatus, string, string) {
+    host, _, err := net.SplitHostPort(server)
+    if err != nil {
+        return CheckFailed, fmt.Sprintf("invalid server address: %v", err), "Use host:port address"
+    }
+
+    // Certificate is fetched without verification, so untrusted one can
+    // still be described
+    dialer := &tls.Dialer{
+        NetDialer: &net.Dialer{Timeout: timeouts.Dial},
+        Config:    &tls.Config{ServerName: host, InsecureSkipVerify: true},
+    }
+    conn, err := dialer.DialContext(ctx, "tcp", server)
+    if err != nil {
+        return CheckFailed, fmt.Sprintf("error connecting: %v", err), "Check that " + server + " accepts TLS connections"
+    }
+    defer conn.Close()
+
+    certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+    if len(certs) == 0 {
+        return CheckFailed, "server sent no certificate", ""
+    }
+    leaf := certs[0]
+    remaining := time.Until(leaf.NotAfter)
+    issuer := leaf.Issuer.CommonName
+    if issuer == "" {
+        issuer = leaf.Issuer.String()
+    }
+    detail := fmt.Sprintf("Issued by %s, expires %s", issuer, leaf.NotAfter.Format("2006-01-02"))
+
+    if remaining <= 0 {
+        return CheckFailed, detail, "Certificate expired, renew it in System -> TLS (SSL) Certificates of Mail-in-a-Box"
+    }
+
+    intermediates := x509.NewCertPool()
+    for _, cert := range certs[1:] {
+        intermediates.AddCert(cert)
+    }
+    _, err = leaf.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates})
+    var unknownAuthority x509.UnknownAuthorityError
+    switch {
+    case errors.As(err, &unknownAuthority):
+        return CheckWarning, detail + ", self-signed",
+            "Provision Let's Encrypt certificate in System -> TLS (SSL) Certificates, or keep TLS policy skipping verification"
+    case err != nil:
+        return CheckWarning, fmt.Sprintf("%s, not trusted: %v", detail, err),
+            "Provision certificate for " + host + " in System -> TLS (SSL) Certificates"
+    case remaining < certificateExpiryWarning:
+        return CheckWarning, detail, fmt.Sprintf("Certificate expires in %d days, check automatic renewal", int(remaining.Hours()/24))
+    }
+    return CheckPassed, detail, ""
+}
@@ -0,0 +1,80 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "math/rand"
+    "strings"
+    "sync/atomic"
+
+    "github.com/nrdcg/mailinabox"
+)
+
+// Ways of choosing domain of new mailbox, see TempMailbox.DomainSelection
+const (
+    DomainFixed      = ""            // Always TempMailbox.Domain
+    DomainRandom     = "random"      // Random domain for each mailbox
+    DomainRoundRobin = "round-robin" // Domains in turn
+)
+
+// Position of round-robin selection shared by all mailboxes of process, so
+// mailboxes allocated by parallel tests are spread too. Starts at random
+// position so separate runs don't all begin with the same domain
+var roundRobin atomic.Uint64
+
+func init() {
+    roundRobin.Store(uint64(rand.Intn(1 << 16)))
+}
+
+// ServerDomains returns mail domains hosted on server
+func (tm *TempMailbox) ServerDomains(ctx context.Context) ([]string, error) {
+    var domains []string
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        var result []string
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            var err error
+            result, err = client.Mail.GetDomains(ctx)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error getting domains: %w", err)
+        }
+        domains = nil
+        for _, domain := range result {
+            if domain = strings.TrimSpace(domain); domain != "" {
+                domains = append(domains, domain)
+            }
+        }
+        return nil
+    })
+    return domains, err
+}
+
+// Choose domain of new mailbox according to DomainSelection
+func (tm *TempMailbox) pickDomain(ctx context.Context) (string, error) {
+    tm.mu.Lock()
+    selection, domains := tm.DomainSelection, tm.Domains
+    tm.mu.Unlock()
+    if selection == DomainFixed {
+        return tm.Domain, nil
+    }
+
+    if len(domains) == 0 {
+        var err error
+        if domains, err = tm.ServerDomains(ctx); err != nil {
+            return "", err
+        }
+        if len(domains) == 0 {
+            return "", fmt.Errorf("server has no mail domains")
+        }
+    }
+
+    switch selection {
+    case DomainRandom:
+        return domains[rand.Intn(len(domains))], nil
+    case DomainRoundRobin:
+        return domains[(roundRobin.Add(1)-1)%uint64(len(domains))], nil
+    default:
+        return "", &PermanentError{fmt.Errorf("unknown domain selection %q", selection)}
+    }
+}
@@ -0,0 +1,50 @@
+package tempmail_test
+
+import (
+    "context"
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+func TestPickDomain(t *testing.T) {
+    ctx := context.Background()
+    domains := []string{"a.example", "b.example", "c.example"}
+
+    fixed := &tempmail.TempMailbox{Domain: "example.com", Domains: domains}
+    for i := 0; i < 3; i++ {
+        if got, err := fixed.PickDomain(ctx); err != nil || got != "example.com" {
+            t.Fatalf("fixed selection picked %q, %v, want example.com", got, err)
+        }
+    }
+
+    random := &tempmail.TempMailbox{Domain: "example.com", DomainSelection: tempmail.DomainRandom, Domains: domains}
+    for i := 0; i < 20; i++ {
+        got, err := random.PickDomain(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got != "a.example" && got != "b.example" && got != "c.example" {
+            t.Fatalf("random selection picked %q outside of %v", got, domains)
+        }
+    }
+
+    // Round-robin starts at random position, but covers all domains in turn
+    roundRobin := &tempmail.TempMailbox{Domain: "example.com", DomainSelection: tempmail.DomainRoundRobin, Domains: domains}
+    picked := map[string]bool{}
+    for i := 0; i < len(domains); i++ {
+        got, err := roundRobin.PickDomain(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        picked[got] = true
+    }
+    if len(picked) != len(domains) {
+        t.Errorf("round-robin picked %v, want each of %v once", picked, domains)
+    }
+
+    unknown := &tempmail.TempMailbox{Domain: "example.com", DomainSelection: "sorted", Domains: domains}
+    if _, err := unknown.PickDomain(ctx); err == nil || !tempmail.IsPermanent(err) {
+        t.Errorf("got error %v for unknown selection, want permanent error", err)
+    }
+}
@@ -0,0 +1,202 @@
+package tempmail
+
+import (
+    "bufio"
+    "bytes"
+    "fmt"
+    "io"
+    "mime"
+    "net/mail"
+    "os"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// Date format of mbox "From " separator lines
+const mboxDateFormat = "Mon Jan _2 15:04:05 2006"
+
+// Parse raw message source (e.g. imported .eml file) into Email using the
+// same parser as messages fetched from IMAP
+func ParseRawEmail(raw []byte) Email {
+    email := Email{
+        Raw:  raw,
+        Seen: true,
+    }
+
+    if m, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+        email.Subject = decodeRFC2047(m.Header.Get("Subject"))
+        email.MessageID = strings.Trim(m.Header.Get("Message-Id"), "<> ")
+        if date, err := m.Header.Date(); err == nil {
+            email.Date = date
+        }
+
+        parser := mail.AddressParser{WordDecoder: &mime.WordDecoder{}}
+        if addr, err := parser.Parse(m.Header.Get("From")); err == nil {
+            email.FromAddress = addr.Address
+            if addr.Name != "" {
+                email.From = addr.Name
+            } else {
+                email.From = addr.Address
+            }
+        } else {
+            email.From = decodeRFC2047(m.Header.Get("From"))
+        }
+    }
+
+    parseMessageBody(&email, raw)
+    return email
+}
+
+// Write raw message source as .eml file
+func WriteEML(w io.Writer, email Email) error {
+    if len(email.Raw) == 0 {
+        return fmt.Errorf("message source is not available")
+    }
+    if _, err := w.Write(email.Raw); err != nil {
+        return fmt.Errorf("error writing message: %w", err)
+    }
+    return nil
+}
+
+// Write messages in mboxrd format
+func WriteMbox(w io.Writer, emails []Email) error {
+    bw := bufio.NewWriter(w)
+
+    for _, email := range emails {
+        if len(email.Raw) == 0 {
+            return fmt.Errorf("message source is not available for %q", email.Subject)
+        }
+
+        date := email.Date
+        if date.IsZero() {
+            date = time.Now()
+        }
+        fmt.Fprintf(bw, "From MAILER-DAEMON %s\n", date.UTC().Format(mboxDateFormat))
+
+        // mbox uses LF line endings, lines starting with "From " (optionally
+        // quoted with '>') get one more '>'
+        raw := bytes.ReplaceAll(email.Raw, []byte("\r\n"), []byte("\n"))
+        scanner := bufio.NewScanner(bytes.NewReader(raw))
+        scanner.Buffer(make([]byte, 64*1024), len(raw)+1)
+        for scanner.Scan() {
+            line := scanner.Text()
+            if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+                bw.WriteString(">")
+            }
+            bw.WriteString(line)
+            bw.WriteString("\n")
+        }
+        if err := scanner.Err(); err != nil {
+            return fmt.Errorf("error reading message: %w", err)
+        }
+        bw.WriteString("\n")
+    }
+
+    if err := bw.Flush(); err != nil {
+        return fmt.Errorf("error writing mbox: %w", err)
+    }
+    return nil
+}
+
+// Read messages from mboxrd (or mboxo) file
+func ReadMbox(r io.Reader) ([]Email, error) {
+    var emails []Email
+    var current *bytes.Buffer
+
+    flush := func() {
+        if current == nil {
+            return
+        }
+        raw := bytes.TrimSuffix(current.Bytes(), []byte("\n"))
+        emails = append(emails, ParseRawEmail(raw))
+        current = nil
+    }
+
+    reader := bufio.NewReader(r)
+    for {
+        line, err := reader.ReadString('\n')
+        if line != "" {
+            if strings.HasPrefix(line, "From ") {
+                flush()
+                current = new(bytes.Buffer)
+            } else if current != nil {
+                trimmed := strings.TrimLeft(line, ">")
+                if strings.HasPrefix(trimmed, "From ") && len(trimmed) < len(line) {
+                    line = line[1:]
+                }
+                current.WriteString(line)
+            }
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("error reading mbox: %w", err)
+        }
+    }
+    flush()
+
+    if len(emails) == 0 {
+        return nil, fmt.Errorf("no messages found in mbox")
+    }
+    return emails, nil
+}
+
+// Write messages into Maildir directory, creating it if needed
+func WriteMaildir(dir string, emails []Email) error {
+    for _, sub := range []string{"tmp", "new", "cur"} {
+        if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+            return fmt.Errorf("error creating maildir: %w", err)
+        }
+    }
+
+    hostname, err := os.Hostname()
+    if err != nil {
+        hostname = "localhost"
+    }
+    hostname = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(hostname)
+
+    for i, email := range emails {
+        if len(email.Raw) == 0 {
+            return fmt.Errorf("message source is not available for %q", email.Subject)
+        }
+
+        name := fmt.Sprintf("%d.M%dP%dQ%d.%s", time.Now().Unix(), time.Now().Nanosecond()/1000, os.Getpid(), i, hostname)
+
+        // Maildir info flags must be in alphabetical order
+        info := ":2,"
+        if email.Flagged {
+            info += "F"
+        }
+        if email.Seen {
+            info += "S"
+        }
+
+        tmpPath := filepath.Join(dir, "tmp", name)
+        if err := os.WriteFile(tmpPath, email.Raw, 0600); err != nil {
+            return fmt.Errorf("error writing message: %w", err)
+        }
+        if !email.Date.IsZero() {
+            os.Chtimes(tmpPath, email.Date, email.Date)
+        }
+        if err := os.Rename(tmpPath, filepath.Join(dir, "cur", name+info)); err != nil {
+            return fmt.Errorf("error delivering message: %w", err)
+        }
+    }
+
+    return nil
+}
+
+// Read messages from .eml or mbox file depending on its content
+func ImportMessages(r io.Reader) ([]Email, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, fmt.Errorf("error reading file: %w", err)
+    }
+
+    if bytes.HasPrefix(data, []byte("From ")) {
+        return ReadMbox(bytes.NewReader(data))
+    }
+    return []Email{ParseRawEmail(data)}, nil
+}
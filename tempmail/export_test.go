@@ -0,0 +1,30 @@
+package tempmail
+
+import "context"
+
+// Internals covered by table tests
+var (
+    WithRetry    = withRetry
+    NextInterval = nextInterval
+    Jittered     = jittered
+    ExpandUIDSet = expandUIDSet
+)
+
+func (m Match) Compile() (func(Email) bool, error) {
+    return m.compile()
+}
+
+func (tm *TempMailbox) PickDomain(ctx context.Context) (string, error) {
+    return tm.pickDomain(ctx)
+}
+
+// Sieve client for tests talking to tempmail/sievetest directly
+var DialSieve = dialSieve
+
+func (c *sieveClient) Command(line string) ([]string, error) {
+    return c.command(line)
+}
+
+func (c *sieveClient) CommandWithScript(line, script string) ([]string, error) {
+    return c.commandWithScript(line, script)
+}
@@ -0,0 +1,88 @@
+package tempmail
+
+import (
+    "regexp"
+    "strings"
+
+    "golang.org/x/net/html"
+)
+
+var (
+    // Codes explicitly introduced by a keyword, e.g. "Your code: AB12CD"
+    keywordCodeRegexp = regexp.MustCompile(`(?i)(?:code|pin|otp|password|token)[^A-Za-z0-9\n]{0,20}([A-Za-z0-9-]{4,12})\b`)
+    // Standalone numeric codes of 4 to 8 digits
+    numericCodeRegexp = regexp.MustCompile(`\b\d{4,8}\b`)
+    // Links in plain text
+    linkRegexp = regexp.MustCompile(`https?://[^\s<>"')\]]+`)
+)
+
+// Extract verification codes from message text. Codes introduced by a
+// keyword come first, followed by standalone numeric codes
+func ExtractCodes(text string) []string {
+    var codes []string
+    seen := map[string]bool{}
+    add := func(code string) {
+        if !seen[code] {
+            seen[code] = true
+            codes = append(codes, code)
+        }
+    }
+
+    for _, match := range keywordCodeRegexp.FindAllStringSubmatch(text, -1) {
+        // Keyword match must contain at least one digit to look like a code
+        if strings.ContainsAny(match[1], "0123456789") {
+            add(match[1])
+        }
+    }
+    for _, match := range numericCodeRegexp.FindAllString(text, -1) {
+        add(match)
+    }
+    return codes
+}
+
+// Extract links from message text and href attributes of HTML content
+func ExtractLinks(text, htmlContent string) []string {
+    var links []string
+    seen := map[string]bool{}
+    add := func(link string) {
+        link = strings.TrimRight(link, ".,;:!?")
+        if link != "" && !seen[link] {
+            seen[link] = true
+            links = append(links, link)
+        }
+    }
+
+    if htmlContent != "" {
+        if doc, err := html.Parse(strings.NewReader(htmlContent)); err == nil {
+            var walk func(*html.Node)
+            walk = func(n *html.Node) {
+                if n.Type == html.ElementNode && n.Data == "a" {
+                    for _, attr := range n.Attr {
+                        if attr.Key == "href" && (strings.HasPrefix(attr.Val, "http://") || strings.HasPrefix(attr.Val, "https://")) {
+                            add(attr.Val)
+                        }
+                    }
+                }
+                for c := n.FirstChild; c != nil; c = c.NextSibling {
+                    walk(c)
+                }
+            }
+            walk(doc)
+        }
+    }
+
+    for _, match := range linkRegexp.FindAllString(text, -1) {
+        add(match)
+    }
+    return links
+}
+
+// Codes returns verification codes found in message text
+func (e Email) Codes() []string {
+    return ExtractCodes(e.Content)
+}
+
+// Links returns links found in message text and HTML
+func (e Email) Links() []string {
+    return ExtractLinks(e.Content, e.HTMLContent)
+}
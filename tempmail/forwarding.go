@@ -0,0 +1,116 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "net/mail"
+    "strings"
+
+    "github.com/nrdcg/mailinabox"
+)
+
+// Forwarding is implemented as Mail-in-a-Box alias with address of the
+// mailbox, which forwards to the mailbox itself and to target addresses,
+// so mail is still delivered to the mailbox too
+
+// Return alias of address, nil when there is none
+func findAlias(ctx context.Context, client *mailinabox.Client, address string) (*mailinabox.Alias, error) {
+    domains, err := client.Mail.GetAliases(ctx)
+    if err != nil {
+        return nil, err
+    }
+    for _, domain := range domains {
+        for _, alias := range domain.Aliases {
+            if strings.EqualFold(alias.Address, address) {
+                alias := alias
+                return &alias, nil
+            }
+        }
+    }
+    return nil, nil
+}
+
+// Return whether alias forwards to address itself, which marks forwarding
+// alias of mailbox
+func isForwardingAlias(alias *mailinabox.Alias, address string) bool {
+    for _, target := range alias.ForwardsTo {
+        if strings.EqualFold(target, address) {
+            return true
+        }
+    }
+    return false
+}
+
+// Forwarding returns addresses mail of the mailbox is forwarded to
+func (tm *TempMailbox) Forwarding(ctx context.Context) ([]string, error) {
+    address := tm.Address()
+    var targets []string
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        return tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            alias, err := findAlias(ctx, client, address)
+            if err != nil {
+                return fmt.Errorf("error getting aliases: %w", err)
+            }
+            targets = nil
+            if alias == nil || !isForwardingAlias(alias, address) {
+                return nil
+            }
+            for _, target := range alias.ForwardsTo {
+                if !strings.EqualFold(target, address) {
+                    targets = append(targets, target)
+                }
+            }
+            return nil
+        })
+    })
+    return targets, err
+}
+
+// SetForwarding forwards copy of each incoming message to target
+// addresses. Empty list turns forwarding off
+func (tm *TempMailbox) SetForwarding(ctx context.Context, targets []string) error {
+    address := tm.Address()
+    forwardsTo := []string{address}
+    for _, target := range targets {
+        parsed, err := mail.ParseAddress(target)
+        if err != nil {
+            return &PermanentError{fmt.Errorf("invalid forwarding address %q: %w", target, err)}
+        }
+        if !strings.EqualFold(parsed.Address, address) {
+            forwardsTo = append(forwardsTo, parsed.Address)
+        }
+    }
+    if len(forwardsTo) == 1 {
+        return tm.removeForwarding(ctx, address)
+    }
+
+    return withRetry(ctx, tm.retry().Modify, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            _, err := client.Mail.UpsertAlias(ctx, true, address, forwardsTo, nil)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error setting forwarding: %w", err)
+        }
+        return nil
+    })
+}
+
+// Remove forwarding alias of address if it exists. Other aliases with the
+// same address are kept
+func (tm *TempMailbox) removeForwarding(ctx context.Context, address string) error {
+    return withRetry(ctx, tm.retry().Modify, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            alias, err := findAlias(ctx, client, address)
+            if err != nil || alias == nil || !isForwardingAlias(alias, address) {
+                return err
+            }
+            _, err = client.Mail.RemoveAliases(ctx, address)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error removing forwarding: %w", err)
+        }
+        return nil
+    })
+}
@@ -0,0 +1,624 @@
+// Package tempmail creates temporary mailboxes on Mail-in-a-Box servers and
+// reads, sends and manages their mail. It powers MalinaTEMP desktop app and
+// can be imported by integration tests:
+//
+//    mailbox, err := tempmail.Allocate(ctx, config)
+//    if err != nil {
+//        t.Fatal(err)
+//    }
+//    defer mailbox.Delete(context.Background())
+//
+//    email, err := mailbox.WaitFor(ctx, tempmail.Match{SubjectRegex: "(?i)confirm"})
+//    if err != nil {
+//        t.Fatal(err)
+//    }
+//    code := email.Codes()[0]
+package tempmail
+
+import (
+    "bytes"
+    "context"
+    "crypto/tls"
+    "fmt"
+    "io"
+    "log/slog"
+    "math/rand"
+    "net"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/emersion/go-imap"
+    "github.com/emersion/go-imap/client"
+    "github.com/nrdcg/mailinabox"
+)
+
+// Timeouts limits duration of network operations. Zero fields use values
+// of DefaultTimeouts
+type Timeouts struct {
+    Dial    time.Duration // Connecting to IMAP and SMTP servers
+    Command time.Duration // Single IMAP or SMTP command
+    API     time.Duration // Single Mail-in-a-Box API request
+}
+
+// Default timeouts of network operations
+var DefaultTimeouts = Timeouts{
+    Dial:    15 * time.Second,
+    Command: 60 * time.Second,
+    API:     30 * time.Second,
+}
+
+// TempMailbox is Mail-in-a-Box user with random name. Its methods may be
+// called from several goroutines, except Create and CreateOnDomain, which
+// set credentials and must not run alongside other calls. Exported fields
+// are set before use; settings of mailbox in use are changed with
+// SetTimeouts, SetRetry, SetVerifyTLS, SetSieveServer, SetMailboxQuota and
+// SetDomainSelection
+type TempMailbox struct {
+    Domain     string
+    Username   string
+    Password   string
+    ImapServer string
+    SmtpServer string
+
+    // API client, replaced after reauthentication while methods run
+    Client *mailinabox.Client
+
+    // ManageSieve server for filter rules, IMAP host with port 4190 when empty
+    SieveServer string
+
+    // Storage quota set by Create, such as "50M", server default when empty.
+    // Create fails and removes the mailbox when quota can't be set
+    MailboxQuota string
+
+    // How Create chooses domain, one of DomainFixed, DomainRandom and
+    // DomainRoundRobin. Domain holds domain of created mailbox
+    DomainSelection string
+
+    // Domains to choose from, all domains of server when empty
+    Domains []string
+
+    // Interval between mailbox checks in WaitFor, DefaultPollInterval if zero
+    PollInterval time.Duration
+
+    // Timeouts of network operations, see DefaultTimeouts
+    Timeouts Timeouts
+
+    // Retry policies of operations, see DefaultRetryPolicies
+    Retry RetryPolicies
+
+    // Verify TLS certificates of IMAP and SMTP servers. Disabled by default
+    // because many Mail-in-a-Box boxes use self-signed certificates
+    VerifyTLS bool
+
+    // Called when API rejects admin credentials, for example after session
+    // key expired. Rejected is password or session key that failed, so
+    // concurrent calls can return key issued meanwhile instead of logging
+    // in again. Returns new session key or password, see Login
+    Reauthenticate func(ctx context.Context, rejected string) (string, error)
+
+    apiURL      string
+    adminEmail  string
+    mu          sync.Mutex // Guards Client, adminSecret, trash and fields changed by setters
+    adminSecret string     // Password or session key of Client
+    trash       string     // Cached name of trash folder
+}
+
+// Email is parsed message of mailbox
+type Email struct {
+    From        string
+    FromAddress string
+    Subject     string
+    Content     string
+    HTMLContent string
+    UID         uint32
+    Seen        bool
+    Flagged     bool
+    Date        time.Time
+    MessageID   string // Message-ID header without angle brackets
+    Raw         []byte // Raw message source as fetched from server
+}
+
+func NewTempMailbox(apiURL, adminEmail, adminPassword, domain, imapServer, smtpServer string) (*TempMailbox, error) {
+    client, err := mailinabox.New(apiURL, adminEmail, adminPassword)
+    if err != nil {
+        return nil, fmt.Errorf("error creating client: %w", err)
+    }
+
+    return &TempMailbox{
+        Domain:      domain,
+        ImapServer:  imapServer,
+        SmtpServer:  smtpServer,
+        Client:      client,
+        apiURL:      apiURL,
+        adminEmail:  adminEmail,
+        adminSecret: adminPassword,
+    }, nil
+}
+
+// SetTimeouts changes timeouts of mailbox, next operations use them
+func (tm *TempMailbox) SetTimeouts(timeouts Timeouts) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.Timeouts = timeouts
+}
+
+// SetRetry changes retry policies of mailbox, next operations use them
+func (tm *TempMailbox) SetRetry(retry RetryPolicies) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.Retry = retry
+}
+
+// SetVerifyTLS changes whether certificates are verified on next connections
+func (tm *TempMailbox) SetVerifyTLS(verify bool) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.VerifyTLS = verify
+}
+
+// SetSieveServer changes ManageSieve server used by next filter operations
+func (tm *TempMailbox) SetSieveServer(server string) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.SieveServer = server
+}
+
+// SetMailboxQuota changes quota set by next Create
+func (tm *TempMailbox) SetMailboxQuota(quota string) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.MailboxQuota = quota
+}
+
+// SetDomainSelection changes how next Create chooses domain
+func (tm *TempMailbox) SetDomainSelection(selection string, domains []string) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    tm.DomainSelection = selection
+    tm.Domains = domains
+}
+
+// Return whether certificates are verified
+func (tm *TempMailbox) verifyTLS() bool {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    return tm.VerifyTLS
+}
+
+// Return quota of new mailboxes
+func (tm *TempMailbox) mailboxQuota() string {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    return tm.MailboxQuota
+}
+
+// Return timeouts of mailbox with defaults for unset values
+func (tm *TempMailbox) timeouts() Timeouts {
+    tm.mu.Lock()
+    timeouts := tm.Timeouts
+    tm.mu.Unlock()
+    if timeouts.Dial <= 0 {
+        timeouts.Dial = DefaultTimeouts.Dial
+    }
+    if timeouts.Command <= 0 {
+        timeouts.Command = DefaultTimeouts.Command
+    }
+    if timeouts.API <= 0 {
+        timeouts.API = DefaultTimeouts.API
+    }
+    return timeouts
+}
+
+// Return retry policies of mailbox with defaults for unset values
+func (tm *TempMailbox) retry() RetryPolicies {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    return tm.Retry.WithDefaults()
+}
+
+// Create registers new user with random name and password on server, on
+// domain chosen according to DomainSelection
+func (tm *TempMailbox) Create(ctx context.Context) error {
+    domain, err := tm.pickDomain(ctx)
+    if err != nil {
+        return err
+    }
+    return tm.CreateOnDomain(ctx, domain)
+}
+
+// CreateOnDomain creates user with random name on given domain regardless
+// of DomainSelection
+func (tm *TempMailbox) CreateOnDomain(ctx context.Context, domain string) error {
+    tm.newCredentials(domain)
+
+    attempted := false
+    err := withRetry(ctx, tm.retry().Account, func() error {
+        // Failed attempt may still have created the user, reuse it instead
+        // of leaving it on server
+        if attempted {
+            exists, err := tm.userExists(ctx)
+            if err != nil {
+                return err
+            }
+            if exists {
+                slog.Info("Reusing user created by failed attempt", "mailbox", tm.Address())
+                return nil
+            }
+        }
+        attempted = true
+        return tm.createInternal(ctx)
+    })
+    quota := tm.mailboxQuota()
+    if err != nil || quota == "" {
+        return err
+    }
+    // Mailbox without quota could fill server disk, remove it even when
+    // context is done
+    if err := tm.SetQuota(ctx, tm.Address(), quota); err != nil {
+        deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), tm.timeouts().API)
+        defer cancel()
+        if deleteErr := tm.Delete(deleteCtx); deleteErr != nil {
+            slog.Error("Error deleting mailbox without quota", "mailbox", tm.Address(), "error", deleteErr)
+        }
+        return fmt.Errorf("error setting quota of new mailbox: %w", err)
+    }
+    return nil
+}
+
+// Set random name and password of new user on domain
+func (tm *TempMailbox) newCredentials(domain string) {
+    tm.Username = generateRandomString(10)
+    tm.Password = generateRandomString(16)
+    tm.Domain = domain
+    tm.mu.Lock()
+    tm.trash = ""
+    tm.mu.Unlock()
+}
+
+// Add user with current credentials on server
+func (tm *TempMailbox) createInternal(ctx context.Context) error {
+    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
+    
+    err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+        _, err := client.Mail.AddUser(ctx, email, tm.Password, "email")
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("error creating user: %w", err)
+    }
+
+    return nil
+}
+
+// Return whether active user of the mailbox exists on server
+func (tm *TempMailbox) userExists(ctx context.Context) (bool, error) {
+    exists := false
+    err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+        domains, err := client.Mail.GetUsers(ctx)
+        if err != nil {
+            return err
+        }
+        for _, domain := range domains {
+            for _, user := range domain.Users {
+                if strings.EqualFold(user.Email, tm.Address()) && user.Status != "inactive" {
+                    exists = true
+                }
+            }
+        }
+        return nil
+    })
+    if err != nil {
+        return false, fmt.Errorf("error getting users: %w", err)
+    }
+    return exists, nil
+}
+
+// Delete removes user of the mailbox and its forwarding from server
+func (tm *TempMailbox) Delete(ctx context.Context) error {
+    // Forwarding would keep sending mail of the address to targets after
+    // user is gone, so deletion stops when it can't be removed
+    if err := tm.removeForwarding(ctx, tm.Address()); err != nil {
+        return err
+    }
+    return withRetry(ctx, tm.retry().Account, func() error {
+        return tm.deleteInternal(ctx)
+    })
+}
+
+func (tm *TempMailbox) deleteInternal(ctx context.Context) error {
+    email := fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
+    err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+        _, err := client.Mail.RemoveUser(ctx, email)
+        return err
+    })
+    if err != nil {
+        return fmt.Errorf("error deleting user: %w", err)
+    }
+    return nil
+}
+
+// Address returns full email address of the mailbox
+func (tm *TempMailbox) Address() string {
+    return fmt.Sprintf("%s@%s", tm.Username, tm.Domain)
+}
+
+// Dial IMAP server and log in with mailbox credentials. Connection is
+// closed when context is done, which interrupts running command. Returned
+// function logs out and must be called when client is no longer needed
+func (tm *TempMailbox) connectIMAP(ctx context.Context) (*client.Client, func(), error) {
+    imapClient, err := dialIMAP(ctx, tm.ImapServer, tm.timeouts(), tm.verifyTLS())
+    if err != nil {
+        return nil, nil, err
+    }
+
+    stop := context.AfterFunc(ctx, func() {
+        imapClient.Terminate()
+    })
+    logout := func() {
+        if stop() {
+            imapClient.Logout()
+        }
+    }
+
+    if err := imapClient.Login(tm.Address(), tm.Password); err != nil {
+        // Connection stays unauthenticated when server rejected credentials
+        rejected := imapClient.State() == imap.NotAuthenticatedState
+        logout()
+        if ctx.Err() != nil {
+            return nil, nil, fmt.Errorf("error authenticating IMAP: %w", ctx.Err())
+        }
+        if rejected {
+            return nil, nil, fmt.Errorf("error authenticating IMAP: %w", &PermanentError{Err: err})
+        }
+        return nil, nil, fmt.Errorf("error authenticating IMAP: %w", err)
+    }
+
+    return imapClient, logout, nil
+}
+
+// Dial IMAP server over TLS with dial and command timeouts
+func dialIMAP(ctx context.Context, server string, timeouts Timeouts, verifyTLS bool) (*client.Client, error) {
+    tlsConfig := &tls.Config{
+        InsecureSkipVerify: !verifyTLS,
+    }
+
+    // Dial timeout also covers TLS handshake and server greeting
+    dialTimeout := timeouts.Dial
+    if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < dialTimeout {
+        dialTimeout = time.Until(deadline)
+    }
+    if err := ctx.Err(); err != nil {
+        return nil, fmt.Errorf("error connecting to IMAP: %w", err)
+    }
+
+    dialer := &net.Dialer{Timeout: dialTimeout}
+    imapClient, err := client.DialWithDialerTLS(dialer, server, tlsConfig)
+    if err != nil {
+        return nil, fmt.Errorf("error connecting to IMAP: %w", err)
+    }
+    imapClient.Timeout = timeouts.Command
+
+    return imapClient, nil
+}
+
+// DeleteAllMails moves all messages of INBOX to trash and returns their
+// number and their UIDs in trash folder, nil when server doesn't support
+// UIDPLUS
+func (tm *TempMailbox) DeleteAllMails(ctx context.Context) (int, []uint32, error) {
+    var moved int
+    var trashUIDs []uint32
+
+    err := withRetry(ctx, tm.retry().Modify, func() error {
+        var deleteErr error
+        moved, trashUIDs, deleteErr = tm.deleteAllMailsInternal(ctx)
+        return deleteErr
+    })
+
+    return moved, trashUIDs, err
+}
+
+func (tm *TempMailbox) deleteAllMailsInternal(ctx context.Context) (int, []uint32, error) {
+    slog.Info("Deleting all mails", "mailbox", tm.Address())
+    return tm.moveToTrashInternal(ctx, nil)
+}
+
+// Updated CheckMail method with retry support
+func (tm *TempMailbox) CheckMail(ctx context.Context) ([]Email, error) {
+    var emails []Email
+    
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        var checkErr error
+        emails, checkErr = tm.checkMailInternal(ctx)
+        return checkErr
+    })
+    
+    return emails, err
+}
+
+// Renamed original CheckMail method to checkMailInternal
+func (tm *TempMailbox) checkMailInternal(ctx context.Context) ([]Email, error) {
+    slog.Debug("Checking mail", "mailbox", tm.Address())
+
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer logout()
+    slog.Debug("Connected to IMAP")
+
+    return fetchFolder(imapClient, "INBOX")
+}
+
+// Fetch and parse all messages of folder
+func fetchFolder(imapClient *client.Client, folder string) ([]Email, error) {
+    mbox, err := imapClient.Select(folder, true)
+    if err != nil {
+        return nil, fmt.Errorf("error selecting folder: %w", err)
+    }
+    slog.Debug("Selected folder", "folder", folder, "messages", mbox.Messages)
+
+    if mbox.Messages == 0 {
+        return []Email{}, nil
+    }
+
+    seqSet := new(imap.SeqSet)
+    seqSet.AddRange(1, mbox.Messages)
+
+    messages := make(chan *imap.Message, 10)
+    done := make(chan error, 1)
+
+    // Request all message data. BODY.PEEK[] is used so that fetching
+    // does not set \Seen flag on the server
+    section := &imap.BodySectionName{Peek: true}
+    items := []imap.FetchItem{imap.FetchEnvelope, imap.FetchFlags, imap.FetchUid, imap.FetchBodyStructure, section.FetchItem()}
+
+    go func() {
+        done <- imapClient.Fetch(seqSet, items, messages)
+    }()
+
+    var emails []Email
+    for msg := range messages {
+        email := Email{
+            Subject:   decodeRFC2047(msg.Envelope.Subject),
+            UID:       msg.Uid,
+            Date:      msg.Envelope.Date,
+            MessageID: strings.Trim(msg.Envelope.MessageId, "<> "),
+        }
+
+        for _, flag := range msg.Flags {
+            switch flag {
+            case imap.SeenFlag:
+                email.Seen = true
+            case imap.FlaggedFlag:
+                email.Flagged = true
+            }
+        }
+        
+        if len(msg.Envelope.From) > 0 {
+            addr := msg.Envelope.From[0]
+            email.FromAddress = addr.Address()
+            if addr.PersonalName != "" {
+                email.From = decodeRFC2047(addr.PersonalName)
+            } else {
+                email.From = fmt.Sprintf("%s@%s", addr.MailboxName, addr.HostName)
+            }
+        }
+
+        // Sender and subject are written only with debug logging
+        slog.Debug("Processing message", "uid", email.UID, "from", email.From, "subject", email.Subject)
+
+        // Get message body
+        for _, literal := range msg.Body {
+            buf := new(bytes.Buffer)
+            _, err := io.Copy(buf, literal)
+            if err != nil {
+                slog.Error("Error reading message body", "error", err)
+                continue
+            }
+
+            email.Raw = buf.Bytes()
+            parseMessageBody(&email, email.Raw)
+        }
+
+        emails = append(emails, email)
+    }
+
+    if err := <-done; err != nil {
+        return nil, fmt.Errorf("error getting messages: %w", err)
+    }
+
+    // Sort messages in reverse order (newest on top)
+    for i := len(emails)/2 - 1; i >= 0; i-- {
+        opp := len(emails) - 1 - i
+        emails[i], emails[opp] = emails[opp], emails[i]
+    }
+
+    slog.Debug("Processed messages", "folder", folder, "messages", len(emails))
+    return emails, nil
+}
+
+func generateRandomString(length int) string {
+    const charset = "abcdefghijklmnopqrstuvwxyz" // Only small English letters
+    seededRand := rand.New(rand.NewSource(time.Now().UnixNano()))
+    
+    b := strings.Builder{}
+    b.Grow(length)
+    for i := 0; i < length; i++ {
+        b.WriteByte(charset[seededRand.Intn(len(charset))])
+    }
+    return b.String()
+}
+
+// DeleteMail moves message to trash with retry support and returns its
+// UID in trash folder, nil when server doesn't support UIDPLUS. Move
+// itself is not retried
+func (tm *TempMailbox) DeleteMail(ctx context.Context, uid uint32) ([]uint32, error) {
+    var trashUIDs []uint32
+
+    err := withRetry(ctx, tm.retry().Modify, func() error {
+        var deleteErr error
+        trashUIDs, deleteErr = tm.deleteMailInternal(ctx, uid)
+        return deleteErr
+    })
+
+    return trashUIDs, err
+}
+
+// Renamed original DeleteMail method to deleteMailInternal
+func (tm *TempMailbox) deleteMailInternal(ctx context.Context, uid uint32) ([]uint32, error) {
+    slog.Info("Deleting mail", "mailbox", tm.Address(), "uid", uid)
+    _, trashUIDs, err := tm.moveToTrashInternal(ctx, []uint32{uid})
+    return trashUIDs, err
+}
+
+// MarkRead sets \Seen flag on message
+func (tm *TempMailbox) MarkRead(ctx context.Context, uid uint32) error {
+    return tm.SetFlag(ctx, uid, imap.SeenFlag, true)
+}
+
+// MarkUnread removes \Seen flag from message
+func (tm *TempMailbox) MarkUnread(ctx context.Context, uid uint32) error {
+    return tm.SetFlag(ctx, uid, imap.SeenFlag, false)
+}
+
+// SetFlagged stars or unstars message using \Flagged flag
+func (tm *TempMailbox) SetFlagged(ctx context.Context, uid uint32, flagged bool) error {
+    return tm.SetFlag(ctx, uid, imap.FlaggedFlag, flagged)
+}
+
+// SetFlag adds or removes IMAP flag on message with retry support
+func (tm *TempMailbox) SetFlag(ctx context.Context, uid uint32, flag string, value bool) error {
+    return withRetry(ctx, tm.retry().Modify, func() error {
+        return tm.setFlagInternal(ctx, uid, flag, value)
+    })
+}
+
+func (tm *TempMailbox) setFlagInternal(ctx context.Context, uid uint32, flag string, value bool) error {
+    slog.Info("Setting flag", "mailbox", tm.Address(), "uid", uid, "flag", flag, "value", value)
+
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        return err
+    }
+    defer logout()
+
+    if _, err := imapClient.Select("INBOX", false); err != nil {
+        return fmt.Errorf("error selecting folder: %w", err)
+    }
+
+    seqSet := new(imap.SeqSet)
+    seqSet.AddNum(uid)
+
+    var op imap.FlagsOp = imap.AddFlags
+    if !value {
+        op = imap.RemoveFlags
+    }
+    item := imap.FormatFlagsOp(op, true)
+    flags := []interface{}{flag}
+    if err := imapClient.UidStore(seqSet, item, flags, nil); err != nil {
+        return fmt.Errorf("error updating message flags: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,393 @@
+package tempmail
+
+import (
+    "bufio"
+    "context"
+    "crypto/tls"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Default ManageSieve port used when Sieve server is not configured
+const defaultSievePort = "4190"
+
+// Name of script holding rules of the mailbox
+const sieveScriptName = "malinatemp"
+
+// errNoScript is returned by GETSCRIPT of missing script
+var errNoScript = errors.New("script does not exist")
+
+// SieveError is NO response of ManageSieve server, for example syntax
+// error found by CHECKSCRIPT
+type SieveError struct {
+    Code    string // Response code such as NONEXISTENT or WARNINGS
+    Message string
+}
+
+func (e *SieveError) Error() string {
+    if e.Code != "" {
+        return fmt.Sprintf("sieve server: %s (%s)", e.Message, e.Code)
+    }
+    return "sieve server: " + e.Message
+}
+
+// Connection to ManageSieve server (RFC 5804)
+type sieveClient struct {
+    conn net.Conn
+    r    *bufio.Reader
+    caps map[string]string
+}
+
+// Connect and authenticate to ManageSieve server. STARTTLS is used when
+// server offers it, authentication over plain connection is allowed only
+// to localhost, which makes it possible to use local stand-in like
+// tempmail/sievetest. Connection is closed when context is done
+func dialSieve(ctx context.Context, timeouts Timeouts, verifyTLS bool, server, username, password string) (*sieveClient, func(), error) {
+    host, _, err := net.SplitHostPort(server)
+    if err != nil {
+        return nil, nil, fmt.Errorf("invalid Sieve server address: %w", err)
+    }
+
+    dialer := &net.Dialer{Timeout: timeouts.Dial}
+    conn, err := dialer.DialContext(ctx, "tcp", server)
+    if err != nil {
+        return nil, nil, fmt.Errorf("error connecting to Sieve: %w", err)
+    }
+    conn.SetDeadline(time.Now().Add(timeouts.Command))
+    stop := context.AfterFunc(ctx, func() {
+        conn.Close()
+    })
+
+    c := &sieveClient{conn: conn, r: bufio.NewReader(conn)}
+    closeClient := func() {
+        stop()
+        c.conn.Close()
+    }
+    fail := func(err error) (*sieveClient, func(), error) {
+        closeClient()
+        if ctx.Err() != nil {
+            return nil, nil, fmt.Errorf("error connecting to Sieve: %w", ctx.Err())
+        }
+        return nil, nil, err
+    }
+
+    if err := c.readCapabilities(); err != nil {
+        return fail(fmt.Errorf("error connecting to Sieve: %w", err))
+    }
+
+    if _, ok := c.caps["STARTTLS"]; ok {
+        if _, err := c.command("STARTTLS"); err != nil {
+            return fail(fmt.Errorf("error starting TLS: %w", err))
+        }
+        tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: !verifyTLS})
+        if err := tlsConn.HandshakeContext(ctx); err != nil {
+            return fail(fmt.Errorf("error starting TLS: %w", err))
+        }
+        c.conn = tlsConn
+        c.r = bufio.NewReader(tlsConn)
+        // Server repeats capabilities after TLS is established
+        if err := c.readCapabilities(); err != nil {
+            return fail(fmt.Errorf("error starting TLS: %w", err))
+        }
+    } else if !isLocalhost(host) {
+        return fail(&PermanentError{fmt.Errorf("Sieve server %s doesn't support STARTTLS", server)})
+    }
+
+    if !strings.Contains(strings.ToUpper(c.caps["SASL"]), "PLAIN") {
+        return fail(&PermanentError{fmt.Errorf("Sieve server doesn't support PLAIN authentication")})
+    }
+    credentials := base64.StdEncoding.EncodeToString([]byte("\x00" + username + "\x00" + password))
+    if _, err := c.command(`AUTHENTICATE "PLAIN" ` + sieveQuote(credentials)); err != nil {
+        var sieveErr *SieveError
+        if errors.As(err, &sieveErr) {
+            return fail(fmt.Errorf("error authenticating Sieve: %w", &PermanentError{err}))
+        }
+        return fail(fmt.Errorf("error authenticating Sieve: %w", err))
+    }
+
+    return c, closeClient, nil
+}
+
+// Return whether host is loopback address or localhost
+func isLocalhost(host string) bool {
+    if host == "localhost" {
+        return true
+    }
+    ip := net.ParseIP(host)
+    return ip != nil && ip.IsLoopback()
+}
+
+// Read capability response sent in greeting and after STARTTLS
+func (c *sieveClient) readCapabilities() error {
+    lines, err := c.readResponse()
+    if err != nil {
+        return err
+    }
+    c.caps = map[string]string{}
+    for _, line := range lines {
+        words := parseSieveStrings(line)
+        if len(words) == 0 {
+            continue
+        }
+        value := ""
+        if len(words) > 1 {
+            value = words[1]
+        }
+        c.caps[strings.ToUpper(words[0])] = value
+    }
+    return nil
+}
+
+// Send command and return data lines of response. NO response is returned
+// as *SieveError
+func (c *sieveClient) command(line string) ([]string, error) {
+    if _, err := io.WriteString(c.conn, line+"\r\n"); err != nil {
+        return nil, err
+    }
+    return c.readResponse()
+}
+
+// Send command with script as non-synchronizing literal
+func (c *sieveClient) commandWithScript(line, script string) ([]string, error) {
+    _, err := fmt.Fprintf(c.conn, "%s {%d+}\r\n%s\r\n", line, len(script), script)
+    if err != nil {
+        return nil, err
+    }
+    return c.readResponse()
+}
+
+// Read response lines until OK, NO or BYE. Literals are returned as single
+// data line
+func (c *sieveClient) readResponse() ([]string, error) {
+    var data []string
+    for {
+        line, err := c.readLine()
+        if err != nil {
+            return nil, err
+        }
+
+        upper := strings.ToUpper(line)
+        switch {
+        case upper == "OK" || strings.HasPrefix(upper, "OK "):
+            return data, nil
+        case strings.HasPrefix(upper, "NO") || strings.HasPrefix(upper, "BYE"):
+            rest := strings.TrimSpace(line[strings.IndexByte(line+" ", ' '):])
+            sieveErr := &SieveError{}
+            if strings.HasPrefix(rest, "(") {
+                if end := strings.IndexByte(rest, ')'); end > 0 {
+                    sieveErr.Code = rest[1:end]
+                    rest = strings.TrimSpace(rest[end+1:])
+                }
+            }
+            if message, err := c.readString(rest); err == nil {
+                sieveErr.Message = message
+            } else {
+                sieveErr.Message = rest
+            }
+            return nil, sieveErr
+        case strings.HasPrefix(line, "{"):
+            literal, err := c.readString(line)
+            if err != nil {
+                return nil, err
+            }
+            data = append(data, literal)
+        default:
+            data = append(data, line)
+        }
+    }
+}
+
+// Read line without CRLF
+func (c *sieveClient) readLine() (string, error) {
+    line, err := c.r.ReadString('\n')
+    if err != nil {
+        return "", err
+    }
+    return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Decode quoted string or read literal announced by {n}
+func (c *sieveClient) readString(token string) (string, error) {
+    if strings.HasPrefix(token, "{") {
+        size, err := strconv.Atoi(strings.TrimSuffix(strings.Trim(token, "{}"), "+"))
+        if err != nil {
+            return "", fmt.Errorf("invalid literal %q", token)
+        }
+        buf := make([]byte, size)
+        if _, err := io.ReadFull(c.r, buf); err != nil {
+            return "", err
+        }
+        // Literal is followed by rest of the line, usually empty
+        if _, err := c.readLine(); err != nil {
+            return "", err
+        }
+        return string(buf), nil
+    }
+    words := parseSieveStrings(token)
+    if len(words) == 0 {
+        return "", fmt.Errorf("missing string")
+    }
+    return words[0], nil
+}
+
+// Split line into quoted strings and atoms
+func parseSieveStrings(line string) []string {
+    var words []string
+    for i := 0; i < len(line); i++ {
+        switch c := line[i]; {
+        case c == ' ':
+        case c == '"':
+            var word strings.Builder
+            for i++; i < len(line) && line[i] != '"'; i++ {
+                if line[i] == '\\' && i+1 < len(line) {
+                    i++
+                }
+                word.WriteByte(line[i])
+            }
+            words = append(words, word.String())
+        default:
+            end := strings.IndexByte(line[i:], ' ')
+            if end < 0 {
+                end = len(line) - i
+            }
+            words = append(words, line[i:i+end])
+            i += end
+        }
+    }
+    return words
+}
+
+// Return script with name, errNoScript when there is none
+func (c *sieveClient) getScript(name string) (string, error) {
+    data, err := c.command("GETSCRIPT " + sieveQuote(name))
+    var sieveErr *SieveError
+    if errors.As(err, &sieveErr) && sieveErr.Code == "NONEXISTENT" {
+        return "", errNoScript
+    }
+    if err != nil {
+        return "", err
+    }
+    return strings.Join(data, ""), nil
+}
+
+// Return Sieve server of the mailbox, falling back to IMAP host with
+// ManageSieve port
+func (tm *TempMailbox) sieveServer() string {
+    tm.mu.Lock()
+    server := tm.SieveServer
+    tm.mu.Unlock()
+    if server != "" {
+        return server
+    }
+    host, _, err := net.SplitHostPort(tm.ImapServer)
+    if err != nil {
+        host = tm.ImapServer
+    }
+    return net.JoinHostPort(host, defaultSievePort)
+}
+
+// Connect to Sieve server with mailbox credentials and run session
+func (tm *TempMailbox) withSieve(ctx context.Context, session func(c *sieveClient) error) error {
+    c, closeClient, err := dialSieve(ctx, tm.timeouts(), tm.verifyTLS(), tm.sieveServer(), tm.Address(), tm.Password)
+    if err != nil {
+        return err
+    }
+    defer closeClient()
+
+    err = session(c)
+    if err != nil && ctx.Err() != nil {
+        return ctx.Err()
+    }
+    var sieveErr *SieveError
+    if errors.As(err, &sieveErr) {
+        return &PermanentError{err}
+    }
+    if err == nil {
+        c.command("LOGOUT")
+    }
+    return err
+}
+
+// SieveRules returns filter rules uploaded by SetSieveRules, nil when the
+// mailbox has none
+func (tm *TempMailbox) SieveRules(ctx context.Context) ([]SieveRule, error) {
+    var rules []SieveRule
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        return tm.withSieve(ctx, func(c *sieveClient) error {
+            script, err := c.getScript(sieveScriptName)
+            if errors.Is(err, errNoScript) {
+                rules = nil
+                return nil
+            }
+            if err != nil {
+                return fmt.Errorf("error getting Sieve script: %w", err)
+            }
+            rules, err = ParseSieveRules(script)
+            return err
+        })
+    })
+    return rules, err
+}
+
+// CheckSieveScript asks server whether script is valid, errors found by
+// server are returned as *SieveError
+func (tm *TempMailbox) CheckSieveScript(ctx context.Context, script string) error {
+    if err := CheckSieveSyntax(script); err != nil {
+        return &PermanentError{err}
+    }
+    return withRetry(ctx, tm.retry().Read, func() error {
+        return tm.withSieve(ctx, func(c *sieveClient) error {
+            _, err := c.commandWithScript("CHECKSCRIPT", script)
+            return err
+        })
+    })
+}
+
+// SetSieveRules compiles rules, uploads them as active Sieve script of the
+// mailbox and returns the script. Empty rules remove the script. Rules run
+// on server, so mail is filtered even when no client is running
+func (tm *TempMailbox) SetSieveRules(ctx context.Context, rules []SieveRule) (string, error) {
+    script := ""
+    if len(rules) > 0 {
+        var err error
+        if script, err = CompileSieve(rules); err != nil {
+            return "", &PermanentError{err}
+        }
+        if err := CheckSieveSyntax(script); err != nil {
+            return "", &PermanentError{err}
+        }
+    }
+
+    err := withRetry(ctx, tm.retry().Modify, func() error {
+        return tm.withSieve(ctx, func(c *sieveClient) error {
+            if script == "" {
+                if _, err := c.command(`SETACTIVE ""`); err != nil {
+                    return fmt.Errorf("error deactivating Sieve script: %w", err)
+                }
+                _, err := c.command("DELETESCRIPT " + sieveQuote(sieveScriptName))
+                var sieveErr *SieveError
+                if errors.As(err, &sieveErr) && sieveErr.Code == "NONEXISTENT" {
+                    return nil
+                }
+                return err
+            }
+            if _, err := c.commandWithScript("CHECKSCRIPT", script); err != nil {
+                return fmt.Errorf("error checking Sieve script: %w", err)
+            }
+            if _, err := c.commandWithScript("PUTSCRIPT "+sieveQuote(sieveScriptName), script); err != nil {
+                return fmt.Errorf("error uploading Sieve script: %w", err)
+            }
+            if _, err := c.command("SETACTIVE " + sieveQuote(sieveScriptName)); err != nil {
+                return fmt.Errorf("error activating Sieve script: %w", err)
+            }
+            return nil
+        })
+    })
+    return script, err
+}
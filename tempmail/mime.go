@@ -0,0 +1,316 @@
+package tempmail
+
+import (
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log/slog"
+    "mime"
+    "mime/multipart"
+    "mime/quotedprintable"
+    "net/mail"
+    "net/textproto"
+    "strings"
+
+    "golang.org/x/net/html"
+    "golang.org/x/text/encoding/charmap"
+)
+
+// ExtractTextFromHTML returns text nodes of HTML document, one per line
+func ExtractTextFromHTML(htmlContent string) string {
+    doc, err := html.Parse(strings.NewReader(htmlContent))
+    if err != nil {
+        return htmlContent
+    }
+
+    var text strings.Builder
+    var extract func(*html.Node)
+    extract = func(n *html.Node) {
+        if n.Type == html.TextNode {
+            text.WriteString(strings.TrimSpace(n.Data))
+            if len(n.Data) > 0 {
+                text.WriteString("\n")
+            }
+        }
+        for c := n.FirstChild; c != nil; c = c.NextSibling {
+            extract(c)
+        }
+    }
+    extract(doc)
+    return strings.TrimSpace(text.String())
+}
+
+func getTextFromPart(part *multipart.Part) (string, error) {
+    contentType := part.Header.Get("Content-Type")
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return "", err
+    }
+
+    content, err := ioutil.ReadAll(part)
+    if err != nil {
+        return "", err
+    }
+
+    if strings.HasPrefix(mediaType, "text/html") {
+        return ExtractTextFromHTML(string(content)), nil
+    }
+    return string(content), nil
+}
+
+func decodeRFC2047(s string) string {
+    decoded, err := (&mime.WordDecoder{}).DecodeHeader(s)
+    if err != nil {
+        return s
+    }
+    return decoded
+}
+
+func decodeContent(content []byte, encoding string) ([]byte, error) {
+    encoding = strings.ToLower(encoding)
+    switch encoding {
+    case "base64":
+        decoded := make([]byte, base64.StdEncoding.DecodedLen(len(content)))
+        n, err := base64.StdEncoding.Decode(decoded, content)
+        if err != nil {
+            return content, err
+        }
+        return decoded[:n], nil
+    case "quoted-printable":
+        reader := quotedprintable.NewReader(bytes.NewReader(content))
+        decoded, err := ioutil.ReadAll(reader)
+        if err != nil {
+            return content, err
+        }
+        return decoded, nil
+    default:
+        return content, nil
+    }
+}
+
+// Parse MIME message body and fill text and HTML content of email
+func parseMessageBody(email *Email, raw []byte) {
+    // Try to read as MIME message
+    m, err := mail.ReadMessage(bytes.NewReader(raw))
+    if err != nil {
+        slog.Error("Error parsing MIME", "error", err)
+        // Try to decode as plain text
+        decoded, err := decodeCharset(raw, "")
+        if err == nil {
+            email.Content = decoded
+        } else {
+            email.Content = decodeRFC2047(string(raw))
+        }
+        return
+    }
+
+    // Messages without Content-Type are plain text (RFC 2045)
+    contentType := m.Header.Get("Content-Type")
+    if contentType == "" {
+        contentType = "text/plain; charset=us-ascii"
+    }
+
+    mediaType, params, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        slog.Error("Error determining content type", "error", err)
+        decoded, err := decodeCharset(raw, "")
+        if err == nil {
+            email.Content = decoded
+        } else {
+            email.Content = decodeRFC2047(string(raw))
+        }
+        return
+    }
+
+    slog.Debug("Parsing message", "type", mediaType)
+
+    if strings.HasPrefix(mediaType, "multipart/") {
+        mr := multipart.NewReader(m.Body, params["boundary"])
+        
+        // Process only text parts
+        for {
+            part, err := mr.NextPart()
+            if err == io.EOF {
+                break
+            }
+            if err != nil {
+                slog.Error("Error reading part", "error", err)
+                continue
+            }
+
+            partType, partParams, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+            if err != nil {
+                continue
+            }
+            
+            partCharset := partParams["charset"]
+            if partCharset == "" {
+                partCharset = "utf-8"
+            }
+
+            body, err := ioutil.ReadAll(part)
+            if err != nil {
+                continue
+            }
+
+            decodedBody, err := decodeContent(body, part.Header.Get("Content-Transfer-Encoding"))
+            if err != nil {
+                decodedBody = body
+            }
+
+            if strings.HasPrefix(partType, "text/plain") {
+                decoded, err := decodeCharset(decodedBody, partCharset)
+                if err == nil {
+                    if email.Content == "" {
+                        email.Content = decoded
+                    } else {
+                        email.Content += "\n\n" + decoded
+                    }
+                } else {
+                    if email.Content == "" {
+                        email.Content = string(decodedBody)
+                    } else {
+                        email.Content += "\n\n" + string(decodedBody)
+                    }
+                }
+            } else if strings.HasPrefix(partType, "text/html") {
+                decoded, err := decodeCharset(decodedBody, partCharset)
+                if err == nil {
+                    email.HTMLContent = decoded
+                    if email.Content == "" {
+                        email.Content = ExtractTextFromHTML(decoded)
+                    }
+                } else {
+                    email.HTMLContent = string(decodedBody)
+                    if email.Content == "" {
+                        email.Content = ExtractTextFromHTML(string(decodedBody))
+                    }
+                }
+            }
+        }
+    } else if strings.HasPrefix(mediaType, "text/plain") {
+        body, _ := ioutil.ReadAll(m.Body)
+        decodedBody, err := decodeContent(body, m.Header.Get("Content-Transfer-Encoding"))
+        if err != nil {
+            decodedBody = body
+        }
+        decoded, err := decodeCharset(decodedBody, params["charset"])
+        if err == nil {
+            email.Content = decoded
+        } else {
+            email.Content = string(decodedBody)
+        }
+    } else if strings.HasPrefix(mediaType, "text/html") {
+        body, _ := ioutil.ReadAll(m.Body)
+        decodedBody, err := decodeContent(body, m.Header.Get("Content-Transfer-Encoding"))
+        if err != nil {
+            slog.Error("Error decoding content", "error", err)
+            decodedBody = body
+        }
+        decoded, err := decodeCharset(decodedBody, params["charset"])
+        if err == nil {
+            email.HTMLContent = decoded
+            email.Content = ExtractTextFromHTML(decoded)
+        } else {
+            email.HTMLContent = string(decodedBody)
+            email.Content = ExtractTextFromHTML(string(decodedBody))
+        }
+    }
+
+    if email.Content != "" {
+        // Clear content from null bytes and extra spaces
+        email.Content = strings.TrimSpace(strings.ReplaceAll(email.Content, "\x00", ""))
+        // Content is written only with debug logging
+        slog.Debug("Message content after processing", "content", email.Content)
+    }
+}
+
+func decodeCharset(content []byte, charset string) (string, error) {
+    charset = strings.ToLower(charset)
+    switch charset {
+    case "utf-8", "us-ascii":
+        return string(content), nil
+    case "koi8-r":
+        decoder := charmap.KOI8R.NewDecoder()
+        decoded, err := decoder.Bytes(content)
+        if err != nil {
+            return "", err
+        }
+        return string(decoded), nil
+    case "windows-1251", "cp1251":
+        decoder := charmap.Windows1251.NewDecoder()
+        decoded, err := decoder.Bytes(content)
+        if err != nil {
+            return "", err
+        }
+        return string(decoded), nil
+    case "iso-8859-5":
+        decoder := charmap.ISO8859_5.NewDecoder()
+        decoded, err := decoder.Bytes(content)
+        if err != nil {
+            return "", err
+        }
+        return string(decoded), nil
+    default:
+        // Try to guess encoding
+        // First try windows-1251 as the most common
+        decoder := charmap.Windows1251.NewDecoder()
+        decoded, err := decoder.Bytes(content)
+        if err == nil && !strings.Contains(string(decoded), "") {
+            return string(decoded), nil
+        }
+        
+        // Then try KOI8-R
+        decoder = charmap.KOI8R.NewDecoder()
+        decoded, err = decoder.Bytes(content)
+        if err == nil && !strings.Contains(string(decoded), "") {
+            return string(decoded), nil
+        }
+
+        return string(content), fmt.Errorf("unsupported encoding: %s", charset)
+    }
+}
+
+// AttachmentTypes returns media types of attachments in raw message, such
+// as application/pdf. Parts with file name or attachment disposition are
+// attachments
+func AttachmentTypes(raw []byte) []string {
+    m, err := mail.ReadMessage(bytes.NewReader(raw))
+    if err != nil {
+        return nil
+    }
+    return partAttachmentTypes(textproto.MIMEHeader(m.Header), m.Body)
+}
+
+// Collect attachment types of MIME part and its subparts
+func partAttachmentTypes(header textproto.MIMEHeader, body io.Reader) []string {
+    contentType := header.Get("Content-Type")
+    if contentType == "" {
+        contentType = "text/plain"
+    }
+    mediaType, params, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return nil
+    }
+
+    if strings.HasPrefix(mediaType, "multipart/") {
+        var types []string
+        mr := multipart.NewReader(body, params["boundary"])
+        for {
+            part, err := mr.NextPart()
+            if err != nil {
+                break
+            }
+            types = append(types, partAttachmentTypes(part.Header, part)...)
+        }
+        return types
+    }
+
+    disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+    if disposition == "attachment" || dispositionParams["filename"] != "" || params["name"] != "" {
+        return []string{mediaType}
+    }
+    return nil
+}
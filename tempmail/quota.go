@@ -0,0 +1,246 @@
+package tempmail
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/emersion/go-imap"
+    "github.com/emersion/go-imap/client"
+    "github.com/emersion/go-imap/responses"
+    "github.com/nrdcg/mailinabox"
+    "github.com/nrdcg/mailinabox/errutils"
+)
+
+// ErrQuotaUnsupported is returned by Quota when IMAP server doesn't report
+// storage quota of the mailbox
+var ErrQuotaUnsupported = errors.New("server doesn't report quota")
+
+// Quota is storage usage of mailbox reported by IMAP QUOTA extension
+// (RFC 2087)
+type Quota struct {
+    Used  int64 // Bytes used by all folders of the mailbox
+    Limit int64 // Bytes allowed, 0 when unlimited
+}
+
+// Percent returns used part of limit in percent, 0 when unlimited
+func (q Quota) Percent() float64 {
+    if q.Limit <= 0 {
+        return 0
+    }
+    return float64(q.Used) * 100 / float64(q.Limit)
+}
+
+// GETQUOTAROOT command returning quotas of folder
+type getQuotaRootCommand struct {
+    Mailbox string
+}
+
+func (cmd *getQuotaRootCommand) Command() *imap.Command {
+    return &imap.Command{
+        Name:      "GETQUOTAROOT",
+        Arguments: []interface{}{imap.FormatMailboxName(cmd.Mailbox)},
+    }
+}
+
+// Handler of QUOTA responses reading STORAGE resource
+type quotaHandler struct {
+    quota Quota
+    found bool
+}
+
+func (h *quotaHandler) Handle(resp imap.Resp) error {
+    name, fields, ok := imap.ParseNamedResp(resp)
+    if !ok || name != "QUOTA" {
+        return responses.ErrUnhandled
+    }
+    if len(fields) < 2 {
+        return nil
+    }
+    resources, ok := fields[1].([]interface{})
+    if !ok {
+        return nil
+    }
+    // Resources are triples of name, usage and limit, storage is in KiB
+    for i := 0; i+2 < len(resources); i += 3 {
+        if !strings.EqualFold(fmt.Sprint(resources[i]), "STORAGE") {
+            continue
+        }
+        used, err := imap.ParseNumber(resources[i+1])
+        if err != nil {
+            return err
+        }
+        limit, err := imap.ParseNumber(resources[i+2])
+        if err != nil {
+            return err
+        }
+        h.quota = Quota{Used: int64(used) * 1024, Limit: int64(limit) * 1024}
+        h.found = true
+    }
+    return nil
+}
+
+// Read storage quota of INBOX quota root
+func readQuota(imapClient *client.Client) (Quota, error) {
+    ok, err := imapClient.Support("QUOTA")
+    if err != nil {
+        return Quota{}, fmt.Errorf("error reading server capabilities: %w", err)
+    }
+    if !ok {
+        return Quota{}, &PermanentError{ErrQuotaUnsupported}
+    }
+
+    handler := &quotaHandler{}
+    status, err := imapClient.Execute(&getQuotaRootCommand{Mailbox: "INBOX"}, handler)
+    if err == nil {
+        err = status.Err()
+    }
+    if err != nil {
+        return Quota{}, fmt.Errorf("error reading quota: %w", err)
+    }
+    if !handler.found {
+        return Quota{}, &PermanentError{ErrQuotaUnsupported}
+    }
+    return handler.quota, nil
+}
+
+// Quota returns storage usage and limit of the mailbox
+func (tm *TempMailbox) Quota(ctx context.Context) (Quota, error) {
+    var quota Quota
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        imapClient, logout, err := tm.connectIMAP(ctx)
+        if err != nil {
+            return err
+        }
+        defer logout()
+
+        quota, err = readQuota(imapClient)
+        return err
+    })
+    return quota, err
+}
+
+// PurgeOldest permanently deletes oldest messages of INBOX until mailbox
+// uses at most target bytes and returns number of deleted messages.
+// Messages are expunged instead of moved to trash, which would still count
+// to quota
+func (tm *TempMailbox) PurgeOldest(ctx context.Context, target int64) (int, error) {
+    purged := 0
+    err := withRetry(ctx, tm.retry().Modify, func() error {
+        imapClient, logout, err := tm.connectIMAP(ctx)
+        if err != nil {
+            return err
+        }
+        defer logout()
+
+        quota, err := readQuota(imapClient)
+        if err != nil {
+            return err
+        }
+        if quota.Used <= target {
+            return nil
+        }
+
+        mbox, err := imapClient.Select("INBOX", false)
+        if err != nil {
+            return fmt.Errorf("error selecting INBOX: %w", err)
+        }
+        if mbox.Messages == 0 {
+            return nil
+        }
+
+        type messageSize struct {
+            uid  uint32
+            date time.Time
+            size uint32
+        }
+        var messages []messageSize
+        seqSet := new(imap.SeqSet)
+        seqSet.AddRange(1, mbox.Messages)
+        fetched := make(chan *imap.Message, 10)
+        done := make(chan error, 1)
+        go func() {
+            done <- imapClient.Fetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, imap.FetchRFC822Size}, fetched)
+        }()
+        for msg := range fetched {
+            messages = append(messages, messageSize{uid: msg.Uid, date: msg.InternalDate, size: msg.Size})
+        }
+        if err := <-done; err != nil {
+            return fmt.Errorf("error fetching message sizes: %w", err)
+        }
+        sort.Slice(messages, func(a, b int) bool {
+            return messages[a].date.Before(messages[b].date)
+        })
+
+        var uids []uint32
+        used := quota.Used
+        for _, msg := range messages {
+            if used <= target {
+                break
+            }
+            uids = append(uids, msg.uid)
+            used -= int64(msg.size)
+        }
+        if err := expungeUIDs(imapClient, uids); err != nil {
+            return err
+        }
+        purged = len(uids)
+        slog.Info("Purged oldest messages to fit quota", "mailbox", tm.Address(), "messages", purged)
+        return nil
+    })
+    return purged, err
+}
+
+var quotaFormat = regexp.MustCompile(`^[0-9]+[KMGT]?$`)
+
+// ValidateQuota checks quota format accepted by SetQuota
+func ValidateQuota(quota string) error {
+    if !quotaFormat.MatchString(strings.ToUpper(strings.TrimSpace(quota))) {
+        return fmt.Errorf("invalid quota %q, use number with optional K, M, G or T", quota)
+    }
+    return nil
+}
+
+// SetQuota sets storage quota of mail user, such as "50M" or "1G". Zero
+// removes the limit. Needs Mail-in-a-Box version with per-user quotas,
+// older servers respond with 404, which is permanent error
+func (tm *TempMailbox) SetQuota(ctx context.Context, address, quota string) error {
+    if err := ValidateQuota(quota); err != nil {
+        return &PermanentError{err}
+    }
+    quota = strings.ToUpper(strings.TrimSpace(quota))
+    form := url.Values{"email": {address}, "quota": {quota}}
+    return withRetry(ctx, tm.retry().Account, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, _ *mailinabox.Client) error {
+            return tm.adminForm(ctx, "mail/users/quota", form)
+        })
+        if err != nil {
+            return fmt.Errorf("error setting quota of %s: %w", address, err)
+        }
+        return nil
+    })
+}
+
+// Send form to admin endpoint with POST
+func (tm *TempMailbox) adminForm(ctx context.Context, endpoint string, form url.Values) error {
+    _, secret := tm.session()
+    resp, err := adminRequest(ctx, http.MethodPost, tm.apiURL, endpoint, tm.adminEmail, secret, "", form)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return errutils.NewUnexpectedResponseStatusCodeError(resp.Request, resp)
+    }
+    io.Copy(io.Discard, resp.Body)
+    return nil
+}
@@ -0,0 +1,32 @@
+package tempmail_test
+
+import (
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+func TestValidateQuota(t *testing.T) {
+    tests := []struct {
+        quota string
+        valid bool
+    }{
+        {"0", true},
+        {"1024", true},
+        {"50M", true},
+        {"50m", true},
+        {" 1G ", true},
+        {"2T", true},
+        {"", false},
+        {"M", false},
+        {"50MB", false},
+        {"1.5G", false},
+        {"-1", false},
+        {"50 M", false},
+    }
+    for _, test := range tests {
+        if err := tempmail.ValidateQuota(test.quota); (err == nil) != test.valid {
+            t.Errorf("ValidateQuota(%q) = %v, want valid %t", test.quota, err, test.valid)
+        }
+    }
+}
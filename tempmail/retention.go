@@ -0,0 +1,179 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/emersion/go-imap"
+    "github.com/emersion/go-imap/client"
+)
+
+// RetentionPolicy limits how long messages are kept in the mailbox. Zero
+// fields disable the limit
+type RetentionPolicy struct {
+    MaxAge      time.Duration // Delete messages received longer ago
+    MaxMessages int           // Keep only this many newest messages of INBOX
+}
+
+// Enabled reports whether policy limits anything
+func (p RetentionPolicy) Enabled() bool {
+    return p.MaxAge > 0 || p.MaxMessages > 0
+}
+
+func (p RetentionPolicy) String() string {
+    var limits []string
+    if p.MaxAge > 0 {
+        limits = append(limits, "delete messages older than "+p.MaxAge.String())
+    }
+    if p.MaxMessages > 0 {
+        limits = append(limits, fmt.Sprintf("keep only the last %d", p.MaxMessages))
+    }
+    if len(limits) == 0 {
+        return "keep all messages"
+    }
+    return strings.Join(limits, ", ")
+}
+
+// RemovedMessage is message deleted by EnforceRetention
+type RemovedMessage struct {
+    Folder    string
+    UID       uint32
+    MessageID string
+    Received  time.Time
+}
+
+// EnforceRetention permanently deletes messages of INBOX and trash which
+// policy doesn't allow to keep and returns them. Age applies to both
+// folders, message count to INBOX only. Messages are expunged, moving them
+// to trash would keep them on server. On error, result holds messages that
+// may already be deleted
+func (tm *TempMailbox) EnforceRetention(ctx context.Context, policy RetentionPolicy) ([]RemovedMessage, error) {
+    if !policy.Enabled() {
+        return nil, nil
+    }
+
+    var removed []RemovedMessage
+    type messageKey struct {
+        folder string
+        uid    uint32
+    }
+    recorded := map[messageKey]bool{}
+    err := withRetry(ctx, tm.retry().Modify, func() error {
+        imapClient, logout, err := tm.connectIMAP(ctx)
+        if err != nil {
+            return err
+        }
+        defer logout()
+
+        trash, err := tm.trashFolder(imapClient)
+        if err != nil {
+            return err
+        }
+
+        // Messages deleted by failed attempt are kept in result, once even
+        // when next attempt finds them again
+        for _, folder := range []string{"INBOX", trash} {
+            folderPolicy := policy
+            if folder != "INBOX" {
+                folderPolicy.MaxMessages = 0
+            }
+            messages, err := enforceFolderRetention(imapClient, folder, folderPolicy)
+            for _, message := range messages {
+                key := messageKey{message.Folder, message.UID}
+                if !recorded[key] {
+                    recorded[key] = true
+                    removed = append(removed, message)
+                }
+            }
+            if err != nil {
+                return err
+            }
+        }
+        return nil
+    })
+    return removed, err
+}
+
+// Delete messages of folder not allowed by policy. Messages are returned
+// also when deleting them fails, some of them may be gone
+func enforceFolderRetention(imapClient *client.Client, folder string, policy RetentionPolicy) ([]RemovedMessage, error) {
+    if !policy.Enabled() {
+        return nil, nil
+    }
+    mbox, err := imapClient.Select(folder, false)
+    if err != nil {
+        return nil, fmt.Errorf("error selecting %s: %w", folder, err)
+    }
+    if mbox.Messages == 0 {
+        return nil, nil
+    }
+
+    expired := map[uint32]bool{}
+    var candidates []uint32
+    cutoff := time.Now().Add(-policy.MaxAge)
+    if policy.MaxAge > 0 {
+        // SEARCH BEFORE compares dates only, in server time zone, so
+        // search with margin and check exact time of found messages
+        criteria := imap.NewSearchCriteria()
+        criteria.Before = cutoff.AddDate(0, 0, 2)
+        if candidates, err = imapClient.UidSearch(criteria); err != nil {
+            return nil, fmt.Errorf("error searching %s: %w", folder, err)
+        }
+    }
+    if policy.MaxMessages > 0 && int(mbox.Messages) > policy.MaxMessages {
+        all, err := imapClient.UidSearch(imap.NewSearchCriteria())
+        if err != nil {
+            return nil, fmt.Errorf("error searching %s: %w", folder, err)
+        }
+        // UIDs grow with arrival, so the lowest ones are the oldest
+        sort.Slice(all, func(a, b int) bool { return all[a] < all[b] })
+        if len(all) > policy.MaxMessages {
+            for _, uid := range all[:len(all)-policy.MaxMessages] {
+                expired[uid] = true
+            }
+        }
+    }
+    if len(candidates) == 0 && len(expired) == 0 {
+        return nil, nil
+    }
+
+    seqSet := new(imap.SeqSet)
+    seqSet.AddNum(candidates...)
+    for uid := range expired {
+        seqSet.AddNum(uid)
+    }
+    fetched := make(chan *imap.Message, 10)
+    done := make(chan error, 1)
+    go func() {
+        done <- imapClient.UidFetch(seqSet, []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, imap.FetchEnvelope}, fetched)
+    }()
+
+    var removed []RemovedMessage
+    var uids []uint32
+    for msg := range fetched {
+        if !expired[msg.Uid] && !(policy.MaxAge > 0 && msg.InternalDate.Before(cutoff)) {
+            continue
+        }
+        message := RemovedMessage{Folder: folder, UID: msg.Uid, Received: msg.InternalDate}
+        if msg.Envelope != nil {
+            message.MessageID = strings.Trim(msg.Envelope.MessageId, "<> ")
+        }
+        removed = append(removed, message)
+        uids = append(uids, msg.Uid)
+    }
+    if err := <-done; err != nil {
+        return nil, fmt.Errorf("error fetching messages of %s: %w", folder, err)
+    }
+
+    if err := expungeUIDs(imapClient, uids); err != nil {
+        return removed, err
+    }
+    if len(uids) > 0 {
+        slog.Info("Retention deleted messages", "folder", folder, "messages", len(uids))
+    }
+    return removed, nil
+}
@@ -0,0 +1,153 @@
+package tempmail
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/rand"
+    "net/textproto"
+    "time"
+
+    "github.com/nrdcg/mailinabox/errutils"
+)
+
+// RetryConfig describes how failed operation is retried. Interval starts
+// at InitialInterval and doubles after each attempt up to MaxInterval
+type RetryConfig struct {
+    MaxAttempts     int
+    InitialInterval time.Duration
+    MaxInterval     time.Duration
+    Jitter          float64 // Fraction of interval randomly added or subtracted, 0 to 1
+}
+
+// RetryPolicies holds retry configuration of each kind of operation.
+// Policies with zero MaxAttempts use values of DefaultRetryPolicies
+type RetryPolicies struct {
+    Read    RetryConfig // Checking INBOX and trash
+    Modify  RetryConfig // Moving, deleting and flagging messages
+    Account RetryConfig // Creating and deleting mailboxes with API
+    Send    RetryConfig // Sending mail over SMTP
+}
+
+// Default retry policies. Sending is not retried because server may have
+// accepted message before connection failed
+var DefaultRetryPolicies = RetryPolicies{
+    Read:    RetryConfig{MaxAttempts: 3, InitialInterval: 1 * time.Second, MaxInterval: 5 * time.Second, Jitter: 0.2},
+    Modify:  RetryConfig{MaxAttempts: 3, InitialInterval: 1 * time.Second, MaxInterval: 5 * time.Second, Jitter: 0.2},
+    Account: RetryConfig{MaxAttempts: 2, InitialInterval: 2 * time.Second, MaxInterval: 10 * time.Second, Jitter: 0.2},
+    Send:    RetryConfig{MaxAttempts: 1},
+}
+
+// WithDefaults returns policies with defaults for unset values
+func (p RetryPolicies) WithDefaults() RetryPolicies {
+    if p.Read.MaxAttempts <= 0 {
+        p.Read = DefaultRetryPolicies.Read
+    }
+    if p.Modify.MaxAttempts <= 0 {
+        p.Modify = DefaultRetryPolicies.Modify
+    }
+    if p.Account.MaxAttempts <= 0 {
+        p.Account = DefaultRetryPolicies.Account
+    }
+    if p.Send.MaxAttempts <= 0 {
+        p.Send = DefaultRetryPolicies.Send
+    }
+    return p
+}
+
+// PermanentError marks error which retrying will not fix, such as rejected
+// credentials
+type PermanentError struct {
+    Err error
+}
+
+func (e *PermanentError) Error() string {
+    return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+    return e.Err
+}
+
+// IsPermanent reports whether err will not go away by retrying: rejected
+// IMAP login, 4xx response of Mail-in-a-Box API or 5xx SMTP reply.
+// Repeating such requests may also get client IP banned by fail2ban
+func IsPermanent(err error) bool {
+    var permanent *PermanentError
+    if errors.As(err, &permanent) {
+        return true
+    }
+
+    var status *errutils.UnexpectedStatusCodeError
+    if errors.As(err, &status) {
+        return status.StatusCode >= 400 && status.StatusCode < 500
+    }
+
+    var reply *textproto.Error
+    if errors.As(err, &reply) {
+        return reply.Code >= 500
+    }
+
+    return false
+}
+
+// Return interval randomly changed by jitter fraction
+func jittered(interval time.Duration, jitter float64) time.Duration {
+    if jitter <= 0 {
+        return interval
+    }
+    if jitter > 1 {
+        jitter = 1
+    }
+    factor := 1 + jitter*(2*rand.Float64()-1)
+    return time.Duration(float64(interval) * factor)
+}
+
+// Function to perform operation with retries. Permanent errors are returned
+// immediately, waiting between attempts stops when context is done
+func withRetry(ctx context.Context, config RetryConfig, operation func() error) error {
+    attempts := config.MaxAttempts
+    if attempts < 1 {
+        attempts = 1
+    }
+    interval := config.InitialInterval
+
+    for attempt := 1; ; attempt++ {
+        err := operation()
+        if err == nil {
+            return nil
+        }
+        if ctx.Err() != nil {
+            // Operation was interrupted by cancellation, don't retry
+            return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+        }
+        if IsPermanent(err) {
+            return err
+        }
+        if attempt >= attempts {
+            if attempts == 1 {
+                return err
+            }
+            return fmt.Errorf("maximum attempts exceeded (%d): %w", attempts, err)
+        }
+
+        timer := time.NewTimer(jittered(interval, config.Jitter))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+        case <-timer.C:
+        }
+
+        interval = nextInterval(interval, config.MaxInterval)
+    }
+}
+
+// Return interval doubled after failed attempt, but not more than maximum
+func nextInterval(interval, max time.Duration) time.Duration {
+    interval *= 2
+    if max > 0 && interval > max {
+        interval = max
+    }
+    return interval
+}
@@ -0,0 +1,121 @@
+package tempmail_test
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/textproto"
+    "testing"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "github.com/nrdcg/mailinabox/errutils"
+)
+
+func TestIsPermanent(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want bool
+    }{
+        {"nil", nil, false},
+        {"plain", errors.New("connection reset"), false},
+        {"permanent", &tempmail.PermanentError{Err: errors.New("login rejected")}, true},
+        {"wrapped permanent", fmt.Errorf("error logging in: %w", &tempmail.PermanentError{Err: errors.New("rejected")}), true},
+        {"API 403", &errutils.UnexpectedStatusCodeError{StatusCode: 403}, true},
+        {"API 404 wrapped", fmt.Errorf("error: %w", &errutils.UnexpectedStatusCodeError{StatusCode: 404}), true},
+        {"API 500", &errutils.UnexpectedStatusCodeError{StatusCode: 500}, false},
+        {"API 302", &errutils.UnexpectedStatusCodeError{StatusCode: 302}, false},
+        {"SMTP 550", &textproto.Error{Code: 550, Msg: "mailbox unavailable"}, true},
+        {"SMTP 451", &textproto.Error{Code: 451, Msg: "try again later"}, false},
+    }
+    for _, test := range tests {
+        if got := tempmail.IsPermanent(test.err); got != test.want {
+            t.Errorf("%s: IsPermanent = %t, want %t", test.name, got, test.want)
+        }
+    }
+}
+
+func TestWithRetry(t *testing.T) {
+    transient := errors.New("connection reset")
+    permanent := &tempmail.PermanentError{Err: errors.New("login rejected")}
+    config := tempmail.RetryConfig{MaxAttempts: 3, InitialInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+
+    tests := []struct {
+        name         string
+        config       tempmail.RetryConfig
+        errs         []error // Results of attempts, success after the last
+        wantAttempts int
+        wantErr      error
+    }{
+        {"success", config, nil, 1, nil},
+        {"success after transient", config, []error{transient, transient}, 3, nil},
+        {"attempts exceeded", config, []error{transient, transient, transient}, 3, transient},
+        {"permanent", config, []error{permanent}, 1, permanent},
+        {"permanent after transient", config, []error{transient, permanent}, 2, permanent},
+        {"single attempt", tempmail.RetryConfig{}, []error{transient}, 1, transient},
+    }
+    for _, test := range tests {
+        attempts := 0
+        err := tempmail.WithRetry(context.Background(), test.config, func() error {
+            attempts++
+            if attempts <= len(test.errs) {
+                return test.errs[attempts-1]
+            }
+            return nil
+        })
+        if attempts != test.wantAttempts {
+            t.Errorf("%s: made %d attempts, want %d", test.name, attempts, test.wantAttempts)
+        }
+        if !errors.Is(err, test.wantErr) || (test.wantErr == nil) != (err == nil) {
+            t.Errorf("%s: got error %v, want %v", test.name, err, test.wantErr)
+        }
+    }
+}
+
+func TestWithRetryCancelled(t *testing.T) {
+    ctx, cancel := context.WithCancel(context.Background())
+    attempts := 0
+    err := tempmail.WithRetry(ctx, tempmail.RetryConfig{MaxAttempts: 5, InitialInterval: time.Hour}, func() error {
+        attempts++
+        cancel()
+        return errors.New("connection reset")
+    })
+    if attempts != 1 || !errors.Is(err, context.Canceled) {
+        t.Errorf("got %d attempts and error %v, want 1 attempt and context.Canceled", attempts, err)
+    }
+}
+
+func TestBackoff(t *testing.T) {
+    tests := []struct {
+        interval, max, want time.Duration
+    }{
+        {time.Second, 5 * time.Second, 2 * time.Second},
+        {2 * time.Second, 5 * time.Second, 4 * time.Second},
+        {4 * time.Second, 5 * time.Second, 5 * time.Second},
+        {5 * time.Second, 5 * time.Second, 5 * time.Second},
+        {time.Second, 0, 2 * time.Second},
+    }
+    for _, test := range tests {
+        if got := tempmail.NextInterval(test.interval, test.max); got != test.want {
+            t.Errorf("NextInterval(%v, %v) = %v, want %v", test.interval, test.max, got, test.want)
+        }
+    }
+
+    jitters := []struct {
+        jitter   float64
+        min, max time.Duration
+    }{
+        {0, time.Second, time.Second},
+        {-1, time.Second, time.Second},
+        {0.2, 800 * time.Millisecond, 1200 * time.Millisecond},
+        {5, 0, 2 * time.Second},
+    }
+    for _, test := range jitters {
+        for i := 0; i < 100; i++ {
+            if got := tempmail.Jittered(time.Second, test.jitter); got < test.min || got > test.max {
+                t.Fatalf("Jittered(1s, %v) = %v, want %v to %v", test.jitter, got, test.min, test.max)
+            }
+        }
+    }
+}
@@ -0,0 +1,174 @@
+package tempmail
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "strings"
+
+    "github.com/nrdcg/mailinabox"
+    "github.com/nrdcg/mailinabox/errutils"
+)
+
+// ErrTOTPRequired is returned by Login when admin account has two-factor
+// authentication enabled and no TOTP code was given. It is permanent, so
+// it's never retried
+var ErrTOTPRequired = errors.New("TOTP code required")
+
+// AdminSession is API key issued by Mail-in-a-Box for admin login. Key is
+// used instead of admin password and expires on server, passing it as
+// adminPassword of NewTempMailbox works like password
+type AdminSession struct {
+    Email string
+    Key   string
+}
+
+// Response of /admin/login
+type loginResponse struct {
+    Status string `json:"status"`
+    Reason string `json:"reason"`
+    Email  string `json:"email"`
+    APIKey string `json:"api_key"`
+}
+
+// Send POST request to Mail-in-a-Box admin endpoint with basic auth
+func postAdmin(ctx context.Context, apiURL, endpoint, email, password, totp string) (*http.Response, error) {
+    return adminRequest(ctx, http.MethodPost, apiURL, endpoint, email, password, totp, nil)
+}
+
+// Send request to Mail-in-a-Box admin endpoint with basic auth, endpoint
+// may contain several path segments. Form is sent as request body when
+// not nil
+func adminRequest(ctx context.Context, method, apiURL, endpoint, email, password, totp string, form url.Values) (*http.Response, error) {
+    base, err := url.Parse(apiURL)
+    if err != nil {
+        return nil, fmt.Errorf("invalid API URL: %w", err)
+    }
+
+    var body io.Reader
+    if form != nil {
+        body = strings.NewReader(form.Encode())
+    }
+    req, err := http.NewRequestWithContext(ctx, method, base.JoinPath("admin", endpoint).String(), body)
+    if err != nil {
+        return nil, err
+    }
+    if form != nil {
+        req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    }
+    req.SetBasicAuth(email, password)
+    req.Header.Set("Accept", "application/json")
+    if totp != "" {
+        req.Header.Set("x-auth-token", strings.TrimSpace(totp))
+    }
+    return http.DefaultClient.Do(req)
+}
+
+// Login exchanges admin credentials and TOTP code, which may be empty when
+// two-factor authentication is disabled, for session API key
+func Login(ctx context.Context, apiURL, email, password, totp string) (AdminSession, error) {
+    resp, err := postAdmin(ctx, apiURL, "login", email, password, totp)
+    if err != nil {
+        return AdminSession{}, fmt.Errorf("error logging in: %w", err)
+    }
+    defer resp.Body.Close()
+
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return AdminSession{}, fmt.Errorf("error reading login response: %w", err)
+    }
+    if resp.StatusCode != http.StatusOK {
+        err := fmt.Errorf("error logging in: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+        if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+            return AdminSession{}, &PermanentError{err}
+        }
+        return AdminSession{}, err
+    }
+
+    var result loginResponse
+    if err := json.Unmarshal(body, &result); err != nil {
+        return AdminSession{}, fmt.Errorf("error parsing login response: %w", err)
+    }
+    switch result.Status {
+    case "ok":
+        if result.APIKey == "" {
+            return AdminSession{}, fmt.Errorf("server didn't issue API key")
+        }
+        return AdminSession{Email: result.Email, Key: result.APIKey}, nil
+    case "missing-totp-token":
+        return AdminSession{}, &PermanentError{ErrTOTPRequired}
+    default:
+        return AdminSession{}, &PermanentError{fmt.Errorf("login rejected: %s", result.Reason)}
+    }
+}
+
+// Logout invalidates session API key
+func Logout(ctx context.Context, apiURL string, session AdminSession) error {
+    resp, err := postAdmin(ctx, apiURL, "logout", session.Email, session.Key, "")
+    if err != nil {
+        return fmt.Errorf("error logging out: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("error logging out: status %d", resp.StatusCode)
+    }
+    return nil
+}
+
+// Check whether API rejected admin credentials, for example because
+// session key expired
+func isAuthError(err error) bool {
+    var status *errutils.UnexpectedStatusCodeError
+    if errors.As(err, &status) {
+        return status.StatusCode == http.StatusUnauthorized || status.StatusCode == http.StatusForbidden
+    }
+    return false
+}
+
+// Return API client and admin password or session key it uses
+func (tm *TempMailbox) session() (*mailinabox.Client, string) {
+    tm.mu.Lock()
+    defer tm.mu.Unlock()
+    return tm.Client, tm.adminSecret
+}
+
+// Run Mail-in-a-Box API call. When credentials are rejected and
+// Reauthenticate is set, client is recreated with new key and call is
+// repeated once
+func (tm *TempMailbox) callAPI(ctx context.Context, call func(ctx context.Context, client *mailinabox.Client) error) error {
+    client, secret := tm.session()
+    apiCtx, cancel := context.WithTimeout(ctx, tm.timeouts().API)
+    err := call(apiCtx, client)
+    cancel()
+    if err == nil || !isAuthError(err) || tm.Reauthenticate == nil {
+        return err
+    }
+
+    key, authErr := tm.Reauthenticate(ctx, secret)
+    if authErr != nil {
+        return &PermanentError{fmt.Errorf("%w (reauthentication failed: %v)", err, authErr)}
+    }
+
+    tm.mu.Lock()
+    if tm.adminSecret != key {
+        newClient, clientErr := mailinabox.New(tm.apiURL, tm.adminEmail, key)
+        if clientErr != nil {
+            tm.mu.Unlock()
+            return fmt.Errorf("error creating client: %w", clientErr)
+        }
+        tm.Client = newClient
+        tm.adminSecret = key
+    }
+    client = tm.Client
+    tm.mu.Unlock()
+
+    apiCtx, cancel = context.WithTimeout(ctx, tm.timeouts().API)
+    defer cancel()
+    return call(apiCtx, client)
+}
+
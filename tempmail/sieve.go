@@ -0,0 +1,280 @@
+package tempmail
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/mail"
+    "regexp"
+    "strings"
+)
+
+// Conditions of filter rules
+const (
+    SieveFieldFrom    = "from"
+    SieveFieldSubject = "subject"
+    SieveFieldHeader  = "header" // Header named by SieveRule.Header
+    SieveFieldSize    = "size"
+)
+
+// Actions of filter rules
+const (
+    SieveDiscard  = "discard"
+    SieveFileInto = "fileinto" // Move to folder in SieveRule.Argument
+    SieveRedirect = "redirect" // Send to address in SieveRule.Argument
+    SieveFlag     = "flag"     // Add flag in SieveRule.Argument, \Flagged by default
+)
+
+// SieveRule is server-side filter rule compiled to Sieve. Match is
+// "contains", "is" or "matches" (wildcards * and ?) for text fields and
+// "over" or "under" for size, whose Value is number with optional K, M or
+// G suffix
+type SieveRule struct {
+    Field    string `json:"field"`
+    Header   string `json:"header,omitempty"`
+    Match    string `json:"match"`
+    Value    string `json:"value"`
+    Action   string `json:"action"`
+    Argument string `json:"argument,omitempty"`
+}
+
+var (
+    sieveHeaderName = regexp.MustCompile(`^[!-9;-~]+$`)
+    sieveSize       = regexp.MustCompile(`^[0-9]+[KMG]?$`)
+)
+
+// Validate checks that rule can be compiled
+func (r SieveRule) Validate() error {
+    switch r.Field {
+    case SieveFieldFrom, SieveFieldSubject, SieveFieldHeader:
+        if r.Field == SieveFieldHeader && !sieveHeaderName.MatchString(r.Header) {
+            return fmt.Errorf("invalid header name %q", r.Header)
+        }
+        if r.Match != "contains" && r.Match != "is" && r.Match != "matches" {
+            return fmt.Errorf("invalid match %q of %s", r.Match, r.Field)
+        }
+    case SieveFieldSize:
+        if r.Match != "over" && r.Match != "under" {
+            return fmt.Errorf("size must be over or under value")
+        }
+        if !sieveSize.MatchString(strings.ToUpper(r.Value)) {
+            return fmt.Errorf("invalid size %q, use number with optional K, M or G", r.Value)
+        }
+    default:
+        return fmt.Errorf("unknown condition %q", r.Field)
+    }
+
+    switch r.Action {
+    case SieveDiscard, SieveFlag:
+    case SieveFileInto:
+        if strings.TrimSpace(r.Argument) == "" {
+            return fmt.Errorf("fileinto needs folder")
+        }
+    case SieveRedirect:
+        if _, err := mail.ParseAddress(r.Argument); err != nil {
+            return fmt.Errorf("invalid redirect address %q: %w", r.Argument, err)
+        }
+    default:
+        return fmt.Errorf("unknown action %q", r.Action)
+    }
+    return nil
+}
+
+// Quote string for Sieve script
+func sieveQuote(s string) string {
+    s = strings.ReplaceAll(s, `\`, `\\`)
+    s = strings.ReplaceAll(s, `"`, `\"`)
+    return `"` + s + `"`
+}
+
+// Return Sieve test of rule condition
+func (r SieveRule) test() string {
+    switch r.Field {
+    case SieveFieldFrom:
+        return fmt.Sprintf("address :%s \"from\" %s", r.Match, sieveQuote(r.Value))
+    case SieveFieldSubject:
+        return fmt.Sprintf("header :%s \"subject\" %s", r.Match, sieveQuote(r.Value))
+    case SieveFieldHeader:
+        return fmt.Sprintf("header :%s %s %s", r.Match, sieveQuote(r.Header), sieveQuote(r.Value))
+    default:
+        return fmt.Sprintf("size :%s %s", r.Match, strings.ToUpper(r.Value))
+    }
+}
+
+// Return Sieve command of rule action
+func (r SieveRule) command() string {
+    switch r.Action {
+    case SieveDiscard:
+        return "discard;"
+    case SieveFileInto:
+        return "fileinto " + sieveQuote(r.Argument) + ";"
+    case SieveRedirect:
+        address, _ := mail.ParseAddress(r.Argument)
+        return "redirect " + sieveQuote(address.Address) + ";"
+    default:
+        flag := r.Argument
+        if flag == "" {
+            flag = `\Flagged`
+        }
+        return "addflag " + sieveQuote(flag) + ";"
+    }
+}
+
+// Marks comment holding rules of compiled script, so rules can be read back
+const sieveRulesComment = "# malinatemp-rules: "
+
+// CompileSieve builds Sieve script from rules. Rules are applied in order
+// and each matching rule runs its action. Rules are also stored in comment,
+// see ParseSieveRules
+func CompileSieve(rules []SieveRule) (string, error) {
+    var requires []string
+    required := map[string]bool{}
+    for i, rule := range rules {
+        if err := rule.Validate(); err != nil {
+            return "", fmt.Errorf("rule %d: %w", i+1, err)
+        }
+        extension := ""
+        switch rule.Action {
+        case SieveFileInto:
+            extension = "fileinto"
+        case SieveFlag:
+            extension = "imap4flags"
+        }
+        if extension != "" && !required[extension] {
+            required[extension] = true
+            requires = append(requires, sieveQuote(extension))
+        }
+    }
+
+    encoded, err := json.Marshal(rules)
+    if err != nil {
+        return "", fmt.Errorf("error encoding rules: %w", err)
+    }
+
+    var script strings.Builder
+    script.WriteString("# Generated by MalinaTEMP, changes are overwritten\r\n")
+    script.WriteString(sieveRulesComment + string(encoded) + "\r\n")
+    if len(requires) > 0 {
+        script.WriteString("require [" + strings.Join(requires, ", ") + "];\r\n")
+    }
+    for _, rule := range rules {
+        fmt.Fprintf(&script, "\r\nif %s {\r\n    %s\r\n}\r\n", rule.test(), rule.command())
+    }
+    return script.String(), nil
+}
+
+// ParseSieveRules reads rules stored in script compiled by CompileSieve.
+// Scripts written by other tools have no rules
+func ParseSieveRules(script string) ([]SieveRule, error) {
+    for _, line := range strings.Split(script, "\n") {
+        line = strings.TrimRight(line, "\r")
+        if !strings.HasPrefix(line, sieveRulesComment) {
+            continue
+        }
+        var rules []SieveRule
+        if err := json.Unmarshal([]byte(strings.TrimPrefix(line, sieveRulesComment)), &rules); err != nil {
+            return nil, fmt.Errorf("error parsing rules: %w", err)
+        }
+        return rules, nil
+    }
+    return nil, fmt.Errorf("script was not created by MalinaTEMP")
+}
+
+// Commands and tests known to syntax checker with extension they need
+var sieveKnownWords = map[string]string{
+    "require": "", "if": "", "elsif": "", "else": "", "stop": "", "keep": "", "discard": "",
+    "redirect": "", "allof": "", "anyof": "", "not": "", "address": "", "envelope": "",
+    "header": "", "size": "", "exists": "", "true": "", "false": "",
+    "fileinto": "fileinto", "addflag": "imap4flags", "setflag": "imap4flags",
+    "removeflag": "imap4flags", "hasflag": "imap4flags", "reject": "reject",
+    "vacation": "vacation",
+}
+
+// CheckSieveSyntax checks script locally for unbalanced brackets,
+// unterminated strings, unknown commands and extensions used without
+// require. Server check with CheckSieveScript is authoritative, this one
+// works offline and gives line numbers of common mistakes
+func CheckSieveSyntax(script string) error {
+    var stack []rune
+    required := map[string]bool{}
+    line := 1
+    expectCommand := true
+    var pendingRequire bool
+
+    for i := 0; i < len(script); i++ {
+        c := script[i]
+        switch {
+        case c == '\n':
+            line++
+        case c == '#':
+            for i < len(script) && script[i] != '\n' {
+                i++
+            }
+            line++
+        case c == '/' && i+1 < len(script) && script[i+1] == '*':
+            end := strings.Index(script[i+2:], "*/")
+            if end < 0 {
+                return fmt.Errorf("line %d: unterminated comment", line)
+            }
+            line += strings.Count(script[i:i+2+end], "\n")
+            i += end + 3
+        case c == '"':
+            start := line
+            j := i + 1
+            for ; j < len(script) && script[j] != '"'; j++ {
+                if script[j] == '\\' {
+                    j++
+                } else if script[j] == '\n' {
+                    line++
+                }
+            }
+            if j >= len(script) {
+                return fmt.Errorf("line %d: unterminated string", start)
+            }
+            if pendingRequire {
+                required[script[i+1:j]] = true
+            }
+            i = j
+            expectCommand = false
+        case c == '(' || c == '[' || c == '{':
+            stack = append(stack, rune(c))
+            expectCommand = c == '{'
+        case c == ')' || c == ']' || c == '}':
+            open := map[byte]rune{')': '(', ']': '[', '}': '{'}[c]
+            if len(stack) == 0 || stack[len(stack)-1] != open {
+                return fmt.Errorf("line %d: unexpected %q", line, c)
+            }
+            stack = stack[:len(stack)-1]
+            if c == '}' {
+                expectCommand = true
+            }
+        case c == ';':
+            expectCommand = true
+            pendingRequire = false
+        case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_':
+            j := i
+            for j < len(script) && (script[j] >= 'a' && script[j] <= 'z' || script[j] >= 'A' && script[j] <= 'Z' ||
+                script[j] >= '0' && script[j] <= '9' || script[j] == '_' || script[j] == '.') {
+                j++
+            }
+            word := strings.ToLower(script[i:j])
+            if i > 0 && script[i-1] == ':' {
+                i = j - 1
+                continue
+            }
+            extension, known := sieveKnownWords[word]
+            if expectCommand && !known {
+                return fmt.Errorf("line %d: unknown command %q", line, word)
+            }
+            if known && extension != "" && !required[extension] {
+                return fmt.Errorf("line %d: %s needs require %q", line, word, extension)
+            }
+            pendingRequire = word == "require"
+            expectCommand = false
+            i = j - 1
+        }
+    }
+    if len(stack) > 0 {
+        return fmt.Errorf("line %d: unclosed %q", line, stack[len(stack)-1])
+    }
+    return nil
+}
@@ -0,0 +1,161 @@
+package tempmail_test
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "github.com/AlestackOverglow/malinatemp/tempmail/sievetest"
+)
+
+// Rules as saved by the rule editor, one of each condition and action
+var editorRules = []tempmail.SieveRule{
+    {Field: tempmail.SieveFieldFrom, Match: "is", Value: "spam@example.org", Action: tempmail.SieveDiscard},
+    {Field: tempmail.SieveFieldSubject, Match: "contains", Value: `say "hi"`, Action: tempmail.SieveFileInto, Argument: "Greetings"},
+    {Field: tempmail.SieveFieldHeader, Header: "X-Priority", Match: "matches", Value: "1*", Action: tempmail.SieveFlag},
+    {Field: tempmail.SieveFieldSize, Match: "over", Value: "100k", Action: tempmail.SieveRedirect, Argument: "Big <big@example.org>"},
+}
+
+func startSieve(t *testing.T) (*sievetest.Server, *tempmail.TempMailbox) {
+    server, err := sievetest.NewServer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() {
+        server.Close()
+    })
+    mailbox := &tempmail.TempMailbox{
+        Username:    "test",
+        Domain:      "example.com",
+        Password:    "secret",
+        SieveServer: server.Addr(),
+    }
+    return server, mailbox
+}
+
+func testContext(t *testing.T) context.Context {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    t.Cleanup(cancel)
+    return ctx
+}
+
+func TestCompileSieve(t *testing.T) {
+    script, err := tempmail.CompileSieve(editorRules)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := tempmail.CheckSieveSyntax(script); err != nil {
+        t.Fatalf("compiled script fails syntax check: %v\n%s", err, script)
+    }
+    for _, want := range []string{
+        `require ["fileinto", "imap4flags"];`,
+        `address :is "from" "spam@example.org"`,
+        `header :contains "subject" "say \"hi\""`,
+        `fileinto "Greetings";`,
+        `addflag "\\Flagged";`,
+        `size :over 100K`,
+        `redirect "big@example.org";`,
+    } {
+        if !strings.Contains(script, want) {
+            t.Errorf("script has no %s:\n%s", want, script)
+        }
+    }
+
+    rules, err := tempmail.ParseSieveRules(script)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(rules, editorRules) {
+        t.Errorf("got rules %+v, want %+v", rules, editorRules)
+    }
+}
+
+func TestDialSieve(t *testing.T) {
+    server, _ := startSieve(t)
+    ctx := testContext(t)
+
+    c, closeClient, err := tempmail.DialSieve(ctx, tempmail.DefaultTimeouts, false, server.Addr(), "test@example.com", "secret")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer closeClient()
+    if _, err := c.Command("LOGOUT"); err != nil {
+        t.Fatal(err)
+    }
+
+    // Stand-in rejects empty user, rejected login is never retried
+    _, _, err = tempmail.DialSieve(ctx, tempmail.DefaultTimeouts, false, server.Addr(), "", "secret")
+    if err == nil || !tempmail.IsPermanent(err) {
+        t.Fatalf("got error %v, want permanent authentication error", err)
+    }
+}
+
+func TestSetSieveRules(t *testing.T) {
+    server, mailbox := startSieve(t)
+    ctx := testContext(t)
+
+    script, err := mailbox.SetSieveRules(ctx, editorRules)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := server.Scripts(mailbox.Address())["malinatemp"]; got != script {
+        t.Errorf("PUTSCRIPT stored %q, want %q", got, script)
+    }
+    if got := server.Active(mailbox.Address()); got != script {
+        t.Errorf("SETACTIVE activated %q, want %q", got, script)
+    }
+
+    rules, err := mailbox.SieveRules(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(rules, editorRules) {
+        t.Errorf("got rules %+v, want %+v", rules, editorRules)
+    }
+
+    // Empty rules deactivate and delete the script
+    if _, err := mailbox.SetSieveRules(ctx, nil); err != nil {
+        t.Fatal(err)
+    }
+    if scripts := server.Scripts(mailbox.Address()); len(scripts) != 0 || server.Active(mailbox.Address()) != "" {
+        t.Errorf("script left after removing rules: %v", scripts)
+    }
+    if rules, err := mailbox.SieveRules(ctx); err != nil || rules != nil {
+        t.Errorf("got rules %v and error %v, want none", rules, err)
+    }
+}
+
+func TestCheckScript(t *testing.T) {
+    server, mailbox := startSieve(t)
+    ctx := testContext(t)
+
+    script, err := tempmail.CompileSieve(editorRules)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := mailbox.CheckSieveScript(ctx, script); err != nil {
+        t.Fatalf("valid script rejected: %v", err)
+    }
+
+    // Send script past local check, so server rejects it
+    c, closeClient, err := tempmail.DialSieve(ctx, tempmail.DefaultTimeouts, false, server.Addr(), mailbox.Address(), mailbox.Password)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer closeClient()
+    _, err = c.CommandWithScript("CHECKSCRIPT", "if header :contains \"subject\" \"x\" {\r\n    discard;\r\n")
+    var sieveErr *tempmail.SieveError
+    if !errors.As(err, &sieveErr) {
+        t.Fatalf("got error %v, want *SieveError", err)
+    }
+
+    // Local check rejects fileinto without require before connecting
+    err = mailbox.CheckSieveScript(ctx, "if true { fileinto \"x\"; }")
+    if err == nil || !tempmail.IsPermanent(err) {
+        t.Fatalf("got error %v, want permanent syntax error", err)
+    }
+}
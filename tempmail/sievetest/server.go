@@ -0,0 +1,303 @@
+// Package sievetest provides in-memory ManageSieve server for trying filter
+// rules without mail server. It accepts any credentials over plain
+// connection and checks scripts with tempmail.CheckSieveSyntax
+package sievetest
+
+import (
+    "bufio"
+    "encoding/base64"
+    "fmt"
+    "io"
+    "log/slog"
+    "net"
+    "strconv"
+    "strings"
+    "sync"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+// Server is ManageSieve stand-in listening on localhost
+type Server struct {
+    listener net.Listener
+
+    mu      sync.Mutex
+    scripts map[string]map[string]string // Scripts by user and name
+    active  map[string]string            // Active script name by user
+}
+
+// NewServer starts server on random localhost port
+func NewServer() (*Server, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, fmt.Errorf("error starting Sieve server: %w", err)
+    }
+    s := &Server{
+        listener: listener,
+        scripts:  map[string]map[string]string{},
+        active:   map[string]string{},
+    }
+    go s.serve()
+    return s, nil
+}
+
+// Addr returns address to use as TempMailbox.SieveServer
+func (s *Server) Addr() string {
+    return s.listener.Addr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+    return s.listener.Close()
+}
+
+// Scripts returns copy of scripts uploaded by user
+func (s *Server) Scripts(user string) map[string]string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    scripts := map[string]string{}
+    for name, script := range s.scripts[user] {
+        scripts[name] = script
+    }
+    return scripts
+}
+
+// Active returns active script of user, empty when none is active
+func (s *Server) Active(user string) string {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if name := s.active[user]; name != "" {
+        return s.scripts[user][name]
+    }
+    return ""
+}
+
+func (s *Server) serve() {
+    for {
+        conn, err := s.listener.Accept()
+        if err != nil {
+            return
+        }
+        go s.handle(conn)
+    }
+}
+
+// Session of one client
+type session struct {
+    server *Server
+    conn   net.Conn
+    r      *bufio.Reader
+    user   string
+}
+
+func (s *Server) handle(conn net.Conn) {
+    defer conn.Close()
+    c := &session{server: s, conn: conn, r: bufio.NewReader(conn)}
+    c.capabilities()
+    for {
+        line, err := c.r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        args, err := c.parse(strings.TrimRight(line, "\r\n"))
+        if err != nil {
+            c.reply("NO", "", err.Error())
+            continue
+        }
+        if len(args) == 0 {
+            c.reply("NO", "", "Empty command")
+            continue
+        }
+        if !c.run(strings.ToUpper(args[0]), args[1:]) {
+            return
+        }
+    }
+}
+
+func (c *session) capabilities() {
+    fmt.Fprintf(c.conn, "\"IMPLEMENTATION\" \"malinatemp sievetest\"\r\n")
+    fmt.Fprintf(c.conn, "\"SASL\" \"PLAIN\"\r\n")
+    fmt.Fprintf(c.conn, "\"SIEVE\" \"fileinto imap4flags reject vacation\"\r\n")
+    fmt.Fprintf(c.conn, "\"VERSION\" \"1.0\"\r\n")
+    fmt.Fprintf(c.conn, "OK \"Ready\"\r\n")
+}
+
+func (c *session) reply(status, code, message string) {
+    if code != "" {
+        fmt.Fprintf(c.conn, "%s (%s) %q\r\n", status, code, message)
+        return
+    }
+    fmt.Fprintf(c.conn, "%s %q\r\n", status, message)
+}
+
+// Split command line into words, reading literals {n} and {n+}
+func (c *session) parse(line string) ([]string, error) {
+    var args []string
+    for i := 0; i < len(line); i++ {
+        switch line[i] {
+        case ' ':
+        case '"':
+            var word strings.Builder
+            for i++; i < len(line) && line[i] != '"'; i++ {
+                if line[i] == '\\' && i+1 < len(line) {
+                    i++
+                }
+                word.WriteByte(line[i])
+            }
+            args = append(args, word.String())
+        case '{':
+            end := strings.IndexByte(line[i:], '}')
+            if end < 0 {
+                return nil, fmt.Errorf("invalid literal")
+            }
+            size, err := strconv.Atoi(strings.TrimSuffix(line[i+1:i+end], "+"))
+            if err != nil {
+                return nil, fmt.Errorf("invalid literal")
+            }
+            buf := make([]byte, size)
+            if _, err := io.ReadFull(c.r, buf); err != nil {
+                return nil, err
+            }
+            args = append(args, string(buf))
+            // Rest of command follows literal
+            rest, err := c.r.ReadString('\n')
+            if err != nil {
+                return nil, err
+            }
+            more, err := c.parse(strings.TrimRight(rest, "\r\n"))
+            if err != nil {
+                return nil, err
+            }
+            return append(args, more...), nil
+        default:
+            end := strings.IndexByte(line[i:], ' ')
+            if end < 0 {
+                end = len(line) - i
+            }
+            args = append(args, line[i:i+end])
+            i += end
+        }
+    }
+    return args, nil
+}
+
+// Run command, return false when connection should be closed
+func (c *session) run(command string, args []string) bool {
+    s := c.server
+    if c.user == "" && command != "AUTHENTICATE" && command != "CAPABILITY" && command != "LOGOUT" {
+        c.reply("NO", "", "Authenticate first")
+        return true
+    }
+
+    switch command {
+    case "CAPABILITY":
+        c.capabilities()
+    case "LOGOUT":
+        c.reply("OK", "", "Bye")
+        return false
+    case "AUTHENTICATE":
+        if len(args) != 2 || !strings.EqualFold(args[0], "PLAIN") {
+            c.reply("NO", "", "Only PLAIN with initial response is supported")
+            return true
+        }
+        decoded, err := base64.StdEncoding.DecodeString(args[1])
+        parts := strings.Split(string(decoded), "\x00")
+        if err != nil || len(parts) != 3 || parts[1] == "" {
+            c.reply("NO", "", "Invalid credentials")
+            return true
+        }
+        c.user = parts[1]
+        slog.Info("Sieve stand-in login", "user", c.user)
+        c.reply("OK", "", "Logged in")
+    case "CHECKSCRIPT":
+        if len(args) != 1 {
+            c.reply("NO", "", "CHECKSCRIPT needs script")
+            return true
+        }
+        if err := tempmail.CheckSieveSyntax(args[0]); err != nil {
+            c.reply("NO", "", err.Error())
+            return true
+        }
+        c.reply("OK", "", "Script is valid")
+    case "PUTSCRIPT":
+        if len(args) != 2 {
+            c.reply("NO", "", "PUTSCRIPT needs name and script")
+            return true
+        }
+        if err := tempmail.CheckSieveSyntax(args[1]); err != nil {
+            c.reply("NO", "", err.Error())
+            return true
+        }
+        s.mu.Lock()
+        if s.scripts[c.user] == nil {
+            s.scripts[c.user] = map[string]string{}
+        }
+        s.scripts[c.user][args[0]] = args[1]
+        s.mu.Unlock()
+        c.reply("OK", "", "Script stored")
+    case "GETSCRIPT":
+        if len(args) != 1 {
+            c.reply("NO", "", "GETSCRIPT needs name")
+            return true
+        }
+        s.mu.Lock()
+        script, ok := s.scripts[c.user][args[0]]
+        s.mu.Unlock()
+        if !ok {
+            c.reply("NO", "NONEXISTENT", "Script does not exist")
+            return true
+        }
+        fmt.Fprintf(c.conn, "{%d}\r\n%s\r\n", len(script), script)
+        c.reply("OK", "", "Script sent")
+    case "SETACTIVE":
+        if len(args) != 1 {
+            c.reply("NO", "", "SETACTIVE needs name")
+            return true
+        }
+        s.mu.Lock()
+        _, ok := s.scripts[c.user][args[0]]
+        if ok || args[0] == "" {
+            s.active[c.user] = args[0]
+        }
+        s.mu.Unlock()
+        if !ok && args[0] != "" {
+            c.reply("NO", "NONEXISTENT", "Script does not exist")
+            return true
+        }
+        c.reply("OK", "", "Active script set")
+    case "DELETESCRIPT":
+        if len(args) != 1 {
+            c.reply("NO", "", "DELETESCRIPT needs name")
+            return true
+        }
+        s.mu.Lock()
+        _, ok := s.scripts[c.user][args[0]]
+        active := s.active[c.user] == args[0]
+        if ok && !active {
+            delete(s.scripts[c.user], args[0])
+        }
+        s.mu.Unlock()
+        switch {
+        case !ok:
+            c.reply("NO", "NONEXISTENT", "Script does not exist")
+        case active:
+            c.reply("NO", "ACTIVE", "Script is active")
+        default:
+            c.reply("OK", "", "Script deleted")
+        }
+    case "LISTSCRIPTS":
+        s.mu.Lock()
+        for name := range s.scripts[c.user] {
+            if s.active[c.user] == name {
+                fmt.Fprintf(c.conn, "%q ACTIVE\r\n", name)
+            } else {
+                fmt.Fprintf(c.conn, "%q\r\n", name)
+            }
+        }
+        s.mu.Unlock()
+        c.reply("OK", "", "Listed")
+    default:
+        c.reply("NO", "", "Unknown command "+command)
+    }
+    return true
+}
@@ -0,0 +1,370 @@
+package tempmail
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/tls"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "log/slog"
+    "mime"
+    "mime/multipart"
+    "mime/quotedprintable"
+    "net"
+    "net/mail"
+    "net/smtp"
+    "net/textproto"
+    "strings"
+    "time"
+)
+
+// Default SMTP submission port used when SMTP server is not configured
+const defaultSubmissionPort = "587"
+
+// Attachment of outgoing message
+type Attachment struct {
+    Name        string
+    ContentType string
+    Data        []byte
+}
+
+// OutgoingEmail is a message composed in the application
+type OutgoingEmail struct {
+    To          []string
+    Cc          []string
+    Subject     string
+    Text        string
+    HTML        string
+    Attachments []Attachment
+    InReplyTo   string   // Message-ID of replied message without angle brackets
+    References  []string // Message-IDs of the thread without angle brackets
+}
+
+// Recipients returns all envelope recipients of the message
+func (m OutgoingEmail) Recipients() []string {
+    return append(append([]string{}, m.To...), m.Cc...)
+}
+
+// NewReply creates reply to message with threading headers set
+func NewReply(original Email) OutgoingEmail {
+    subject := original.Subject
+    if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+        subject = "Re: " + subject
+    }
+
+    reply := OutgoingEmail{
+        Subject: subject,
+    }
+    if original.FromAddress != "" {
+        reply.To = []string{original.FromAddress}
+    }
+    if original.MessageID != "" {
+        reply.InReplyTo = original.MessageID
+        reply.References = append(messageReferences(original.Raw), original.MessageID)
+    }
+
+    // Quote original text
+    var quoted strings.Builder
+    if original.Date.IsZero() {
+        fmt.Fprintf(&quoted, "\n\n%s wrote:\n", original.From)
+    } else {
+        fmt.Fprintf(&quoted, "\n\nOn %s, %s wrote:\n", original.Date.Format("Mon, 2 Jan 2006 15:04"), original.From)
+    }
+    for _, line := range strings.Split(original.Content, "\n") {
+        quoted.WriteString("> " + line + "\n")
+    }
+    reply.Text = quoted.String()
+
+    return reply
+}
+
+// Read Message-IDs from References header of raw message
+func messageReferences(raw []byte) []string {
+    m, err := mail.ReadMessage(bytes.NewReader(raw))
+    if err != nil {
+        return nil
+    }
+    var refs []string
+    for _, ref := range strings.Fields(m.Header.Get("References")) {
+        refs = append(refs, strings.Trim(ref, "<>"))
+    }
+    return refs
+}
+
+// Generate unique Message-ID for the domain
+func newMessageID(domain string) string {
+    buf := make([]byte, 12)
+    rand.Read(buf)
+    return fmt.Sprintf("%d.%s@%s", time.Now().UnixNano(), hex.EncodeToString(buf), domain)
+}
+
+// Format list of Message-IDs for In-Reply-To and References headers
+func formatMessageIDs(ids []string) string {
+    formatted := make([]string, len(ids))
+    for i, id := range ids {
+        formatted[i] = "<" + id + ">"
+    }
+    return strings.Join(formatted, " ")
+}
+
+// Write body part encoded with quoted-printable
+func writeTextPart(w *multipart.Writer, contentType, text string) error {
+    header := textproto.MIMEHeader{}
+    header.Set("Content-Type", contentType+"; charset=utf-8")
+    header.Set("Content-Transfer-Encoding", "quoted-printable")
+    part, err := w.CreatePart(header)
+    if err != nil {
+        return err
+    }
+    qp := quotedprintable.NewWriter(part)
+    if _, err := qp.Write([]byte(text)); err != nil {
+        return err
+    }
+    return qp.Close()
+}
+
+// Write data encoded with base64 split into 76 character lines
+func writeBase64(buf *bytes.Buffer, data []byte) {
+    encoded := base64.StdEncoding.EncodeToString(data)
+    for len(encoded) > 76 {
+        buf.WriteString(encoded[:76] + "\r\n")
+        encoded = encoded[76:]
+    }
+    buf.WriteString(encoded + "\r\n")
+}
+
+// Build RFC 5322 message with text, optional HTML alternative and attachments
+func buildMessage(from string, msg OutgoingEmail) ([]byte, error) {
+    if len(msg.Recipients()) == 0 {
+        return nil, fmt.Errorf("message has no recipients")
+    }
+
+    domain := "localhost"
+    if at := strings.LastIndex(from, "@"); at >= 0 {
+        domain = from[at+1:]
+    }
+
+    var buf bytes.Buffer
+    header := func(name, value string) {
+        fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+    }
+    header("From", from)
+    header("To", strings.Join(msg.To, ", "))
+    if len(msg.Cc) > 0 {
+        header("Cc", strings.Join(msg.Cc, ", "))
+    }
+    header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+    header("Date", time.Now().Format(time.RFC1123Z))
+    header("Message-ID", "<"+newMessageID(domain)+">")
+    if msg.InReplyTo != "" {
+        header("In-Reply-To", "<"+msg.InReplyTo+">")
+    }
+    if len(msg.References) > 0 {
+        header("References", formatMessageIDs(msg.References))
+    }
+    header("MIME-Version", "1.0")
+
+    // Body is text part or alternative of text and HTML parts
+    var body bytes.Buffer
+    bodyWriter := multipart.NewWriter(&body)
+    bodyType := "text/plain; charset=utf-8"
+    if msg.HTML != "" {
+        if err := writeTextPart(bodyWriter, "text/plain", msg.Text); err != nil {
+            return nil, err
+        }
+        if err := writeTextPart(bodyWriter, "text/html", msg.HTML); err != nil {
+            return nil, err
+        }
+        if err := bodyWriter.Close(); err != nil {
+            return nil, err
+        }
+        bodyType = "multipart/alternative; boundary=" + bodyWriter.Boundary()
+    } else {
+        qp := quotedprintable.NewWriter(&body)
+        qp.Write([]byte(msg.Text))
+        qp.Close()
+    }
+
+    if len(msg.Attachments) == 0 {
+        header("Content-Type", bodyType)
+        if msg.HTML == "" {
+            header("Content-Transfer-Encoding", "quoted-printable")
+        }
+        buf.WriteString("\r\n")
+        buf.Write(body.Bytes())
+        return buf.Bytes(), nil
+    }
+
+    // Wrap body and attachments into multipart/mixed
+    mixed := multipart.NewWriter(&buf)
+    header("Content-Type", "multipart/mixed; boundary="+mixed.Boundary())
+    buf.WriteString("\r\n")
+
+    bodyHeader := textproto.MIMEHeader{}
+    bodyHeader.Set("Content-Type", bodyType)
+    if msg.HTML == "" {
+        bodyHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+    }
+    part, err := mixed.CreatePart(bodyHeader)
+    if err != nil {
+        return nil, err
+    }
+    part.Write(body.Bytes())
+
+    for _, attachment := range msg.Attachments {
+        contentType := attachment.ContentType
+        if contentType == "" {
+            contentType = "application/octet-stream"
+        }
+        attachmentHeader := textproto.MIMEHeader{}
+        attachmentHeader.Set("Content-Type", contentType)
+        attachmentHeader.Set("Content-Transfer-Encoding", "base64")
+        attachmentHeader.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+        part, err := mixed.CreatePart(attachmentHeader)
+        if err != nil {
+            return nil, err
+        }
+        var encoded bytes.Buffer
+        writeBase64(&encoded, attachment.Data)
+        part.Write(encoded.Bytes())
+    }
+
+    if err := mixed.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// Connect and authenticate to SMTP submission server. Port 465 uses
+// implicit TLS, other ports use STARTTLS when server supports it.
+// Authentication over plain connection is allowed only to localhost, which
+// makes it possible to use local SMTP stand-in. Returned function closes
+// connection and must be called when client is no longer needed
+func dialSMTP(ctx context.Context, timeouts Timeouts, verifyTLS bool, server, username, password string) (*smtp.Client, func(), error) {
+    host, port, err := net.SplitHostPort(server)
+    if err != nil {
+        return nil, nil, fmt.Errorf("invalid SMTP server address: %w", err)
+    }
+
+    tlsConfig := &tls.Config{
+        ServerName:         host,
+        InsecureSkipVerify: !verifyTLS,
+    }
+
+    dialer := &net.Dialer{Timeout: timeouts.Dial}
+    conn, err := dialer.DialContext(ctx, "tcp", server)
+    if err != nil {
+        return nil, nil, fmt.Errorf("error connecting to SMTP: %w", err)
+    }
+
+    // Whole session must finish within command timeout, cancellation
+    // closes connection and interrupts it
+    conn.SetDeadline(time.Now().Add(timeouts.Command))
+    stop := context.AfterFunc(ctx, func() {
+        conn.Close()
+    })
+
+    if port == "465" {
+        tlsConn := tls.Client(conn, tlsConfig)
+        if err := tlsConn.HandshakeContext(ctx); err != nil {
+            stop()
+            conn.Close()
+            return nil, nil, fmt.Errorf("error connecting to SMTP: %w", err)
+        }
+        conn = tlsConn
+    }
+
+    smtpClient, err := smtp.NewClient(conn, host)
+    if err != nil {
+        stop()
+        conn.Close()
+        return nil, nil, fmt.Errorf("error connecting to SMTP: %w", err)
+    }
+    closeClient := func() {
+        stop()
+        smtpClient.Close()
+    }
+
+    if port != "465" {
+        if ok, _ := smtpClient.Extension("STARTTLS"); ok {
+            if err := smtpClient.StartTLS(tlsConfig); err != nil {
+                closeClient()
+                return nil, nil, fmt.Errorf("error starting TLS: %w", err)
+            }
+        }
+    }
+
+    if ok, _ := smtpClient.Extension("AUTH"); ok {
+        if err := smtpClient.Auth(smtp.PlainAuth("", username, password, host)); err != nil {
+            closeClient()
+            return nil, nil, fmt.Errorf("error authenticating SMTP: %w", err)
+        }
+    }
+
+    return smtpClient, closeClient, nil
+}
+
+// Send message through SMTP submission server, see dialSMTP
+func sendSMTP(ctx context.Context, timeouts Timeouts, verifyTLS bool, server, username, password, from string, recipients []string, data []byte) error {
+    smtpClient, closeClient, err := dialSMTP(ctx, timeouts, verifyTLS, server, username, password)
+    if err != nil {
+        return err
+    }
+    defer closeClient()
+
+    if err := smtpClient.Mail(from); err != nil {
+        return fmt.Errorf("error setting sender: %w", err)
+    }
+    for _, recipient := range recipients {
+        if err := smtpClient.Rcpt(recipient); err != nil {
+            return fmt.Errorf("error adding recipient %s: %w", recipient, err)
+        }
+    }
+
+    writer, err := smtpClient.Data()
+    if err != nil {
+        return fmt.Errorf("error sending message: %w", err)
+    }
+    if _, err := writer.Write(data); err != nil {
+        return fmt.Errorf("error sending message: %w", err)
+    }
+    if err := writer.Close(); err != nil {
+        return fmt.Errorf("error sending message: %w", err)
+    }
+
+    return smtpClient.Quit()
+}
+
+// Return SMTP submission server of the mailbox, falling back to IMAP host
+// with submission port
+func (tm *TempMailbox) smtpServer() string {
+    if tm.SmtpServer != "" {
+        return tm.SmtpServer
+    }
+    host, _, err := net.SplitHostPort(tm.ImapServer)
+    if err != nil {
+        host = tm.ImapServer
+    }
+    return net.JoinHostPort(host, defaultSubmissionPort)
+}
+
+// Send sends message from the mailbox using its own credentials
+func (tm *TempMailbox) Send(ctx context.Context, msg OutgoingEmail) error {
+    from := tm.Address()
+    data, err := buildMessage(from, msg)
+    if err != nil {
+        return fmt.Errorf("error building message: %w", err)
+    }
+
+    slog.Info("Sending mail", "mailbox", from, "recipients", len(msg.Recipients()))
+    return withRetry(ctx, tm.retry().Send, func() error {
+        err := sendSMTP(ctx, tm.timeouts(), tm.verifyTLS(), tm.smtpServer(), from, tm.Password, from, msg.Recipients(), data)
+        if err != nil && ctx.Err() != nil {
+            // Report cancellation instead of closed connection error
+            return fmt.Errorf("error sending message: %w", ctx.Err())
+        }
+        return err
+    })
+}
@@ -0,0 +1,61 @@
+package tempmail_test
+
+import (
+    "bytes"
+    "net/mail"
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "github.com/AlestackOverglow/malinatemp/tempmail/smtptest"
+)
+
+func TestSendReply(t *testing.T) {
+    server, err := smtptest.NewServer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer server.Close()
+
+    mailbox := &tempmail.TempMailbox{
+        Username:   "test",
+        Domain:     "example.com",
+        Password:   "secret",
+        SmtpServer: server.Addr(),
+    }
+    original := tempmail.ParseRawEmail([]byte("From: Shop <shop@example.org>\r\n" +
+        "Subject: Order\r\n" +
+        "Message-ID: <second@example.org>\r\n" +
+        "References: <first@example.org>\r\n" +
+        "\r\n" +
+        "Your order\r\n"))
+
+    if err := mailbox.Send(testContext(t), tempmail.NewReply(original)); err != nil {
+        t.Fatal(err)
+    }
+
+    messages := server.Messages()
+    if len(messages) != 1 {
+        t.Fatalf("got %d messages, want 1", len(messages))
+    }
+    sent := messages[0]
+    if sent.User != "test@example.com" || sent.From != "test@example.com" {
+        t.Errorf("got user %q and sender %q, want test@example.com", sent.User, sent.From)
+    }
+    if len(sent.Recipients) != 1 || sent.Recipients[0] != "shop@example.org" {
+        t.Errorf("got recipients %v, want [shop@example.org]", sent.Recipients)
+    }
+
+    m, err := mail.ReadMessage(bytes.NewReader(sent.Data))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for header, want := range map[string]string{
+        "Subject":     "Re: Order",
+        "In-Reply-To": "<second@example.org>",
+        "References":  "<first@example.org> <second@example.org>",
+    } {
+        if got := m.Header.Get(header); got != want {
+            t.Errorf("got %s %q, want %q", header, got, want)
+        }
+    }
+}
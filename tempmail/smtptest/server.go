@@ -0,0 +1,203 @@
+// Package smtptest provides in-memory SMTP submission server for sending
+// mail without mail server. It accepts any credentials over plain
+// connection and keeps received messages for inspection
+package smtptest
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/base64"
+    "fmt"
+    "log/slog"
+    "net"
+    "strings"
+    "sync"
+)
+
+// Message is mail received by the server
+type Message struct {
+    User       string   // Authenticated user, empty without AUTH
+    From       string   // Envelope sender
+    Recipients []string // Envelope recipients
+    Data       []byte   // Message as sent, with dot-stuffing removed
+}
+
+// Server is SMTP stand-in listening on localhost
+type Server struct {
+    listener net.Listener
+
+    mu       sync.Mutex
+    messages []Message
+}
+
+// NewServer starts server on random localhost port
+func NewServer() (*Server, error) {
+    listener, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        return nil, fmt.Errorf("error starting SMTP server: %w", err)
+    }
+    s := &Server{listener: listener}
+    go s.serve()
+    return s, nil
+}
+
+// Addr returns address to use as TempMailbox.SmtpServer
+func (s *Server) Addr() string {
+    return s.listener.Addr().String()
+}
+
+// Close stops the server
+func (s *Server) Close() error {
+    return s.listener.Close()
+}
+
+// Messages returns copy of messages received so far
+func (s *Server) Messages() []Message {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return append([]Message{}, s.messages...)
+}
+
+func (s *Server) serve() {
+    for {
+        conn, err := s.listener.Accept()
+        if err != nil {
+            return
+        }
+        go s.handle(conn)
+    }
+}
+
+// Session of one client
+type session struct {
+    server *Server
+    conn   net.Conn
+    r      *bufio.Reader
+    user   string
+    from   string
+    rcpts  []string
+}
+
+func (s *Server) handle(conn net.Conn) {
+    defer conn.Close()
+    c := &session{server: s, conn: conn, r: bufio.NewReader(conn)}
+    c.reply(220, "malinatemp smtptest ready")
+    for {
+        line, err := c.r.ReadString('\n')
+        if err != nil {
+            return
+        }
+        command, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+        if !c.run(strings.ToUpper(command), arg) {
+            return
+        }
+    }
+}
+
+func (c *session) reply(code int, message string) {
+    fmt.Fprintf(c.conn, "%d %s\r\n", code, message)
+}
+
+// Run command, return false when connection should be closed
+func (c *session) run(command, arg string) bool {
+    switch command {
+    case "EHLO":
+        fmt.Fprintf(c.conn, "250-localhost\r\n250-8BITMIME\r\n250 AUTH PLAIN\r\n")
+    case "HELO":
+        c.reply(250, "localhost")
+    case "AUTH":
+        mechanism, response, _ := strings.Cut(arg, " ")
+        if !strings.EqualFold(mechanism, "PLAIN") {
+            c.reply(504, "Only PLAIN is supported")
+            return true
+        }
+        if response == "" {
+            // Client sends credentials after empty challenge
+            c.reply(334, "")
+            line, err := c.r.ReadString('\n')
+            if err != nil {
+                return false
+            }
+            response = strings.TrimRight(line, "\r\n")
+        }
+        decoded, err := base64.StdEncoding.DecodeString(response)
+        parts := strings.Split(string(decoded), "\x00")
+        if err != nil || len(parts) != 3 || parts[1] == "" {
+            c.reply(535, "Invalid credentials")
+            return true
+        }
+        c.user = parts[1]
+        slog.Info("SMTP stand-in login", "user", c.user)
+        c.reply(235, "Authenticated")
+    case "MAIL":
+        address, ok := pathArgument(arg, "FROM:")
+        if !ok {
+            c.reply(501, "Syntax: MAIL FROM:<address>")
+            return true
+        }
+        c.from = address
+        c.rcpts = nil
+        c.reply(250, "Sender OK")
+    case "RCPT":
+        address, ok := pathArgument(arg, "TO:")
+        if !ok || address == "" {
+            c.reply(501, "Syntax: RCPT TO:<address>")
+            return true
+        }
+        c.rcpts = append(c.rcpts, address)
+        c.reply(250, "Recipient OK")
+    case "DATA":
+        if len(c.rcpts) == 0 {
+            c.reply(503, "Need recipients first")
+            return true
+        }
+        c.reply(354, "End data with <CR><LF>.<CR><LF>")
+        data, err := c.readData()
+        if err != nil {
+            return false
+        }
+        c.server.mu.Lock()
+        c.server.messages = append(c.server.messages, Message{User: c.user, From: c.from, Recipients: c.rcpts, Data: data})
+        c.server.mu.Unlock()
+        c.from, c.rcpts = "", nil
+        c.reply(250, "Message accepted")
+    case "RSET":
+        c.from, c.rcpts = "", nil
+        c.reply(250, "OK")
+    case "NOOP":
+        c.reply(250, "OK")
+    case "QUIT":
+        c.reply(221, "Bye")
+        return false
+    default:
+        c.reply(502, "Unknown command "+command)
+    }
+    return true
+}
+
+// Read message lines up to single dot, removing dot-stuffing
+func (c *session) readData() ([]byte, error) {
+    var data bytes.Buffer
+    for {
+        line, err := c.r.ReadString('\n')
+        if err != nil {
+            return nil, err
+        }
+        if line == ".\r\n" || line == ".\n" {
+            return data.Bytes(), nil
+        }
+        data.WriteString(strings.TrimPrefix(line, "."))
+    }
+}
+
+// Read address of MAIL FROM:<...> or RCPT TO:<...>, ignoring parameters
+func pathArgument(arg, prefix string) (string, bool) {
+    if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+        return "", false
+    }
+    path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+    if !strings.HasPrefix(path, "<") || !strings.HasSuffix(path, ">") {
+        return "", false
+    }
+    return path[1 : len(path)-1], true
+}
@@ -0,0 +1,172 @@
+package tempmail
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "net/http"
+    "strings"
+    "time"
+
+    "github.com/nrdcg/mailinabox"
+    "github.com/nrdcg/mailinabox/errutils"
+)
+
+// Types of Mail-in-a-Box status checks
+const (
+    StatusOK      = "ok"
+    StatusWarning = "warning"
+    StatusError   = "error"
+)
+
+// StatusCheck is single check of Mail-in-a-Box System -> Status Checks
+type StatusCheck struct {
+    Section string   // Heading the check belongs to, e.g. "System"
+    Type    string   // StatusOK, StatusWarning or StatusError
+    Text    string
+    Extra   []string // Details such as expected DNS records
+}
+
+// CertificateStatus is row of Mail-in-a-Box TLS certificate table
+type CertificateStatus struct {
+    Domain string `json:"domain"`
+    Status string `json:"status"` // "success", "danger" or "not-applicable"
+    Text   string `json:"text"`
+}
+
+// ServerStatus is health summary of Mail-in-a-Box server as shown in its
+// admin panel. Parts which couldn't be loaded are listed in Errors
+type ServerStatus struct {
+    Checks         []StatusCheck
+    DiskUsage      string // Disk space check of status checks
+    RebootRequired bool
+    Backup         *mailinabox.BackupStatus
+    Certificates   []CertificateStatus
+    Users          []mailinabox.User  // Users of mailbox domain
+    Aliases        []mailinabox.Alias // Aliases of mailbox domain
+    Errors         []string
+    Updated        time.Time
+}
+
+// Failed returns status checks of error type
+func (s *ServerStatus) Failed() []StatusCheck {
+    var failed []StatusCheck
+    for _, check := range s.Checks {
+        if check.Type == StatusError {
+            failed = append(failed, check)
+        }
+    }
+    return failed
+}
+
+// Response of /admin/ssl/status
+type sslStatusResponse struct {
+    CanProvision []string            `json:"can_provision"`
+    Status       []CertificateStatus `json:"status"`
+}
+
+// Send request to admin endpoint and decode JSON response, for endpoints
+// not covered by mailinabox client or slower than its fixed timeout. Errors
+// are reported like errors of the client, so callAPI recognizes rejected
+// credentials
+func (tm *TempMailbox) adminJSON(ctx context.Context, method, endpoint string, result interface{}) error {
+    _, secret := tm.session()
+    resp, err := adminRequest(ctx, method, tm.apiURL, endpoint, tm.adminEmail, secret, "", nil)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return errutils.NewUnexpectedResponseStatusCodeError(resp.Request, resp)
+    }
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return fmt.Errorf("error reading response: %w", err)
+    }
+    return json.Unmarshal(body, result)
+}
+
+// ServerStatus loads status checks, reboot and backup status, TLS
+// certificates and users and aliases of mailbox domain. Only failure of
+// status checks is returned as error, other parts are skipped. Status
+// checks take long on server, context should allow a minute or more
+func (tm *TempMailbox) ServerStatus(ctx context.Context) (*ServerStatus, error) {
+    status := &ServerStatus{Updated: time.Now()}
+
+    // Status checks run on server for each request, so they get command
+    // timeout instead of shorter API timeout
+    var results []mailinabox.SystemStatus
+    checksCtx, cancel := context.WithTimeout(ctx, tm.timeouts().Command)
+    err := withRetry(checksCtx, tm.retry().Read, func() error {
+        return tm.callAPI(checksCtx, func(context.Context, *mailinabox.Client) error {
+            return tm.adminJSON(checksCtx, http.MethodPost, "system/status", &results)
+        })
+    })
+    cancel()
+    if err != nil {
+        return nil, fmt.Errorf("error getting status checks: %w", err)
+    }
+
+    section := ""
+    for _, result := range results {
+        if result.Type == "heading" {
+            section = result.Text
+            continue
+        }
+        check := StatusCheck{Section: section, Type: result.Type, Text: result.Text}
+        for _, extra := range result.Extra {
+            check.Extra = append(check.Extra, extra.Text)
+        }
+        status.Checks = append(status.Checks, check)
+        if status.DiskUsage == "" && strings.Contains(strings.ToLower(result.Text), "disk") {
+            status.DiskUsage = result.Text
+        }
+    }
+
+    // Remaining parts are optional, failures are only listed
+    part := func(name string, call func(ctx context.Context, client *mailinabox.Client) error) {
+        if err := tm.callAPI(ctx, call); err != nil {
+            status.Errors = append(status.Errors, fmt.Sprintf("error getting %s: %v", name, err))
+        }
+    }
+    part("reboot status", func(ctx context.Context, client *mailinabox.Client) error {
+        var err error
+        status.RebootRequired, err = client.System.GetRebootStatus(ctx)
+        return err
+    })
+    part("backup status", func(ctx context.Context, client *mailinabox.Client) error {
+        var err error
+        status.Backup, err = client.System.GetBackupStatus(ctx)
+        return err
+    })
+    part("TLS certificates", func(ctx context.Context, _ *mailinabox.Client) error {
+        var result sslStatusResponse
+        if err := tm.adminJSON(ctx, http.MethodGet, "ssl/status", &result); err != nil {
+            return err
+        }
+        status.Certificates = result.Status
+        return nil
+    })
+    part("users", func(ctx context.Context, client *mailinabox.Client) error {
+        domains, err := client.Mail.GetUsers(ctx)
+        for _, domain := range domains {
+            if strings.EqualFold(domain.Domain, tm.Domain) {
+                status.Users = domain.Users
+            }
+        }
+        return err
+    })
+    part("aliases", func(ctx context.Context, client *mailinabox.Client) error {
+        domains, err := client.Mail.GetAliases(ctx)
+        for _, domain := range domains {
+            if strings.EqualFold(domain.Domain, tm.Domain) {
+                status.Aliases = domain.Aliases
+            }
+        }
+        return err
+    })
+
+    return status, nil
+}
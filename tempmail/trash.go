@@ -0,0 +1,402 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "strings"
+
+    "github.com/emersion/go-imap"
+    "github.com/emersion/go-imap/client"
+    "github.com/emersion/go-imap/commands"
+    "github.com/emersion/go-imap/responses"
+)
+
+// Name of trash folder used when server does not advertise \Trash special-use folder
+const defaultTrashFolder = "Trash"
+
+// UID EXPUNGE command from UIDPLUS extension (RFC 4315). Unlike plain EXPUNGE
+// it removes only listed messages, leaving messages flagged as deleted by
+// other clients untouched
+type uidExpungeCommand struct {
+    SeqSet *imap.SeqSet
+}
+
+func (cmd *uidExpungeCommand) Command() *imap.Command {
+    return &imap.Command{
+        Name:      "UID",
+        Arguments: []interface{}{imap.RawString("EXPUNGE"), cmd.SeqSet},
+    }
+}
+
+// Find trash folder of the mailbox, creating it if needed
+func (tm *TempMailbox) trashFolder(imapClient *client.Client) (string, error) {
+    tm.mu.Lock()
+    cached := tm.trash
+    tm.mu.Unlock()
+    if cached != "" {
+        return cached, nil
+    }
+
+    mailboxes := make(chan *imap.MailboxInfo, 10)
+    done := make(chan error, 1)
+    go func() {
+        done <- imapClient.List("", "*", mailboxes)
+    }()
+
+    trash := ""
+    exists := false
+    for info := range mailboxes {
+        for _, attr := range info.Attributes {
+            if attr == imap.TrashAttr && trash == "" {
+                trash = info.Name
+            }
+        }
+        if info.Name == defaultTrashFolder {
+            exists = true
+        }
+    }
+    if err := <-done; err != nil {
+        return "", fmt.Errorf("error listing folders: %w", err)
+    }
+
+    if trash == "" {
+        trash = defaultTrashFolder
+        if !exists {
+            slog.Info("Creating folder", "mailbox", tm.Address(), "folder", trash)
+            if err := imapClient.Create(trash); err != nil {
+                return "", fmt.Errorf("error creating trash folder: %w", err)
+            }
+        }
+    }
+
+    tm.mu.Lock()
+    tm.trash = trash
+    tm.mu.Unlock()
+    return trash, nil
+}
+
+// Permanently remove messages with given UIDs from selected folder
+func expungeUIDs(imapClient *client.Client, uids []uint32) error {
+    if len(uids) == 0 {
+        return nil
+    }
+
+    seqSet := new(imap.SeqSet)
+    seqSet.AddNum(uids...)
+
+    // Mark messages as deleted
+    item := imap.FormatFlagsOp(imap.AddFlags, true)
+    flags := []interface{}{imap.DeletedFlag}
+    if err := imapClient.UidStore(seqSet, item, flags, nil); err != nil {
+        return fmt.Errorf("error marking mails for deletion: %w", err)
+    }
+
+    // Physically delete only marked messages when server supports it
+    ok, err := imapClient.Support("UIDPLUS")
+    if err != nil {
+        return fmt.Errorf("error reading server capabilities: %w", err)
+    }
+    if !ok {
+        return expungeProtected(imapClient, uids)
+    }
+
+    status, err := imapClient.Execute(&uidExpungeCommand{SeqSet: seqSet}, nil)
+    if err == nil {
+        err = status.Err()
+    }
+    if err != nil {
+        return fmt.Errorf("error deleting mails: %w", err)
+    }
+    return nil
+}
+
+// Remove messages with plain EXPUNGE, which also removes every other
+// message flagged \Deleted. Such messages, marked by other clients, lose
+// the flag for the time of EXPUNGE and get it back afterwards
+func expungeProtected(imapClient *client.Client, uids []uint32) error {
+    criteria := imap.NewSearchCriteria()
+    criteria.WithFlags = []string{imap.DeletedFlag}
+    flagged, err := imapClient.UidSearch(criteria)
+    if err != nil {
+        return fmt.Errorf("error searching deleted mails: %w", err)
+    }
+    ours := map[uint32]bool{}
+    for _, uid := range uids {
+        ours[uid] = true
+    }
+    others := new(imap.SeqSet)
+    count := 0
+    for _, uid := range flagged {
+        if !ours[uid] {
+            others.AddNum(uid)
+            count++
+        }
+    }
+
+    flags := []interface{}{imap.DeletedFlag}
+    if !others.Empty() {
+        slog.Warn("Server doesn't support UIDPLUS, keeping mails flagged deleted by other clients", "messages", count)
+        if err := imapClient.UidStore(others, imap.FormatFlagsOp(imap.RemoveFlags, true), flags, nil); err != nil {
+            return fmt.Errorf("error unmarking mails of other clients: %w", err)
+        }
+    }
+    expungeErr := imapClient.Expunge(nil)
+    if !others.Empty() {
+        if err := imapClient.UidStore(others, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+            slog.Error("Error restoring deleted flag of mails", "error", err)
+        }
+    }
+    if expungeErr != nil {
+        return fmt.Errorf("error deleting mails: %w", expungeErr)
+    }
+    return nil
+}
+
+// Handler of COPYUID response code (RFC 4315) mapping UIDs of source
+// folder to UIDs in destination. MOVE sends it in untagged OK response
+// (RFC 6851), COPY in tagged one returned by Execute
+type copyUIDHandler struct {
+    moved map[uint32]uint32
+}
+
+func (h *copyUIDHandler) Handle(resp imap.Resp) error {
+    status, ok := resp.(*imap.StatusResp)
+    if !ok || status.Tag != "*" || status.Code != "COPYUID" {
+        return responses.ErrUnhandled
+    }
+    return h.read(status.Arguments)
+}
+
+// Read arguments of COPYUID code: UIDVALIDITY, source and destination UIDs
+func (h *copyUIDHandler) read(args []interface{}) error {
+    if len(args) < 3 {
+        return fmt.Errorf("invalid COPYUID response")
+    }
+    source, err := expandUIDSet(fmt.Sprint(args[1]))
+    if err != nil {
+        return err
+    }
+    dest, err := expandUIDSet(fmt.Sprint(args[2]))
+    if err != nil {
+        return err
+    }
+    if len(source) != len(dest) {
+        return fmt.Errorf("invalid COPYUID response: %d source and %d destination UIDs", len(source), len(dest))
+    }
+    if h.moved == nil {
+        h.moved = map[uint32]uint32{}
+    }
+    for i := range source {
+        h.moved[source[i]] = dest[i]
+    }
+    return nil
+}
+
+// Expand UID set such as 4,7:9 in order of COPYUID response, ranges are
+// ascending
+func expandUIDSet(set string) ([]uint32, error) {
+    var uids []uint32
+    for _, part := range strings.Split(set, ",") {
+        first, last, isRange := strings.Cut(part, ":")
+        start, err := imap.ParseNumber(first)
+        if err != nil {
+            return nil, fmt.Errorf("invalid UID set %q: %w", set, err)
+        }
+        stop := start
+        if isRange {
+            if stop, err = imap.ParseNumber(last); err != nil {
+                return nil, fmt.Errorf("invalid UID set %q: %w", set, err)
+            }
+        }
+        if start > stop {
+            start, stop = stop, start
+        }
+        for uid := start; uid <= stop; uid++ {
+            uids = append(uids, uid)
+        }
+    }
+    return uids, nil
+}
+
+// Move messages with given UIDs from selected folder to destination folder
+// and return their new UIDs in destination folder, read from COPYUID
+// response. Servers without UIDPLUS don't report them and nil is returned.
+// Failure after command was sent is permanent: messages may already be
+// moved and repeating the move would lose their new UIDs
+func moveUIDs(imapClient *client.Client, uids []uint32, dest string) ([]uint32, error) {
+    if len(uids) == 0 {
+        return nil, nil
+    }
+
+    seqSet := new(imap.SeqSet)
+    seqSet.AddNum(uids...)
+
+    move, err := imapClient.Support("MOVE")
+    if err != nil {
+        return nil, fmt.Errorf("error reading server capabilities: %w", err)
+    }
+    var cmd imap.Commander = &commands.Copy{SeqSet: seqSet, Mailbox: dest}
+    if move {
+        cmd = &commands.Move{SeqSet: seqSet, Mailbox: dest}
+    }
+
+    handler := &copyUIDHandler{}
+    status, err := imapClient.Execute(&commands.Uid{Cmd: cmd}, handler)
+    if err == nil {
+        err = status.Err()
+    }
+    if err != nil {
+        return nil, &PermanentError{fmt.Errorf("error moving mails: %w", err)}
+    }
+    if status.Code == "COPYUID" {
+        if err := handler.read(status.Arguments); err != nil {
+            slog.Error("Error reading UIDs of moved mails", "error", err)
+        }
+    }
+    if !move {
+        if err := expungeUIDs(imapClient, uids); err != nil {
+            return nil, &PermanentError{err}
+        }
+    }
+
+    if handler.moved == nil {
+        slog.Warn("Server didn't report UIDs of moved mails", "folder", dest)
+        return nil, nil
+    }
+    var moved []uint32
+    for _, uid := range uids {
+        if destUID, ok := handler.moved[uid]; ok {
+            moved = append(moved, destUID)
+        }
+    }
+    return moved, nil
+}
+
+// Move messages from INBOX to trash. When uids is empty all messages are moved.
+// Returns number of moved messages and their UIDs in trash folder which can
+// be used to restore them
+func (tm *TempMailbox) moveToTrashInternal(ctx context.Context, uids []uint32) (int, []uint32, error) {
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer logout()
+
+    trash, err := tm.trashFolder(imapClient)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    // Select INBOX
+    mbox, err := imapClient.Select("INBOX", false)
+    if err != nil {
+        return 0, nil, fmt.Errorf("error selecting folder: %w", err)
+    }
+
+    if len(uids) == 0 {
+        if mbox.Messages == 0 {
+            return 0, nil, nil
+        }
+        uids, err = imapClient.UidSearch(imap.NewSearchCriteria())
+        if err != nil {
+            return 0, nil, fmt.Errorf("error searching mails: %w", err)
+        }
+    }
+
+    slog.Info("Moving mails", "mailbox", tm.Address(), "folder", trash, "messages", len(uids))
+    trashUIDs, err := moveUIDs(imapClient, uids, trash)
+    if err != nil {
+        return 0, nil, err
+    }
+    return len(uids), trashUIDs, nil
+}
+
+// RestoreMails moves messages with given trash UIDs back to INBOX
+func (tm *TempMailbox) RestoreMails(ctx context.Context, trashUIDs []uint32) error {
+    return withRetry(ctx, tm.retry().Modify, func() error {
+        return tm.restoreMailsInternal(ctx, trashUIDs)
+    })
+}
+
+func (tm *TempMailbox) restoreMailsInternal(ctx context.Context, trashUIDs []uint32) error {
+    slog.Info("Restoring mails from trash", "mailbox", tm.Address(), "messages", len(trashUIDs))
+
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        return err
+    }
+    defer logout()
+
+    trash, err := tm.trashFolder(imapClient)
+    if err != nil {
+        return err
+    }
+
+    if _, err := imapClient.Select(trash, false); err != nil {
+        return fmt.Errorf("error selecting folder: %w", err)
+    }
+
+    _, err = moveUIDs(imapClient, trashUIDs, "INBOX")
+    return err
+}
+
+// CheckTrash returns messages in trash folder
+func (tm *TempMailbox) CheckTrash(ctx context.Context) ([]Email, error) {
+    var emails []Email
+
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        imapClient, logout, err := tm.connectIMAP(ctx)
+        if err != nil {
+            return err
+        }
+        defer logout()
+
+        trash, err := tm.trashFolder(imapClient)
+        if err != nil {
+            return err
+        }
+
+        emails, err = fetchFolder(imapClient, trash)
+        return err
+    })
+
+    return emails, err
+}
+
+// EmptyTrash permanently deletes all messages in trash folder
+func (tm *TempMailbox) EmptyTrash(ctx context.Context) error {
+    return withRetry(ctx, tm.retry().Modify, func() error {
+        return tm.emptyTrashInternal(ctx)
+    })
+}
+
+func (tm *TempMailbox) emptyTrashInternal(ctx context.Context) error {
+    slog.Info("Emptying trash", "mailbox", tm.Address())
+
+    imapClient, logout, err := tm.connectIMAP(ctx)
+    if err != nil {
+        return err
+    }
+    defer logout()
+
+    trash, err := tm.trashFolder(imapClient)
+    if err != nil {
+        return err
+    }
+
+    mbox, err := imapClient.Select(trash, false)
+    if err != nil {
+        return fmt.Errorf("error selecting folder: %w", err)
+    }
+    if mbox.Messages == 0 {
+        return nil
+    }
+
+    uids, err := imapClient.UidSearch(imap.NewSearchCriteria())
+    if err != nil {
+        return fmt.Errorf("error searching mails: %w", err)
+    }
+
+    return expungeUIDs(imapClient, uids)
+}
@@ -0,0 +1,39 @@
+package tempmail_test
+
+import (
+    "reflect"
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+func TestExpandUIDSet(t *testing.T) {
+    tests := []struct {
+        set  string
+        want []uint32
+    }{
+        {"4", []uint32{4}},
+        {"4,7", []uint32{4, 7}},
+        {"7:9", []uint32{7, 8, 9}},
+        {"9:7", []uint32{7, 8, 9}},
+        {"4,7:9,2", []uint32{4, 7, 8, 9, 2}},
+        {"12:10,3:4", []uint32{10, 11, 12, 3, 4}},
+        {"5:5", []uint32{5}},
+    }
+    for _, test := range tests {
+        got, err := tempmail.ExpandUIDSet(test.set)
+        if err != nil {
+            t.Errorf("%s: %v", test.set, err)
+            continue
+        }
+        if !reflect.DeepEqual(got, test.want) {
+            t.Errorf("%s: got %v, want %v", test.set, got, test.want)
+        }
+    }
+
+    for _, set := range []string{"", "x", "4,", "4:", ":4", "1:*"} {
+        if got, err := tempmail.ExpandUIDSet(set); err == nil {
+            t.Errorf("%q: got %v, want error", set, got)
+        }
+    }
+}
@@ -0,0 +1,100 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "strings"
+
+    "github.com/nrdcg/mailinabox"
+)
+
+// Minimal password length accepted by Mail-in-a-Box
+const minPasswordLength = 8
+
+// DomainUsers returns mail users of mailbox domain
+func (tm *TempMailbox) DomainUsers(ctx context.Context) ([]mailinabox.User, error) {
+    var users []mailinabox.User
+    err := withRetry(ctx, tm.retry().Read, func() error {
+        return tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            domains, err := client.Mail.GetUsers(ctx)
+            if err != nil {
+                return fmt.Errorf("error getting users: %w", err)
+            }
+            users = nil
+            for _, domain := range domains {
+                if strings.EqualFold(domain.Domain, tm.Domain) {
+                    users = append(users, domain.Users...)
+                }
+            }
+            return nil
+        })
+    })
+    return users, err
+}
+
+// RemoveUser deletes mail user with given address, its mail and forwarding
+func (tm *TempMailbox) RemoveUser(ctx context.Context, address string) error {
+    if err := tm.removeForwarding(ctx, address); err != nil {
+        return err
+    }
+    return withRetry(ctx, tm.retry().Account, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            _, err := client.Mail.RemoveUser(ctx, address)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error deleting user %s: %w", address, err)
+        }
+        return nil
+    })
+}
+
+// SetUserPassword changes password of mail user with given address
+func (tm *TempMailbox) SetUserPassword(ctx context.Context, address, password string) error {
+    if len(password) < minPasswordLength || strings.ContainsAny(password, " \t") {
+        return &PermanentError{fmt.Errorf("password must have at least %d characters and no spaces", minPasswordLength)}
+    }
+    return withRetry(ctx, tm.retry().Account, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            _, err := client.Mail.SetUserPassword(ctx, address, password)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error setting password of %s: %w", address, err)
+        }
+        return nil
+    })
+}
+
+// ResetUserPassword sets random password of mail user and returns it
+func (tm *TempMailbox) ResetUserPassword(ctx context.Context, address string) (string, error) {
+    password := generateRandomString(16)
+    if err := tm.SetUserPassword(ctx, address, password); err != nil {
+        return "", err
+    }
+    return password, nil
+}
+
+// ConvertToAlias replaces mail user with alias forwarding its address to
+// given recipients. Mail stored in the mailbox is deleted with the user.
+// Mail-in-a-Box allows alias with address of existing user, which is how
+// forwarding keeps a copy in the mailbox; here the user is removed so the
+// address no longer has a mailbox at all
+func (tm *TempMailbox) ConvertToAlias(ctx context.Context, address string, forwardsTo []string) error {
+    if len(forwardsTo) == 0 {
+        return &PermanentError{fmt.Errorf("alias needs at least one recipient")}
+    }
+    if err := tm.RemoveUser(ctx, address); err != nil {
+        return err
+    }
+    return withRetry(ctx, tm.retry().Account, func() error {
+        err := tm.callAPI(ctx, func(ctx context.Context, client *mailinabox.Client) error {
+            _, err := client.Mail.UpsertAlias(ctx, true, address, forwardsTo, nil)
+            return err
+        })
+        if err != nil {
+            return fmt.Errorf("error creating alias %s: %w", address, err)
+        }
+        return nil
+    })
+}
@@ -0,0 +1,143 @@
+package tempmail
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "regexp"
+    "strings"
+    "time"
+)
+
+// Default interval between mailbox checks in WaitFor
+const DefaultPollInterval = 2 * time.Second
+
+// Config describes Mail-in-a-Box server and admin account used to
+// allocate mailboxes
+type Config struct {
+    ApiURL        string
+    AdminEmail    string
+    AdminPassword string // Password or session API key issued by Login
+    TOTP          string // Current TOTP code when admin account uses two-factor authentication
+    Domain        string
+    ImapServer    string
+    SmtpServer    string // Optional, defaults to IMAP host with port 587
+    SieveServer   string // Optional, defaults to IMAP host with port 4190
+    MailboxQuota  string // Optional storage quota of mailbox, such as "50M"
+    VerifyTLS     bool   // Verify certificates of IMAP and SMTP servers
+
+    // Spread mailboxes over several domains, see TempMailbox.DomainSelection
+    DomainSelection string
+    Domains         []string
+}
+
+// Allocate creates mailbox with random address on server. Caller should
+// delete it when done, usually with
+// defer mailbox.Delete(context.Background())
+func Allocate(ctx context.Context, config Config) (*TempMailbox, error) {
+    // Exchange password and TOTP code for session key, code can't be
+    // reused for each API request
+    if config.TOTP != "" {
+        session, err := Login(ctx, config.ApiURL, config.AdminEmail, config.AdminPassword, config.TOTP)
+        if err != nil {
+            return nil, err
+        }
+        config.AdminPassword = session.Key
+    }
+
+    mailbox, err := NewTempMailbox(config.ApiURL, config.AdminEmail, config.AdminPassword,
+        config.Domain, config.ImapServer, config.SmtpServer)
+    if err != nil {
+        return nil, err
+    }
+    mailbox.VerifyTLS = config.VerifyTLS
+    mailbox.SieveServer = config.SieveServer
+    mailbox.MailboxQuota = config.MailboxQuota
+    mailbox.DomainSelection = config.DomainSelection
+    mailbox.Domains = config.Domains
+    if err := mailbox.Create(ctx); err != nil {
+        return nil, err
+    }
+    return mailbox, nil
+}
+
+// Match selects messages in WaitFor. Empty fields match any message,
+// all set fields must match
+type Match struct {
+    From         string // Substring of sender name or address, case insensitive
+    SubjectRegex string // Regular expression matched against subject
+    BodyContains string // Substring of text or HTML content
+}
+
+// Return function reporting whether email matches
+func (m Match) compile() (func(Email) bool, error) {
+    var subject *regexp.Regexp
+    if m.SubjectRegex != "" {
+        var err error
+        subject, err = regexp.Compile(m.SubjectRegex)
+        if err != nil {
+            return nil, fmt.Errorf("invalid subject regex: %w", err)
+        }
+    }
+    from := strings.ToLower(m.From)
+
+    return func(email Email) bool {
+        if from != "" &&
+            !strings.Contains(strings.ToLower(email.FromAddress), from) &&
+            !strings.Contains(strings.ToLower(email.From), from) {
+            return false
+        }
+        if subject != nil && !subject.MatchString(email.Subject) {
+            return false
+        }
+        if m.BodyContains != "" &&
+            !strings.Contains(email.Content, m.BodyContains) &&
+            !strings.Contains(email.HTMLContent, m.BodyContains) {
+            return false
+        }
+        return true
+    }, nil
+}
+
+// WaitFor polls INBOX until message matching m arrives and returns the
+// newest one. Connection errors are retried until ctx is done, permanent
+// errors such as rejected login are returned at once
+func (tm *TempMailbox) WaitFor(ctx context.Context, m Match) (*Email, error) {
+    matches, err := m.compile()
+    if err != nil {
+        return nil, err
+    }
+
+    interval := tm.PollInterval
+    if interval <= 0 {
+        interval = DefaultPollInterval
+    }
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    var lastErr error
+    for {
+        emails, err := tm.checkMailInternal(ctx)
+        if IsPermanent(err) {
+            return nil, err
+        }
+        if err != nil {
+            slog.Error("Error checking mail while waiting", "error", err)
+            lastErr = err
+        }
+        for i := range emails {
+            if matches(emails[i]) {
+                return &emails[i], nil
+            }
+        }
+
+        select {
+        case <-ctx.Done():
+            if lastErr != nil {
+                return nil, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+            }
+            return nil, ctx.Err()
+        case <-ticker.C:
+        }
+    }
+}
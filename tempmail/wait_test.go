@@ -0,0 +1,49 @@
+package tempmail_test
+
+import (
+    "testing"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+)
+
+func TestMatch(t *testing.T) {
+    email := tempmail.Email{
+        From:        "Shop Team",
+        FromAddress: "noreply@shop.example.org",
+        Subject:     "Confirm your account",
+        Content:     "Your code is 123456",
+        HTMLContent: "<p>Click <a href=\"https://shop.example.org/confirm\">here</a></p>",
+    }
+
+    tests := []struct {
+        name  string
+        match tempmail.Match
+        want  bool
+    }{
+        {"empty", tempmail.Match{}, true},
+        {"sender name", tempmail.Match{From: "shop team"}, true},
+        {"sender address", tempmail.Match{From: "NOREPLY@shop"}, true},
+        {"other sender", tempmail.Match{From: "bank"}, false},
+        {"subject", tempmail.Match{SubjectRegex: "(?i)^confirm"}, true},
+        {"subject case", tempmail.Match{SubjectRegex: "^confirm"}, false},
+        {"text body", tempmail.Match{BodyContains: "code is"}, true},
+        {"HTML body", tempmail.Match{BodyContains: "/confirm"}, true},
+        {"body case", tempmail.Match{BodyContains: "CODE"}, false},
+        {"all fields", tempmail.Match{From: "shop", SubjectRegex: "account", BodyContains: "123456"}, true},
+        {"one field fails", tempmail.Match{From: "shop", SubjectRegex: "password"}, false},
+    }
+    for _, test := range tests {
+        matches, err := test.match.Compile()
+        if err != nil {
+            t.Errorf("%s: %v", test.name, err)
+            continue
+        }
+        if got := matches(email); got != test.want {
+            t.Errorf("%s: matches = %t, want %t", test.name, got, test.want)
+        }
+    }
+
+    if _, err := (tempmail.Match{SubjectRegex: "(unclosed"}).Compile(); err == nil {
+        t.Error("invalid subject regex compiled")
+    }
+}
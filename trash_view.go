@@ -0,0 +1,187 @@
+package main
+
+import (
+    "fmt"
+    "log/slog"
+    "sync"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// How long undo bar stays visible after deletion
+const undoTimeout = 10 * time.Second
+
+// Bar shown at the bottom of the main window after messages are moved to
+// trash, offering to undo the deletion
+type undoBar struct {
+    Container *fyne.Container
+
+    label  *widget.Label
+    button *widget.Button
+    mu     sync.Mutex
+    undo   func()
+    timer  *time.Timer
+}
+
+func newUndoBar() *undoBar {
+    bar := &undoBar{
+        label: widget.NewLabel(""),
+    }
+
+    bar.button = widget.NewButton("Undo", func() {
+        bar.mu.Lock()
+        undo := bar.undo
+        bar.undo = nil
+        bar.mu.Unlock()
+
+        bar.Hide()
+        if undo != nil {
+            undo()
+        }
+    })
+
+    bar.Container = container.NewHBox(bar.label, layout.NewSpacer(), bar.button)
+    bar.Container.Hide()
+    return bar
+}
+
+// Show bar with text, undo is called when user taps Undo before timeout.
+// Undo button is disabled when undo is nil
+func (b *undoBar) Show(text string, undo func()) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if b.timer != nil {
+        b.timer.Stop()
+    }
+    b.undo = undo
+    b.label.SetText(text)
+    if undo == nil {
+        b.button.Disable()
+    } else {
+        b.button.Enable()
+    }
+    b.Container.Show()
+    b.timer = time.AfterFunc(undoTimeout, b.Hide)
+}
+
+// Hide bar and forget pending undo action
+func (b *undoBar) Hide() {
+    b.mu.Lock()
+    b.undo = nil
+    b.mu.Unlock()
+    b.Container.Hide()
+}
+
+// Show window with messages in trash allowing to restore them or empty trash
+func showTrashWindow(myApp fyne.App, mailbox *tempmail.TempMailbox, audit *auditLog, timeout time.Duration, onRestore func()) {
+    window := myApp.NewWindow("Trash - " + mailbox.Address())
+
+    operations := newOperationBar()
+
+    trashList := container.NewVBox()
+
+    var refresh func()
+    refresh = func() {
+        ctx, done := operations.Start("Checking trash...", timeout)
+        defer done()
+
+        emails, err := mailbox.CheckTrash(ctx)
+        if err != nil {
+            slog.Error("Error checking trash", "error", err)
+            if !cancelled(ctx) {
+                dialog.ShowError(fmt.Errorf("Error checking trash: %v", err), window)
+            }
+            return
+        }
+
+        trashList.Objects = nil
+        if len(emails) == 0 {
+            trashList.Add(widget.NewLabel("Trash is empty"))
+        }
+        for _, email := range emails {
+            email := email // Create new variable for closure
+
+            fromLabel := widget.NewLabelWithStyle("From: "+email.From, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+            fromLabel.Wrapping = fyne.TextWrapWord
+            subjectLabel := widget.NewLabel("Subject: " + email.Subject)
+            subjectLabel.Wrapping = fyne.TextWrapWord
+
+            restoreBtn := widget.NewButton("Restore", func() {
+                go func() {
+                    ctx, done := operations.Start("Restoring message...", timeout)
+                    err := mailbox.RestoreMails(ctx, []uint32{email.UID})
+                    done()
+                    if err != nil {
+                        slog.Error("Error restoring message", "error", err)
+                        if !cancelled(ctx) {
+                            dialog.ShowError(fmt.Errorf("Error restoring message: %v", err), window)
+                        }
+                        return
+                    }
+                    onRestore()
+                    refresh()
+                }()
+            })
+
+            trashList.Add(widget.NewCard("", "", container.NewVBox(
+                fromLabel,
+                subjectLabel,
+                container.NewHBox(layout.NewSpacer(), restoreBtn),
+            )))
+        }
+        trashList.Refresh()
+    }
+
+    emptyButton := widget.NewButton("Empty trash", func() {
+        dialog.ShowConfirm(
+            "Empty trash",
+            "Permanently delete all messages in trash?\nThis cannot be undone.",
+            func(confirmed bool) {
+                if !confirmed {
+                    return
+                }
+                go func() {
+                    ctx, done := operations.Start("Emptying trash...", timeout)
+                    err := mailbox.EmptyTrash(ctx)
+                    done()
+                    audit.RecordResult(ActorGUI, AuditTrashEmpty, mailbox.Address(), err, "")
+                    if err != nil {
+                        slog.Error("Error emptying trash", "error", err)
+                        if !cancelled(ctx) {
+                            dialog.ShowError(fmt.Errorf("Error emptying trash: %v", err), window)
+                        }
+                    }
+                    refresh()
+                }()
+            },
+            window,
+        )
+    })
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(
+            container.NewHBox(
+                widget.NewButton("Refresh", func() {
+                    go refresh()
+                }),
+                layout.NewSpacer(),
+                emptyButton,
+            ),
+            operations.Container,
+        ),
+        nil,
+        nil,
+        nil,
+        container.NewScroll(container.NewPadded(trashList)),
+    ))
+    window.Resize(fyne.NewSize(450, 500))
+    window.Show()
+    go refresh()
+}
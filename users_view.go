@@ -0,0 +1,331 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log/slog"
+    "sort"
+    "strings"
+    "time"
+
+    "github.com/AlestackOverglow/malinatemp/tempmail"
+    "github.com/nrdcg/mailinabox"
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// Describe journal entry of mailbox for users list
+func journalSummary(entry journalEntry) string {
+    text := "Created by MalinaTEMP " + entry.Created.Local().Format("2006-01-02 15:04")
+    if entry.PasswordChanged != nil {
+        text += ", password changed " + entry.PasswordChanged.Local().Format("2006-01-02 15:04")
+    }
+    switch {
+    case len(entry.ForwardsTo) > 0:
+        text += ", converted to alias of " + strings.Join(entry.ForwardsTo, ", ")
+    case entry.Deleted != nil:
+        text += ", deleted " + entry.Deleted.Local().Format("2006-01-02 15:04")
+    }
+    return text
+}
+
+// Run action for each address and report failures in one dialog
+func runBulk(ctx context.Context, window fyne.Window, title string, addresses []string, action func(ctx context.Context, address string) error) int {
+    var failures []string
+    for _, address := range addresses {
+        if err := action(ctx, address); err != nil {
+            slog.Error("Error in bulk action", "action", strings.ToLower(title), "address", address, "error", err)
+            failures = append(failures, fmt.Sprintf("%s: %v", address, err))
+            if cancelled(ctx) {
+                break
+            }
+        }
+    }
+    if len(failures) > 0 {
+        dialog.ShowError(fmt.Errorf("%s failed for %d of %d mailboxes:\n%s", title, len(failures), len(addresses), strings.Join(failures, "\n")), window)
+    }
+    return len(addresses) - len(failures)
+}
+
+// Show window listing mail users of mailbox domain with bulk deletion,
+// password changes and conversion into forwarding alias. Current mailbox
+// and admin account can't be selected
+func showUsersWindow(myApp fyne.App, mailbox *tempmail.TempMailbox, adminEmail string, journal *mailboxJournal, audit *auditLog, timeout time.Duration, publish func(MailEvent)) {
+    window := myApp.NewWindow("Mail users - " + mailbox.Domain)
+
+    operations := newOperationBar()
+    usersList := container.NewVBox()
+    summaryLabel := widget.NewLabel("")
+
+    var users []mailinabox.User
+    selected := map[string]bool{}
+    protected := map[string]bool{
+        strings.ToLower(mailbox.Address()): true,
+        strings.ToLower(adminEmail):        true,
+    }
+
+    onlyJournal := widget.NewCheck("Only mailboxes created by MalinaTEMP", nil)
+    onlyJournal.SetChecked(true)
+
+    // Return users shown with current filter
+    visibleUsers := func() []mailinabox.User {
+        var visible []mailinabox.User
+        for _, user := range users {
+            if _, ok := journal.Find(user.Email); ok || !onlyJournal.Checked {
+                visible = append(visible, user)
+            }
+        }
+        return visible
+    }
+
+    var showUsers func()
+    showUsers = func() {
+        usersList.Objects = nil
+        visible := visibleUsers()
+        for _, user := range visible {
+            address := user.Email // Create new variable for closure
+
+            check := widget.NewCheck("", func(checked bool) {
+                if checked {
+                    selected[address] = true
+                } else {
+                    delete(selected, address)
+                }
+            })
+            check.SetChecked(selected[address])
+
+            text := address
+            if len(user.Privileges) > 0 {
+                text += " (" + strings.Join(user.Privileges, ", ") + ")"
+            }
+            if protected[strings.ToLower(address)] {
+                check.Disable()
+                text += ", in use"
+            }
+            if entry, ok := journal.Find(address); ok {
+                text += "\n" + journalSummary(entry)
+            }
+            label := widget.NewLabel(text)
+            label.Wrapping = fyne.TextWrapWord
+
+            usersList.Add(container.NewBorder(nil, nil, check, nil, label))
+        }
+        if len(visible) == 0 {
+            usersList.Add(widget.NewLabel("No mail users"))
+        }
+        usersList.Refresh()
+        summaryLabel.SetText(fmt.Sprintf("%d of %d users shown", len(visible), len(users)))
+    }
+    onlyJournal.OnChanged = func(bool) {
+        showUsers()
+    }
+
+    refresh := func() {
+        ctx, done := operations.Start("Loading users...", timeout)
+        defer done()
+
+        loaded, err := mailbox.DomainUsers(ctx)
+        if err != nil {
+            slog.Error("Error loading users", "error", err)
+            if !cancelled(ctx) {
+                dialog.ShowError(fmt.Errorf("Error loading users: %v", err), window)
+            }
+            return
+        }
+        sort.Slice(loaded, func(a, b int) bool {
+            return loaded[a].Email < loaded[b].Email
+        })
+        users = loaded
+        for address := range selected {
+            found := false
+            for _, user := range users {
+                found = found || user.Email == address
+            }
+            if !found {
+                delete(selected, address)
+            }
+        }
+        showUsers()
+    }
+
+    // Return selected addresses which are still shown
+    selectedAddresses := func() []string {
+        var addresses []string
+        for _, user := range visibleUsers() {
+            if selected[user.Email] {
+                addresses = append(addresses, user.Email)
+            }
+        }
+        return addresses
+    }
+
+    selectAllButton := widget.NewButton("Select all", func() {
+        for _, user := range visibleUsers() {
+            if !protected[strings.ToLower(user.Email)] {
+                selected[user.Email] = true
+            }
+        }
+        showUsers()
+    })
+    selectNoneButton := widget.NewButton("Select none", func() {
+        selected = map[string]bool{}
+        showUsers()
+    })
+    refreshButton := widget.NewButton("Refresh", func() {
+        go refresh()
+    })
+
+    deleteButton := widget.NewButton("Delete", func() {
+        addresses := selectedAddresses()
+        if len(addresses) == 0 {
+            return
+        }
+        dialog.ShowConfirm("Delete mailboxes",
+            fmt.Sprintf("Delete %d mailboxes and all their mail?", len(addresses)),
+            func(confirmed bool) {
+                if !confirmed {
+                    return
+                }
+                go func() {
+                    ctx, done := operations.Start("Deleting mailboxes...", timeout)
+                    detail := fmt.Sprintf("bulk deletion of %d mailboxes", len(addresses))
+                    runBulk(ctx, window, "Deletion", addresses, func(ctx context.Context, address string) error {
+                        err := mailbox.RemoveUser(ctx, address)
+                        audit.RecordResult(ActorGUI, AuditMailboxDelete, address, err, detail)
+                        if err != nil {
+                            return err
+                        }
+                        publish(newMailEvent(EventMailboxDeleted, address))
+                        return nil
+                    })
+                    done()
+                    refresh()
+                }()
+            }, window)
+    })
+
+    setPasswordButton := widget.NewButton("Set password", func() {
+        addresses := selectedAddresses()
+        if len(addresses) == 0 {
+            return
+        }
+        passwordEntry := widget.NewPasswordEntry()
+        dialog.ShowForm(fmt.Sprintf("Set password of %d mailboxes", len(addresses)), "Set", "Cancel",
+            []*widget.FormItem{widget.NewFormItem("Password", passwordEntry)},
+            func(confirmed bool) {
+                if !confirmed {
+                    return
+                }
+                password := passwordEntry.Text
+                go func() {
+                    ctx, done := operations.Start("Setting passwords...", timeout)
+                    defer done()
+                    changed := runBulk(ctx, window, "Setting password", addresses, func(ctx context.Context, address string) error {
+                        if err := mailbox.SetUserPassword(ctx, address, password); err != nil {
+                            return err
+                        }
+                        journal.PasswordChanged(address)
+                        return nil
+                    })
+                    if changed > 0 {
+                        dialog.ShowInformation("Success", fmt.Sprintf("Password of %d mailboxes changed", changed), window)
+                    }
+                }()
+            }, window)
+    })
+
+    resetPasswordButton := widget.NewButton("Reset passwords", func() {
+        addresses := selectedAddresses()
+        if len(addresses) == 0 {
+            return
+        }
+        go func() {
+            ctx, done := operations.Start("Resetting passwords...", timeout)
+            var passwords []string
+            runBulk(ctx, window, "Password reset", addresses, func(ctx context.Context, address string) error {
+                password, err := mailbox.ResetUserPassword(ctx, address)
+                if err != nil {
+                    return err
+                }
+                journal.PasswordChanged(address)
+                passwords = append(passwords, address+" "+password)
+                return nil
+            })
+            done()
+            if len(passwords) == 0 {
+                return
+            }
+
+            // New passwords are shown once, they are not stored anywhere
+            passwordsEntry := widget.NewMultiLineEntry()
+            passwordsEntry.SetText(strings.Join(passwords, "\n"))
+            passwordsEntry.SetMinRowsVisible(6)
+            dialog.ShowCustom("New passwords", "Close", container.NewVBox(
+                widget.NewLabel("Copy new passwords now, they are not saved:"),
+                passwordsEntry,
+            ), window)
+        }()
+    })
+
+    convertButton := widget.NewButton("Convert to alias", func() {
+        addresses := selectedAddresses()
+        if len(addresses) == 0 {
+            return
+        }
+        forwardEntry := widget.NewEntry()
+        forwardEntry.SetPlaceHolder("person@example.com, other@example.com")
+        dialog.ShowForm(fmt.Sprintf("Convert %d mailboxes to alias", len(addresses)), "Convert", "Cancel",
+            []*widget.FormItem{
+                widget.NewFormItem("Forward to", forwardEntry),
+                widget.NewFormItem("", widget.NewLabel("Mail stored in mailboxes is deleted")),
+            },
+            func(confirmed bool) {
+                if !confirmed {
+                    return
+                }
+                var forwardsTo []string
+                for _, address := range strings.Split(forwardEntry.Text, ",") {
+                    if address = strings.TrimSpace(address); address != "" {
+                        forwardsTo = append(forwardsTo, address)
+                    }
+                }
+                go func() {
+                    ctx, done := operations.Start("Converting mailboxes...", timeout)
+                    runBulk(ctx, window, "Conversion", addresses, func(ctx context.Context, address string) error {
+                        err := mailbox.ConvertToAlias(ctx, address, forwardsTo)
+                        audit.RecordResult(ActorGUI, AuditMailboxConvert, address, err,
+                            "alias forwarding to "+strings.Join(forwardsTo, ", "))
+                        if err != nil {
+                            return err
+                        }
+                        journal.Converted(address, forwardsTo)
+                        publish(newMailEvent(EventMailboxDeleted, address))
+                        return nil
+                    })
+                    done()
+                    refresh()
+                }()
+            }, window)
+    })
+
+    window.SetContent(container.NewBorder(
+        container.NewVBox(
+            container.NewHBox(onlyJournal, layout.NewSpacer(), refreshButton),
+            container.NewHBox(selectAllButton, selectNoneButton, layout.NewSpacer(), summaryLabel),
+        ),
+        container.NewVBox(
+            container.NewHBox(deleteButton, setPasswordButton, resetPasswordButton, convertButton),
+            operations.Container,
+        ),
+        nil,
+        nil,
+        container.NewVScroll(usersList),
+    ))
+    window.Resize(fyne.NewSize(600, 600))
+    window.Show()
+
+    go refresh()
+}
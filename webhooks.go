@@ -0,0 +1,351 @@
+package main
+
+import (
+    "bytes"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "log/slog"
+    "net/http"
+    "os"
+    "sync"
+    "time"
+)
+
+// File where undelivered webhook events are kept between launches
+const webhookOutboxFile = "webhook_outbox.json"
+
+// Delivery retry settings of webhook events
+const (
+    webhookMaxAttempts     = 10
+    webhookInitialInterval = 5 * time.Second
+    webhookMaxInterval     = 30 * time.Minute
+)
+
+// WebhookConfig describes receiver of webhook events
+type WebhookConfig struct {
+    URL     string
+    Secret  string   // Key for HMAC-SHA256 signature, signature is omitted when empty
+    Events  []string // Event types to deliver, all events when empty
+    Enabled bool
+}
+
+// Accepts reports whether webhook is subscribed to event type
+func (w WebhookConfig) Accepts(event string) bool {
+    if !w.Enabled {
+        return false
+    }
+    if len(w.Events) == 0 {
+        return true
+    }
+    for _, e := range w.Events {
+        if e == event {
+            return true
+        }
+    }
+    return false
+}
+
+// Sign payload with HMAC-SHA256, result is sent in X-TempMail-Signature header
+func signPayload(secret string, payload []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write(payload)
+    return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Pending delivery of event to one webhook. Secret is taken from current
+// webhook configuration when sending, so it's never written to outbox
+type webhookDelivery struct {
+    URL         string
+    EventID     string
+    EventType   string
+    Payload     json.RawMessage
+    Attempts    int
+    NextAttempt time.Time
+}
+
+// WebhookDispatcher delivers events to webhooks in background. Pending
+// deliveries are kept in persistent outbox so events are not lost when
+// receiver is down or application is restarted. Payloads in outbox include
+// message content, so deliveries are dropped as soon as their webhook is
+// removed or disabled, and the file is deleted when outbox is empty
+type WebhookDispatcher struct {
+    mu         sync.Mutex
+    hooks      []WebhookConfig
+    outbox     []*webhookDelivery
+    outboxPath string
+    client     *http.Client
+    wake       chan struct{}
+}
+
+// NewWebhookDispatcher creates dispatcher and loads pending deliveries from outbox file
+func NewWebhookDispatcher(outboxPath string, hooks []WebhookConfig) *WebhookDispatcher {
+    d := &WebhookDispatcher{
+        hooks:      hooks,
+        outboxPath: outboxPath,
+        client:     &http.Client{Timeout: 30 * time.Second},
+        wake:       make(chan struct{}, 1),
+    }
+
+    data, err := os.ReadFile(outboxPath)
+    if err == nil {
+        if err := json.Unmarshal(data, &d.outbox); err != nil {
+            slog.Error("Error reading webhook outbox", "error", err)
+        }
+        // Rewrite outbox without deliveries to disabled webhooks and
+        // secrets saved by older versions
+        d.dropOrphansLocked()
+        d.saveOutboxLocked()
+    } else if !os.IsNotExist(err) {
+        slog.Error("Error reading webhook outbox", "error", err)
+    }
+
+    return d
+}
+
+// SetWebhooks replaces configured webhooks. Queued deliveries are kept for
+// webhooks which are still enabled
+func (d *WebhookDispatcher) SetWebhooks(hooks []WebhookConfig) {
+    d.mu.Lock()
+    d.hooks = hooks
+    if d.dropOrphansLocked() {
+        d.saveOutboxLocked()
+    }
+    d.mu.Unlock()
+}
+
+// Return enabled webhook with URL, caller must hold the lock
+func (d *WebhookDispatcher) hookLocked(url string) (WebhookConfig, bool) {
+    for _, hook := range d.hooks {
+        if hook.URL == url && hook.Enabled {
+            return hook, true
+        }
+    }
+    return WebhookConfig{}, false
+}
+
+// Remove deliveries to webhooks which are no longer enabled and report
+// whether any were removed, caller must hold the lock
+func (d *WebhookDispatcher) dropOrphansLocked() bool {
+    kept := d.outbox[:0]
+    for _, delivery := range d.outbox {
+        if _, ok := d.hookLocked(delivery.URL); ok {
+            kept = append(kept, delivery)
+        } else {
+            slog.Info("Dropping webhook event of disabled webhook", "event", delivery.EventID, "url", delivery.URL)
+        }
+    }
+    if len(kept) == len(d.outbox) {
+        return false
+    }
+    for i := len(kept); i < len(d.outbox); i++ {
+        d.outbox[i] = nil
+    }
+    d.outbox = kept
+    return true
+}
+
+// Publish queues event for all webhooks subscribed to its type
+func (d *WebhookDispatcher) Publish(event MailEvent) {
+    payload, err := json.Marshal(event)
+    if err != nil {
+        slog.Error("Error serializing webhook event", "error", err)
+        return
+    }
+
+    d.mu.Lock()
+    queued := 0
+    for _, hook := range d.hooks {
+        if !hook.Accepts(event.Type) {
+            continue
+        }
+        d.queueLocked(hook, event, payload)
+        queued++
+    }
+    d.unlockAndWake(queued)
+}
+
+// PublishTo queues event for enabled webhook with URL regardless of event
+// types it is subscribed to. Used by mail rules firing specific webhook
+func (d *WebhookDispatcher) PublishTo(url string, event MailEvent) error {
+    payload, err := json.Marshal(event)
+    if err != nil {
+        return fmt.Errorf("error serializing webhook event: %w", err)
+    }
+
+    d.mu.Lock()
+    queued := 0
+    if hook, ok := d.hookLocked(url); ok {
+        d.queueLocked(hook, event, payload)
+        queued++
+    }
+    d.unlockAndWake(queued)
+
+    if queued == 0 {
+        return fmt.Errorf("webhook %s is not configured or disabled", url)
+    }
+    return nil
+}
+
+// Add delivery of event to outbox, caller must hold the lock
+func (d *WebhookDispatcher) queueLocked(hook WebhookConfig, event MailEvent, payload []byte) {
+    d.outbox = append(d.outbox, &webhookDelivery{
+        URL:         hook.URL,
+        EventID:     event.ID,
+        EventType:   event.Type,
+        Payload:     payload,
+        NextAttempt: time.Now(),
+    })
+}
+
+// Save outbox and wake delivery when events were queued, then release the
+// lock held by caller
+func (d *WebhookDispatcher) unlockAndWake(queued int) {
+    if queued > 0 {
+        d.saveOutboxLocked()
+    }
+    d.mu.Unlock()
+
+    if queued > 0 {
+        select {
+        case d.wake <- struct{}{}:
+        default:
+        }
+    }
+}
+
+// Write outbox to file, caller must hold the lock. Empty outbox removes
+// the file, so delivered payloads don't stay on disk
+func (d *WebhookDispatcher) saveOutboxLocked() {
+    if len(d.outbox) == 0 {
+        if err := os.Remove(d.outboxPath); err != nil && !os.IsNotExist(err) {
+            slog.Error("Error removing webhook outbox", "error", err)
+        }
+        return
+    }
+
+    data, err := json.MarshalIndent(d.outbox, "", "    ")
+    if err != nil {
+        slog.Error("Error serializing webhook outbox", "error", err)
+        return
+    }
+
+    tmpPath := d.outboxPath + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+        slog.Error("Error saving webhook outbox", "error", err)
+        return
+    }
+    if err := os.Rename(tmpPath, d.outboxPath); err != nil {
+        slog.Error("Error saving webhook outbox", "error", err)
+    }
+}
+
+// Run delivers queued events until the process exits
+func (d *WebhookDispatcher) Run() {
+    for {
+        wait := d.deliverDue()
+
+        timer := time.NewTimer(wait)
+        select {
+        case <-d.wake:
+        case <-timer.C:
+        }
+        timer.Stop()
+    }
+}
+
+// Deliver all due events and return time until next pending attempt
+func (d *WebhookDispatcher) deliverDue() time.Duration {
+    d.mu.Lock()
+    var due []*webhookDelivery
+    now := time.Now()
+    for _, delivery := range d.outbox {
+        if !delivery.NextAttempt.After(now) {
+            due = append(due, delivery)
+        }
+    }
+    d.mu.Unlock()
+
+    for _, delivery := range due {
+        d.mu.Lock()
+        hook, ok := d.hookLocked(delivery.URL)
+        d.mu.Unlock()
+        if !ok {
+            // Webhook was disabled meanwhile, SetWebhooks dropped delivery
+            continue
+        }
+        err := d.deliver(delivery, hook.Secret)
+
+        d.mu.Lock()
+        delivery.Attempts++
+        if err == nil {
+            slog.Info("Delivered webhook event", "event", delivery.EventID, "type", delivery.EventType, "url", delivery.URL)
+            d.removeLocked(delivery)
+        } else if delivery.Attempts >= webhookMaxAttempts {
+            slog.Error("Giving up webhook event", "event", delivery.EventID, "url", delivery.URL, "attempts", delivery.Attempts, "error", err)
+            d.removeLocked(delivery)
+        } else {
+            // Exponential backoff limited by maximum interval
+            interval := webhookInitialInterval << (delivery.Attempts - 1)
+            if interval > webhookMaxInterval || interval <= 0 {
+                interval = webhookMaxInterval
+            }
+            delivery.NextAttempt = time.Now().Add(interval)
+            slog.Warn("Error delivering webhook event", "event", delivery.EventID, "url", delivery.URL, "attempt", delivery.Attempts, "error", err)
+        }
+        d.saveOutboxLocked()
+        d.mu.Unlock()
+    }
+
+    // Find next pending attempt
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    wait := time.Hour
+    for _, delivery := range d.outbox {
+        if until := time.Until(delivery.NextAttempt); until < wait {
+            wait = until
+        }
+    }
+    if wait < 0 {
+        wait = 0
+    }
+    return wait
+}
+
+// Remove delivery from outbox, caller must hold the lock
+func (d *WebhookDispatcher) removeLocked(delivery *webhookDelivery) {
+    for i, item := range d.outbox {
+        if item == delivery {
+            d.outbox = append(d.outbox[:i], d.outbox[i+1:]...)
+            return
+        }
+    }
+}
+
+// Post event payload to webhook URL, signed with secret when set
+func (d *WebhookDispatcher) deliver(delivery *webhookDelivery, secret string) error {
+    req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+    if err != nil {
+        return fmt.Errorf("error creating request: %w", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "MalinaTEMP-Webhook")
+    req.Header.Set("X-TempMail-Event", delivery.EventType)
+    req.Header.Set("X-TempMail-Delivery", delivery.EventID)
+    if secret != "" {
+        req.Header.Set("X-TempMail-Signature", signPayload(secret, delivery.Payload))
+    }
+
+    resp, err := d.client.Do(req)
+    if err != nil {
+        return fmt.Errorf("error sending request: %w", err)
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        return fmt.Errorf("receiver responded with status %s", resp.Status)
+    }
+    return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "fmt"
+    "net/url"
+    "strings"
+
+    "fyne.io/fyne/v2"
+    "fyne.io/fyne/v2/container"
+    "fyne.io/fyne/v2/dialog"
+    "fyne.io/fyne/v2/layout"
+    "fyne.io/fyne/v2/widget"
+)
+
+// All webhook event types, in order shown in settings
+var webhookEventTypes = []string{EventMessageReceived, EventMailboxCreated, EventMailboxDeleted}
+
+// Show dialog for managing webhooks, changes are saved to settings file
+func showWebhooksDialog(window fyne.Window, settings Settings, update func(change func(*Settings)) error) {
+    hooks := append([]WebhookConfig{}, settings.Webhooks...)
+
+    hooksList := container.NewVBox()
+    var updateList func()
+    updateList = func() {
+        hooksList.Objects = nil
+        if len(hooks) == 0 {
+            hooksList.Add(widget.NewLabel("No webhooks configured"))
+        }
+        for i, hook := range hooks {
+            i := i // Create new variable for closure
+
+            events := "all events"
+            if len(hook.Events) > 0 {
+                events = strings.Join(hook.Events, ", ")
+            }
+            label := widget.NewLabel(fmt.Sprintf("%s\n%s", hook.URL, events))
+            label.Wrapping = fyne.TextWrapWord
+
+            enabledCheck := widget.NewCheck("Enabled", func(checked bool) {
+                hooks[i].Enabled = checked
+            })
+            enabledCheck.SetChecked(hook.Enabled)
+
+            removeBtn := widget.NewButton("Remove", func() {
+                hooks = append(hooks[:i], hooks[i+1:]...)
+                updateList()
+            })
+
+            hooksList.Add(container.NewBorder(nil, nil, nil, container.NewHBox(enabledCheck, removeBtn), label))
+        }
+        hooksList.Refresh()
+    }
+    updateList()
+
+    // Create fields for new webhook
+    urlEntry := widget.NewEntry()
+    urlEntry.SetPlaceHolder("https://example.com/hooks/tempmail")
+
+    secretEntry := widget.NewPasswordEntry()
+    secretEntry.SetPlaceHolder("HMAC secret (optional)")
+
+    eventChecks := make([]*widget.Check, len(webhookEventTypes))
+    eventBox := container.NewHBox()
+    for i, eventType := range webhookEventTypes {
+        eventChecks[i] = widget.NewCheck(eventType, nil)
+        eventChecks[i].SetChecked(true)
+        eventBox.Add(eventChecks[i])
+    }
+
+    addButton := widget.NewButton("Add", func() {
+        parsed, err := url.Parse(urlEntry.Text)
+        if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+            dialog.ShowError(fmt.Errorf("invalid webhook URL"), window)
+            return
+        }
+
+        var events []string
+        for i, check := range eventChecks {
+            if check.Checked {
+                events = append(events, webhookEventTypes[i])
+            }
+        }
+        if len(events) == 0 {
+            dialog.ShowError(fmt.Errorf("select at least one event"), window)
+            return
+        }
+        if len(events) == len(webhookEventTypes) {
+            events = nil
+        }
+
+        hooks = append(hooks, WebhookConfig{
+            URL:     urlEntry.Text,
+            Secret:  secretEntry.Text,
+            Events:  events,
+            Enabled: true,
+        })
+        urlEntry.SetText("")
+        secretEntry.SetText("")
+        updateList()
+    })
+
+    saveButton := widget.NewButton("Save", func() {
+        if err := update(func(s *Settings) { s.Webhooks = hooks }); err != nil {
+            dialog.ShowError(err, window)
+            return
+        }
+        dialog.ShowInformation("Success", "Webhooks saved", window)
+    })
+
+    formContent := container.NewVBox(
+        widget.NewLabelWithStyle("Webhooks", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+        hooksList,
+        widget.NewSeparator(),
+        widget.NewLabel("URL:"),
+        urlEntry,
+        widget.NewLabel("Secret:"),
+        secretEntry,
+        eventBox,
+        container.NewHBox(addButton, layout.NewSpacer(), saveButton),
+    )
+
+    webhooksDialog := dialog.NewCustom("Webhooks", "Close", container.NewPadded(container.NewVScroll(formContent)), window)
+    webhooksDialog.Resize(fyne.NewSize(500, 500))
+    webhooksDialog.Show()
+}